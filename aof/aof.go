@@ -1,116 +1,695 @@
 package aof
 
 import (
+	"bufio"
+	"errors"
 	"goRedis/config"
 	"goRedis/interface/database"
 	"goRedis/lib/logger"
 	"goRedis/lib/utils"
+	"goRedis/rdb"
 	"goRedis/resp/connection"
-	"goRedis/resp/parser"
 	"goRedis/resp/reply"
 	"io"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-const aofBufferSize = 1 << 16
+const (
+	defaultAofDirname  = "appendonlydir"
+	defaultAofFilename = "appendonly.aof"
+)
+
+const (
+	aofQueueSize     = 1 << 14 // 写入队列的长度，队列满时AddAof阻塞，使写入速度不超过磁盘的速度
+	aofWriterSize    = 1 << 16 // 写入文件的缓冲区大小
+	aofMaxBatchCount = 1024    // 一次批量写入最多包含的payload个数
+)
+
+// 可以在运行时修改的重写配置，启动时由数据库根据配置文件设置
+var (
+	autoRewritePercentage atomic.Int64 // 当前生效的auto-aof-rewrite-percentage
+	autoRewriteMinSize    atomic.Int64 // 当前生效的auto-aof-rewrite-min-size
+	useRdbPreamble        atomic.Bool  // 当前生效的aof-use-rdb-preamble
+)
+
+// SetAutoRewritePercentage 修改自动重写的增长百分比，0表示关闭自动重写
+func SetAutoRewritePercentage(percentage int) {
+	autoRewritePercentage.Store(int64(percentage))
+}
+
+// AutoRewritePercentage 返回当前自动重写的增长百分比
+func AutoRewritePercentage() int {
+	return int(autoRewritePercentage.Load())
+}
+
+// SetAutoRewriteMinSize 修改自动重写的最小文件大小(字节)
+func SetAutoRewriteMinSize(size int64) {
+	autoRewriteMinSize.Store(size)
+}
+
+// AutoRewriteMinSize 返回当前自动重写的最小文件大小(字节)
+func AutoRewriteMinSize() int64 {
+	return autoRewriteMinSize.Load()
+}
+
+// SetUseRdbPreamble 修改重写时是否使用快照格式写入基础文件
+func SetUseRdbPreamble(use bool) {
+	useRdbPreamble.Store(use)
+}
+
+// UseRdbPreamble 返回重写时是否使用快照格式写入基础文件
+func UseRdbPreamble() bool {
+	return useRdbPreamble.Load()
+}
+
+var (
+	ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+	errHandlerClosed     = errors.New("aof handler closed")
+)
 
 type payload struct {
-	cmdLine database.CmdLine
+	data    []byte // 序列化后的命令，在AddAof中立即序列化，避免命令参数与内存中的数据共享底层数组时被后续修改
 	dbIndex int
+	done    chan struct{} // always策略下写入并同步后关闭，AddAof等待其关闭后返回
+	err     error         // 写入或同步失败时的错误，在关闭done之前设置
 }
 
 type AofHandler struct {
-	database    database.Database
-	aofChan     chan *payload //存储引擎写操作时，传递消息
-	aofFile     *os.File
-	aofFileName string
-	currentDB   int //维护当前库的id
+	database    database.DBEngine
+	tmpDBMaker  func() database.DBEngine // 创建重写时使用的临时数据库
+	aofChan     chan *payload            //存储引擎写操作时，传递消息
+	aofFile     *os.File                 // 正在写入的增量文件，关闭后为nil
+	aofWriter   *bufio.Writer            // aofFile的缓冲区，每批payload写完后刷新
+	aofDirname  string                   // 存放AOF文件和清单的目录
+	aofFileName string                   // AOF文件名的前缀
+	manifest    *manifest                // 当前的清单
+	currentDB   int                      //维护当前库的id
+
+	closeMu    sync.RWMutex  // 保护closed，AddAof持有读锁发送payload，保证关闭aofChan后不会再发送
+	closed     bool          // 是否已经关闭
+	writerDone chan struct{} // 写入协程处理完所有payload后关闭
+	closeChan  chan struct{} // 关闭信号，用于停止后台任务
+
+	queueFullWaits atomic.Int64 // 写入队列已满，AddAof需要等待的次数
+	writeBatches   atomic.Int64 // 批量写入的次数
+	writePayloads  atomic.Int64 // 写入的payload个数
+
+	mu        sync.Mutex   // 保护aofFile、aofWriter、manifest和currentDB，写入文件与切换文件互斥
+	rewriting atomic.Bool  // 是否有重写正在进行
+	aofSize   atomic.Int64 // 所有AOF文件的大小之和
+	baseSize  atomic.Int64 // 启动或上一次重写后AOF文件的大小，用于判断是否需要自动重写
+
+	lastFsync    atomic.Int64          // 最近一次同步的unix时间戳(秒)
+	pendingFsync atomic.Bool           // 是否有已经写入但还没有同步到磁盘的数据
+	writeErr     atomic.Pointer[error] // 最近一次写入或同步失败的错误，之后写入或同步成功时清除
 }
 
-func NewAofHandler(database database.Database) (*AofHandler, error) {
+func NewAofHandler(database database.DBEngine, tmpDBMaker func() database.DBEngine) (*AofHandler, error) {
 	handler := &AofHandler{}
+	handler.aofDirname = config.Properties.AppendDirname
+	if handler.aofDirname == "" {
+		handler.aofDirname = defaultAofDirname
+	}
 	handler.aofFileName = config.Properties.AppendFilename
+	if handler.aofFileName == "" {
+		handler.aofFileName = defaultAofFilename
+	}
+	if strings.ContainsAny(handler.aofFileName, "/\\ \t") {
+		return nil, errors.New("appendfilename can't be a path or contain spaces: " + handler.aofFileName)
+	}
 	handler.database = database
-	handler.LoadAof() // 当调用NewAofHandler时，是启动操作。先把写在硬盘上的aof文件恢复到内存中来。
+	handler.tmpDBMaker = tmpDBMaker
+	if err := os.MkdirAll(handler.aofDirname, 0755); err != nil {
+		return nil, err
+	}
+	m, err := handler.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	handler.manifest = m
+	handler.removeUnusedFiles(m)
+	// 当调用NewAofHandler时，是启动操作。先把写在硬盘上的aof文件恢复到内存中来。
+	if err := handler.LoadAof(); err != nil {
+		return nil, err
+	}
 
-	aofFile, err := os.OpenFile(handler.aofFileName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	aofFile, err := handler.openIncrFile()
 	if err != nil {
 		return nil, err
 	}
 	handler.aofFile = aofFile
-	handler.aofChan = make(chan *payload, aofBufferSize)
+	handler.aofWriter = bufio.NewWriterSize(aofFile, aofWriterSize)
+	size := handler.totalSize(handler.manifest)
+	handler.aofSize.Store(size)
+	handler.baseSize.Store(size)
+	handler.lastFsync.Store(time.Now().Unix())
+	handler.aofChan = make(chan *payload, aofQueueSize)
+	handler.writerDone = make(chan struct{})
+	handler.closeChan = make(chan struct{})
 	go func() {
 		handler.handleAof()
 	}()
+	handler.startFsyncCron()
 	return handler, nil
 }
 
 // ↓异步落盘\持久化
-func (handler *AofHandler) AddAof(dbIndex int, cmd database.CmdLine) { //传入：几号DB数据库
+// AddAof 添加AOF命令，同一次调用传入的多条命令会连续写入文件，中间不会插入其他命令，如事务的MULTI...EXEC。
+// always策略下等待命令写入并同步到磁盘后才返回，返回写入或同步失败的错误，其他策略下总是返回nil。
+// 关闭后添加的命令会被丢弃
+func (handler *AofHandler) AddAof(dbIndex int, cmds ...database.CmdLine) error { //传入：几号DB数据库
 	if config.Properties.AppendOnly && handler.aofChan != nil {
+		var data []byte
+		for _, cmd := range cmds {
+			data = append(data, reply.NewMultiBulkReply(cmd).ToBytes()...)
+		}
 		//新建pyload
-		handler.aofChan <- &payload{ //将传入参数组装为payload并传到channel
-			cmdLine: cmd,
+		p := &payload{ //将传入参数组装为payload并传到channel
+			data:    data,
 			dbIndex: dbIndex,
 		}
+		if FsyncPolicy() == FsyncAlways {
+			p.done = make(chan struct{})
+		}
+		if !handler.enqueue(p) {
+			logger.Warn("AOF: handler closed, discard command")
+			return nil
+		}
+		if p.done != nil {
+			<-p.done
+			return p.err
+		}
+	}
+	return nil
+}
+
+// enqueue 将payload放入写入队列，队列满时阻塞等待，已经关闭时返回false
+func (handler *AofHandler) enqueue(p *payload) bool {
+	handler.closeMu.RLock()
+	defer handler.closeMu.RUnlock()
+	if handler.closed {
+		return false
+	}
+	select {
+	case handler.aofChan <- p:
+	default:
+		handler.queueFullWaits.Add(1)
+		handler.aofChan <- p
 	}
+	return true
 }
 
-// 接收aofChan中的payload
+// handleAof 接收aofChan中的payload，将队列中已有的payload合并为一批写入，每批只刷新和同步一次
 func (handler *AofHandler) handleAof() {
+	defer close(handler.writerDone)
 	handler.currentDB = 0
 
+	batch := make([]*payload, 0, aofMaxBatchCount)
 	for p := range handler.aofChan {
-		if p.dbIndex != handler.currentDB { //检查是否跟上一个DB一样,如果不一样，插入select语句
-			args := utils.ToCmdLine("select", strconv.Itoa(p.dbIndex))
-			data := reply.NewMultiBulkReply(args).ToBytes() //得到写入文件的字节
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
-				logger.Error(err)
-				continue
+		batch = append(batch[:0], p)
+	collect:
+		for len(batch) < aofMaxBatchCount {
+			select {
+			case p, ok := <-handler.aofChan:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, p)
+			default:
+				break collect
 			}
-			handler.currentDB = p.dbIndex
 		}
-		data := reply.NewMultiBulkReply(p.cmdLine).ToBytes()
-		_, err := handler.aofFile.Write(data)
-		if err != nil {
-			logger.Error(err)
+		handler.writeBatch(batch)
+	}
+}
+
+// writeBatch 写入一批payload并刷新缓冲区，其中有always策略的payload时同步后再通知等待的AddAof。
+// 写入、刷新或同步失败时丢弃这一批数据，等待的AddAof返回该错误，并记录到writeErr中
+func (handler *AofHandler) writeBatch(batch []*payload) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	handler.writeBatchLocked(batch)
+}
+
+// writeBatchLocked 与writeBatch相同，调用者需要持有mu
+func (handler *AofHandler) writeBatchLocked(batch []*payload) {
+	fileSize, statErr := handler.fileSizeLocked()
+	aofSize := handler.aofSize.Load()
+	var err error
+	needFsync := false
+	for _, p := range batch {
+		if writeErr := handler.writePayloadLocked(p); writeErr != nil && err == nil {
+			err = writeErr
 		}
+		needFsync = needFsync || p.done != nil
 	}
+	if flushErr := handler.flushLocked(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if needFsync && err == nil {
+		if syncErr := handler.fsyncLocked(); syncErr != nil {
+			err = errors.New("fsync failed: " + syncErr.Error())
+		}
+	}
+	if err != nil && statErr == nil {
+		handler.discardLocked(fileSize, aofSize)
+	}
+	handler.setWriteErr(err)
+	for _, p := range batch {
+		if p.done != nil {
+			p.err = err
+			close(p.done)
+		}
+	}
+	handler.writeBatches.Add(1)
+	handler.writePayloads.Add(int64(len(batch)))
 }
 
-// loadAof
-func (handler *AofHandler) LoadAof() {
-	file, err := os.Open(handler.aofFileName)
+// fileSizeLocked 返回当前增量文件的大小。每批数据写完后都会刷新缓冲区，写入一批数据前文件中即为全部已写入的数据。
+// 调用者需要持有mu
+func (handler *AofHandler) fileSizeLocked() (int64, error) {
+	info, err := handler.aofFile.Stat()
 	if err != nil {
-		logger.Error(err)
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// discardLocked 丢弃写入失败的一批数据：清空缓冲区并将文件截断到写入前的大小，避免文件中留下不完整的命令，
+// 之后的写入重新写入SELECT命令。调用者需要持有mu
+func (handler *AofHandler) discardLocked(fileSize int64, aofSize int64) {
+	handler.aofWriter.Reset(handler.aofFile)
+	if err := handler.aofFile.Truncate(fileSize); err != nil {
+		logger.Error("AOF truncate failed: " + err.Error())
+	}
+	handler.aofSize.Store(aofSize)
+	handler.currentDB = -1
+}
+
+// retryWrite 写入失败后由后台任务定期调用，写入一条SELECT命令并同步，成功时清除writeErr，恢复接收修改数据的命令
+func (handler *AofHandler) retryWrite() {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.aofFile == nil {
 		return
 	}
-	defer file.Close()
-	ch := parser.ParseStream(file)
-	tempConnection := &connection.RESPConn{}
-	for p := range ch { // 接收解析器的返回值
-		if p.Err != nil {
-			if p.Err == io.EOF {
-				logger.Info("AOF: load aof file finished")
-				break
-			}
-			logger.Error(p.Err)
+	dbIndex := max(handler.currentDB, 0)
+	handler.currentDB = -1 // 使下面的payload写入SELECT命令
+	handler.writeBatchLocked([]*payload{{dbIndex: dbIndex, done: make(chan struct{})}})
+}
+
+// setWriteErr 记录最近一次写入或同步的结果，失败时输出日志
+func (handler *AofHandler) setWriteErr(err error) {
+	if err == nil {
+		handler.writeErr.Store(nil)
+		return
+	}
+	logger.Error("AOF write failed: " + err.Error())
+	handler.writeErr.Store(&err)
+}
+
+// WriteErr 返回最近一次写入或同步失败的错误，之后已经写入或同步成功时返回nil
+func (handler *AofHandler) WriteErr() error {
+	if err := handler.writeErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// flushLocked 将缓冲区中的数据写入文件。写入失败时丢弃缓冲区中的数据，避免之后的写入一直失败。调用者需要持有mu
+func (handler *AofHandler) flushLocked() error {
+	if err := handler.aofWriter.Flush(); err != nil {
+		handler.aofWriter.Reset(handler.aofFile)
+		return err
+	}
+	return nil
+}
+
+// QueueStats 写入队列的统计信息
+type QueueStats struct {
+	Depth     int   // 队列中等待写入的payload个数
+	Capacity  int   // 队列的长度
+	FullWaits int64 // 队列已满，AddAof需要等待的次数
+	Batches   int64 // 批量写入的次数
+	Payloads  int64 // 写入的payload个数
+}
+
+// QueueStats 返回写入队列的统计信息
+func (handler *AofHandler) QueueStats() QueueStats {
+	return QueueStats{
+		Depth:     len(handler.aofChan),
+		Capacity:  cap(handler.aofChan),
+		FullWaits: handler.queueFullWaits.Load(),
+		Batches:   handler.writeBatches.Load(),
+		Payloads:  handler.writePayloads.Load(),
+	}
+}
+
+// Close 停止接收新的命令，等待队列中的命令全部写入后刷新缓冲区、同步并关闭文件
+func (handler *AofHandler) Close() error {
+	handler.closeMu.Lock()
+	if handler.closed {
+		handler.closeMu.Unlock()
+		return nil
+	}
+	handler.closed = true
+	close(handler.aofChan)
+	handler.closeMu.Unlock()
+
+	<-handler.writerDone
+	close(handler.closeChan)
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	err := handler.flushLocked()
+	if syncErr := handler.aofFile.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := handler.aofFile.Close(); err == nil {
+		err = closeErr
+	}
+	handler.aofFile = nil
+	handler.pendingFsync.Store(false)
+	return err
+}
+
+// writePayloadLocked 写入一个payload，库与上一个payload不同时先写入SELECT命令。调用者需要持有mu
+func (handler *AofHandler) writePayloadLocked(p *payload) error {
+	if p.dbIndex != handler.currentDB { //检查是否跟上一个DB一样,如果不一样，插入select语句
+		args := utils.ToCmdLine("select", strconv.Itoa(p.dbIndex))
+		data := reply.NewMultiBulkReply(args).ToBytes() //得到写入文件的字节
+		if err := handler.writeLocked(data); err != nil {
+			return err
+		}
+		handler.currentDB = p.dbIndex
+	}
+	return handler.writeLocked(p.data)
+}
+
+// writeLocked 写入当前的增量文件。调用者需要持有mu
+func (handler *AofHandler) writeLocked(data []byte) error {
+	n, err := handler.aofWriter.Write(data)
+	handler.aofSize.Add(int64(n))
+	if n > 0 {
+		handler.pendingFsync.Store(true)
+	}
+	return err
+}
+
+// openIncrFile 打开清单中最后一个增量文件用于追加，没有增量文件时创建一个
+func (handler *AofHandler) openIncrFile() (*os.File, error) {
+	if n := len(handler.manifest.incrs); n > 0 {
+		path := handler.filePath(handler.manifest.incrs[n-1].name)
+		return os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	}
+	file, next, err := handler.createIncrFile(handler.manifest)
+	if err != nil {
+		return nil, err
+	}
+	handler.manifest = next
+	return file, nil
+}
+
+// LoadAof 启动时按照清单的顺序加载基础文件和增量文件。最后一个文件只是最后一条命令或最后一个事务不完整时，
+// 开启aof-load-truncated则截断文件后继续启动，否则返回错误，拒绝启动
+func (handler *AofHandler) LoadAof() error {
+	files := handler.manifest.files()
+	if len(files) == 0 {
+		return nil
+	}
+	start := time.Now()
+	for i, info := range files {
+		path := handler.filePath(info.name)
+		err := loadFile(path, handler.database)
+		if err == nil {
 			continue
 		}
-		if p.Data == nil {
-			logger.Error("AOF: empty payload")
+		var loadErr *loadError
+		if !errors.As(err, &loadErr) || !errors.Is(loadErr.err, io.ErrUnexpectedEOF) {
+			return err
 		}
-		multiBulkReply, ok := p.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("AOF: exec error: ", p.Data)
-			continue
+		if i != len(files)-1 {
+			return errors.New(err.Error() + ", and it is not the last file. " +
+				"Make a backup of your AOF files, then use ./goredis-check-aof --fix <manifest>")
+		}
+		if !config.Properties.AofLoadTruncated {
+			return errors.New(err.Error() + ". You can: 1) set aof-load-truncated yes; " +
+				"2) make a backup of your AOF file, then use ./goredis-check-aof --fix <filename>")
+		}
+		if errors.Is(loadErr.err, ErrMultiWithoutExec) {
+			logger.Warn("Revert incomplete MULTI/EXEC transaction in AOF file " + path)
+		}
+		logger.Warn("!!! Warning: short read while loading the AOF file " + path + "!!! " +
+			"AOF loaded anyway because aof-load-truncated is enabled, truncating it to offset " +
+			strconv.FormatInt(loadErr.offset, 10))
+		if err := os.Truncate(path, loadErr.offset); err != nil {
+			return err
+		}
+	}
+	logger.Info("AOF: DB loaded from append only files in " + time.Since(start).String())
+	return nil
+}
+
+// loadError 加载AOF文件时遇到的格式错误
+type loadError struct {
+	path   string
+	offset int64 // 最后一条完整命令的结束位置
+	err    error
+}
+
+func (e *loadError) Error() string {
+	if errors.Is(e.err, io.ErrUnexpectedEOF) {
+		return "unexpected end of file reading the append only file " + e.path + " at offset " + strconv.FormatInt(e.offset, 10)
+	}
+	return "bad file format reading the append only file " + e.path + " at offset " + strconv.FormatInt(e.offset, 10) +
+		": " + e.err.Error() + ". Make a backup of your AOF file, then use ./goredis-check-aof --fix <filename>"
+}
+
+// loadFile 加载一个AOF文件，每个文件都从0号库开始
+func loadFile(path string, db database.DBEngine) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if offset, err := loadAof(file, db); err != nil {
+		return &loadError{path: path, offset: offset, err: err}
+	}
+	return nil
+}
+
+// loadAof 从reader中读取AOF并在db中执行，AOF开头可以是快照格式的数据。
+// 返回最后一条完整命令的结束位置，文件完整时返回nil。文件在事务中结束时事务中的命令不会执行，返回MULTI的开始位置
+func loadAof(reader io.Reader, db database.DBEngine) (int64, error) {
+	cmdReader := newCommandReader(reader)
+	if _, err := cmdReader.readPreamble(db.LoadEntity); err != nil {
+		return 0, err
+	}
+	tempConnection := &connection.RESPConn{}
+	for {
+		validSize := cmdReader.validOffset()
+		cmdLine, err := cmdReader.next()
+		if err == io.EOF {
+			return validSize, nil
+		}
+		if err != nil {
+			return validSize, err
 		}
-		r := handler.database.Exec(tempConnection, multiBulkReply.Args) //执行命令
+		r := db.Exec(tempConnection, cmdLine) //执行命令
 		if reply.IsErrReply(r) {
-			logger.Error("AOF: exec error: ", r.ToBytes())
-			continue
+			logger.Error("AOF: exec error: ", string(r.ToBytes()))
+		}
+	}
+}
+
+// BGRewrite 在后台重写AOF文件，已经有重写在进行时返回错误
+func (handler *AofHandler) BGRewrite() error {
+	if !handler.rewriting.CompareAndSwap(false, true) {
+		return ErrRewriteInProgress
+	}
+	go func() {
+		defer handler.rewriting.Store(false)
+		if err := handler.doRewrite(); err != nil {
+			logger.Error("background AOF rewrite failed: " + err.Error())
+			return
+		}
+		logger.Info("background AOF rewrite finished successfully")
+	}()
+	return nil
+}
+
+// Size 返回当前AOF文件的大小和启动或上一次重写后的大小
+func (handler *AofHandler) Size() (current int64, base int64) {
+	return handler.aofSize.Load(), handler.baseSize.Load()
+}
+
+// IsRewriting 判断是否有重写正在进行
+func (handler *AofHandler) IsRewriting() bool {
+	return handler.rewriting.Load()
+}
+
+// NeedRewrite 判断AOF文件是否满足自动重写条件：文件大小不小于auto-aof-rewrite-min-size，
+// 且相对上一次重写后的大小增长了auto-aof-rewrite-percentage
+func (handler *AofHandler) NeedRewrite() bool {
+	percentage := AutoRewritePercentage()
+	if percentage <= 0 || handler.rewriting.Load() {
+		return false
+	}
+	size := handler.aofSize.Load()
+	if size < AutoRewriteMinSize() {
+		return false
+	}
+	base := handler.baseSize.Load()
+	if base <= 0 {
+		base = 1
+	}
+	return (size-base)*100/base >= int64(percentage)
+}
+
+// doRewrite 重写AOF：先切换到新的增量文件，之后的命令都写入新文件；再将切换前的基础文件和增量文件加载到临时数据库中，
+// 生成新的基础文件；最后保存只包含新基础文件和切换后的增量文件的清单，并删除旧的文件。
+// 切换前的文件不会再被修改，重写不需要复制正在写入的文件，也不需要缓冲重写期间的命令
+func (handler *AofHandler) doRewrite() error {
+	old, err := handler.rotateIncrFile()
+	if err != nil {
+		return err
+	}
+	base, err := handler.writeBaseFile(old)
+	if err != nil {
+		return err
+	}
+	if err := handler.finishRewrite(old, base); err != nil {
+		_ = os.Remove(handler.filePath(base.name))
+		return err
+	}
+	return nil
+}
+
+// rotateIncrFile 创建新的增量文件，之后的命令写入新文件，返回切换前的清单
+func (handler *AofHandler) rotateIncrFile() (*manifest, error) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.aofFile == nil {
+		return nil, errHandlerClosed
+	}
+	if err := handler.fsyncLocked(); err != nil { // 旧文件在重写完成后会被删除，切换前需要完整地写入磁盘
+		return nil, err
+	}
+	file, next, err := handler.createIncrFile(handler.manifest)
+	if err != nil {
+		return nil, err
+	}
+	_ = handler.aofFile.Close()
+	handler.aofFile = file
+	handler.aofWriter.Reset(file)
+	handler.currentDB = 0 // 每个文件单独加载，从0号库开始
+	old := handler.manifest
+	handler.manifest = next
+	return old, nil
+}
+
+// createIncrFile 创建下一个增量文件，并保存加入了该文件的清单
+func (handler *AofHandler) createIncrFile(m *manifest) (*os.File, *manifest, error) {
+	next := m.copy()
+	next.incrSeq++
+	info := &aofInfo{name: handler.incrName(next.incrSeq), seq: next.incrSeq, fileType: incrFileType}
+	path := handler.filePath(info.name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	next.incrs = append(next.incrs, info)
+	if err := handler.persistManifest(next); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return nil, nil, err
+	}
+	return file, next, nil
+}
+
+// writeBaseFile 将清单m中的文件加载到临时数据库中，按照临时数据库的数据生成新的基础文件
+func (handler *AofHandler) writeBaseFile(m *manifest) (*aofInfo, error) {
+	tmpDB := handler.tmpDBMaker() // 临时数据库不需要关闭，关闭时会生成快照
+	for _, info := range m.files() {
+		if err := loadFile(handler.filePath(info.name), tmpDB); err != nil {
+			return nil, err
+		}
+	}
+	rdbFormat := UseRdbPreamble()
+	base := &aofInfo{name: handler.baseName(m.baseSeq+1, rdbFormat), seq: m.baseSeq + 1, fileType: baseFileType}
+	file, err := os.CreateTemp(handler.aofDirname, tempPrefix+"rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := file.Name()
+	writer := bufio.NewWriter(file)
+	if rdbFormat {
+		err = rdb.Write(writer, tmpDB)
+	} else {
+		err = writeCommands(writer, tmpDB)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, handler.filePath(base.name))
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return nil, err
+	}
+	return base, nil
+}
+
+// finishRewrite 保存以新基础文件开始的清单，删除重写前的基础文件和增量文件
+func (handler *AofHandler) finishRewrite(old *manifest, base *aofInfo) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	next := handler.manifest.copy()
+	next.base = base
+	next.baseSeq = base.seq
+	next.incrs = next.incrs[:0]
+	for _, info := range handler.manifest.incrs {
+		if info.seq > old.incrSeq { // 重写开始之后创建的增量文件
+			next.incrs = append(next.incrs, info)
+		}
+	}
+	if err := handler.persistManifest(next); err != nil {
+		return err
+	}
+	handler.manifest = next
+	for _, info := range old.files() {
+		if err := os.Remove(handler.filePath(info.name)); err != nil {
+			logger.Error("AOF: remove history file failed: " + err.Error())
+		}
+	}
+	syncDir(handler.aofDirname)
+	if handler.aofFile != nil {
+		_ = handler.flushLocked()
+	}
+	size := handler.totalSize(next)
+	handler.aofSize.Store(size)
+	handler.baseSize.Store(size)
+	return nil
+}
+
+// totalSize 返回清单中所有文件的大小之和
+func (handler *AofHandler) totalSize(m *manifest) int64 {
+	var size int64
+	for _, info := range m.files() {
+		if stat, err := os.Stat(handler.filePath(info.name)); err == nil {
+			size += stat.Size()
 		}
 	}
+	return size
 }
@@ -0,0 +1,97 @@
+package aof
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AOF文件的同步策略
+const (
+	FsyncAlways   = "always"   // 每次写入后都同步，同步完成后才回复客户端
+	FsyncEverySec = "everysec" // 每秒在后台同步一次，宕机时最多丢失1秒的数据
+	FsyncNo       = "no"       // 不主动同步，由操作系统决定何时写入磁盘
+)
+
+const fsyncInterval = time.Second // everysec策略的同步间隔
+
+var fsyncPolicy atomic.Pointer[string] // 当前生效的同步策略
+
+// CheckFsyncPolicy 校验appendfsync配置，返回规范化后的策略，空字符串表示默认的everysec
+func CheckFsyncPolicy(s string) (string, bool) {
+	s = strings.ToLower(s)
+	switch s {
+	case "":
+		return FsyncEverySec, true
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return s, true
+	}
+	return "", false
+}
+
+// SetFsyncPolicy 修改同步策略，返回规范化后的策略
+func SetFsyncPolicy(s string) (string, bool) {
+	policy, ok := CheckFsyncPolicy(s)
+	if !ok {
+		return "", false
+	}
+	fsyncPolicy.Store(&policy)
+	return policy, true
+}
+
+// FsyncPolicy 返回当前的同步策略，没有设置时为everysec
+func FsyncPolicy() string {
+	if policy := fsyncPolicy.Load(); policy != nil {
+		return *policy
+	}
+	return FsyncEverySec
+}
+
+// fsyncLocked 将已经写入的数据同步到磁盘，没有未同步的数据时不做任何操作。调用者需要持有mu
+func (handler *AofHandler) fsyncLocked() error {
+	if !handler.pendingFsync.Load() {
+		return nil
+	}
+	if err := handler.flushLocked(); err != nil {
+		return err
+	}
+	if err := handler.aofFile.Sync(); err != nil {
+		return err
+	}
+	handler.pendingFsync.Store(false)
+	handler.lastFsync.Store(time.Now().Unix())
+	return nil
+}
+
+// startFsyncCron 启动后台任务，everysec策略下每秒同步一次。写入失败时每秒重试一次，直到写入恢复正常
+func (handler *AofHandler) startFsyncCron() {
+	ticker := time.NewTicker(fsyncInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if handler.WriteErr() != nil {
+					handler.retryWrite()
+					continue
+				}
+				if FsyncPolicy() != FsyncEverySec {
+					continue
+				}
+				handler.mu.Lock()
+				if err := handler.fsyncLocked(); err != nil {
+					handler.setWriteErr(errors.New("fsync failed: " + err.Error()))
+				}
+				handler.mu.Unlock()
+			case <-handler.closeChan:
+				return
+			}
+		}
+	}()
+}
+
+// LastFsync 返回最近一次同步的unix时间戳(秒)，以及是否有已经写入但还没有同步的数据
+func (handler *AofHandler) LastFsync() (lastFsync int64, pending bool) {
+	return handler.lastFsync.Load(), handler.pendingFsync.Load()
+}
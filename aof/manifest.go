@@ -0,0 +1,265 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"goRedis/lib/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AOF文件的类型
+const (
+	baseFileType = "b" // 基础文件，由重写生成，可以是AOF格式或快照格式
+	incrFileType = "i" // 增量文件，记录基础文件之后的写命令
+)
+
+const (
+	baseAofSuffix = ".base.aof"
+	baseRdbSuffix = ".base.rdb"
+	incrAofSuffix = ".incr.aof"
+	manifestExt   = ".manifest"
+	tempPrefix    = "temp-"
+)
+
+// aofInfo 清单中的一个文件
+type aofInfo struct {
+	name     string // 文件名，不包含目录
+	seq      int64
+	fileType string
+}
+
+// manifest 记录AOF目录中的基础文件和增量文件，加载时先加载基础文件，再按照序号加载增量文件。
+// 每一行的格式为"file <文件名> seq <序号> type <类型>"
+type manifest struct {
+	base    *aofInfo   // 基础文件，nil表示还没有重写过
+	incrs   []*aofInfo // 增量文件，按照序号排序
+	baseSeq int64      // 最近一个基础文件的序号
+	incrSeq int64      // 最近一个增量文件的序号
+}
+
+// parseManifest 解析清单，忽略不认识的字段和类型
+func parseManifest(r io.Reader) (*manifest, error) {
+	m := &manifest{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, errors.New("invalid AOF manifest at line " + strconv.Itoa(lineNo))
+		}
+		info := &aofInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.name = fields[i+1]
+			case "seq":
+				seq, err := strconv.ParseInt(fields[i+1], 10, 64)
+				if err != nil || seq < 1 {
+					return nil, errors.New("invalid AOF file seq at line " + strconv.Itoa(lineNo))
+				}
+				info.seq = seq
+			case "type":
+				info.fileType = fields[i+1]
+			}
+		}
+		if info.name == "" || info.seq == 0 || info.name != filepath.Base(info.name) {
+			return nil, errors.New("invalid AOF manifest at line " + strconv.Itoa(lineNo))
+		}
+		switch info.fileType {
+		case baseFileType:
+			if m.base != nil {
+				return nil, errors.New("found duplicate base file in AOF manifest")
+			}
+			m.base = info
+			m.baseSeq = info.seq
+		case incrFileType:
+			if info.seq <= m.incrSeq {
+				return nil, errors.New("found a non-monotonic sequence number in AOF manifest")
+			}
+			m.incrs = append(m.incrs, info)
+			m.incrSeq = info.seq
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *manifest) String() string {
+	var sb strings.Builder
+	for _, info := range m.files() {
+		sb.WriteString("file " + info.name + " seq " + strconv.FormatInt(info.seq, 10) + " type " + info.fileType + "\n")
+	}
+	return sb.String()
+}
+
+// files 按照加载顺序返回清单中的文件
+func (m *manifest) files() []*aofInfo {
+	files := make([]*aofInfo, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *manifest) copy() *manifest {
+	c := *m
+	c.incrs = append([]*aofInfo(nil), m.incrs...)
+	return &c
+}
+
+// ManifestFiles 按照加载顺序返回清单中的文件路径
+func ManifestFiles(manifestPath string) ([]string, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m, err := parseManifest(file)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(manifestPath)
+	var paths []string
+	for _, info := range m.files() {
+		paths = append(paths, filepath.Join(dir, info.name))
+	}
+	return paths, nil
+}
+
+func (handler *AofHandler) filePath(name string) string {
+	return filepath.Join(handler.aofDirname, name)
+}
+
+func (handler *AofHandler) manifestName() string {
+	return handler.aofFileName + manifestExt
+}
+
+func (handler *AofHandler) baseName(seq int64, rdbFormat bool) string {
+	if rdbFormat {
+		return handler.aofFileName + "." + strconv.FormatInt(seq, 10) + baseRdbSuffix
+	}
+	return handler.aofFileName + "." + strconv.FormatInt(seq, 10) + baseAofSuffix
+}
+
+func (handler *AofHandler) incrName(seq int64) string {
+	return handler.aofFileName + "." + strconv.FormatInt(seq, 10) + incrAofSuffix
+}
+
+// loadManifest 读取清单。清单不存在但工作目录中有旧版本的单个AOF文件时，将其作为基础文件
+func (handler *AofHandler) loadManifest() (*manifest, error) {
+	file, err := os.Open(handler.filePath(handler.manifestName()))
+	if err == nil {
+		defer file.Close()
+		return parseManifest(file)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	m := &manifest{}
+	if _, err := os.Stat(handler.aofFileName); err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	return m, handler.upgradeFromSingleFile(m)
+}
+
+// upgradeFromSingleFile 将旧版本的单个AOF文件移动到AOF目录中作为基础文件。先创建硬链接并保存清单，
+// 再删除旧文件，任何一步失败时旧文件都保持不变
+func (handler *AofHandler) upgradeFromSingleFile(m *manifest) error {
+	base := &aofInfo{name: handler.baseName(1, false), seq: 1, fileType: baseFileType}
+	basePath := handler.filePath(base.name)
+	_ = os.Remove(basePath) // 上一次升级中途失败留下的文件
+	if err := os.Link(handler.aofFileName, basePath); err != nil {
+		return err
+	}
+	m.base = base
+	m.baseSeq = base.seq
+	if err := handler.persistManifest(m); err != nil {
+		_ = os.Remove(basePath)
+		return err
+	}
+	logger.Info("AOF: moved " + handler.aofFileName + " into " + handler.aofDirname + " as the base file")
+	return os.Remove(handler.aofFileName)
+}
+
+// persistManifest 先写入临时文件再替换清单，保证清单总是完整的
+func (handler *AofHandler) persistManifest(m *manifest) error {
+	file, err := os.CreateTemp(handler.aofDirname, tempPrefix+"*"+manifestExt)
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	_, err = file.WriteString(m.String())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, handler.filePath(handler.manifestName()))
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	syncDir(handler.aofDirname)
+	return nil
+}
+
+// syncDir 同步目录，保证文件的创建和重命名写入磁盘
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// removeUnusedFiles 删除AOF目录中不在清单中的AOF文件和临时文件，如重写失败或删除旧文件之前宕机留下的文件
+func (handler *AofHandler) removeUnusedFiles(m *manifest) {
+	entries, err := os.ReadDir(handler.aofDirname)
+	if err != nil {
+		logger.Error("AOF: read dir failed: " + err.Error())
+		return
+	}
+	used := make(map[string]bool)
+	for _, info := range m.files() {
+		used[info.name] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || used[name] || !handler.isAofFile(name) {
+			continue
+		}
+		if err := os.Remove(handler.filePath(name)); err != nil {
+			logger.Error("AOF: remove unused file failed: " + err.Error())
+			continue
+		}
+		logger.Info("AOF: removed unused file " + name)
+	}
+}
+
+// isAofFile 判断文件名是否是由AofHandler创建的基础文件、增量文件或临时文件
+func (handler *AofHandler) isAofFile(name string) bool {
+	if strings.HasPrefix(name, tempPrefix) {
+		return true
+	}
+	if !strings.HasPrefix(name, handler.aofFileName+".") {
+		return false
+	}
+	return strings.HasSuffix(name, baseAofSuffix) || strings.HasSuffix(name, baseRdbSuffix) ||
+		strings.HasSuffix(name, incrAofSuffix)
+}
@@ -0,0 +1,152 @@
+package aof
+
+import (
+	"goRedis/interface/database"
+	"goRedis/interface/meta/dict"
+	"goRedis/lib/utils"
+	"goRedis/meta/list"
+	"goRedis/meta/set"
+	"goRedis/meta/sortedset"
+	"goRedis/meta/stream"
+	"goRedis/resp/reply"
+	"io"
+	"strconv"
+	"time"
+)
+
+const itemsPerCmd = 64 // 重写时一条命令最多包含的元素个数，避免大key生成过长的命令
+
+// writeCommands 将db中的所有键值对以命令的形式写入w
+func writeCommands(w io.Writer, db database.DBEngine) error {
+	currentDB := -1
+	var err error
+	write := func(cmd database.CmdLine) bool {
+		_, err = w.Write(reply.NewMultiBulkReply(cmd).ToBytes())
+		return err == nil
+	}
+	db.ForEach(func(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) bool {
+		if dbIndex != currentDB {
+			if !write(utils.ToCmdLine("select", strconv.Itoa(dbIndex))) {
+				return false
+			}
+			currentDB = dbIndex
+		}
+		for _, cmd := range entityToCmds(key, entity) {
+			if !write(cmd) {
+				return false
+			}
+		}
+		if expiration != nil {
+			return write(utils.ToCmdLine("pexpireat", key, strconv.FormatInt(expiration.UnixMilli(), 10)))
+		}
+		return true
+	})
+	return err
+}
+
+// entityToCmds 生成重建键值对的命令
+func entityToCmds(key string, entity *database.DataEntity) []database.CmdLine {
+	switch data := entity.Data.(type) {
+	case []byte:
+		return []database.CmdLine{utils.ToCmdLine3("set", []byte(key), data)}
+	case *list.QuickList:
+		return listToCmds(key, data)
+	case *set.Set:
+		return setToCmds(key, data)
+	case *sortedset.SortedSet:
+		return zsetToCmds(key, data)
+	case dict.Dict:
+		return hashToCmds(key, data)
+	case *stream.Stream:
+		return streamToCmds(key, data)
+	}
+	return nil
+}
+
+// chunkCmds 将元素按itemsPerCmd分组，每组生成一条"cmdName key 元素..."命令，每个元素可以包含多个参数
+func chunkCmds(cmdName string, key string, items [][][]byte) []database.CmdLine {
+	cmds := make([]database.CmdLine, 0, (len(items)+itemsPerCmd-1)/itemsPerCmd)
+	for start := 0; start < len(items); start += itemsPerCmd {
+		end := min(start+itemsPerCmd, len(items))
+		cmd := utils.ToCmdLine(cmdName, key)
+		for _, item := range items[start:end] {
+			cmd = append(cmd, item...)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+func listToCmds(key string, data *list.QuickList) []database.CmdLine {
+	items := make([][][]byte, 0, data.Len())
+	data.ForEach(func(i int, v any) bool {
+		items = append(items, [][]byte{v.([]byte)})
+		return true
+	})
+	return chunkCmds("rpush", key, items)
+}
+
+func setToCmds(key string, data *set.Set) []database.CmdLine {
+	members := data.ToSlice()
+	items := make([][][]byte, 0, len(members))
+	for _, member := range members {
+		items = append(items, [][]byte{[]byte(member)})
+	}
+	return chunkCmds("sadd", key, items)
+}
+
+func zsetToCmds(key string, data *sortedset.SortedSet) []database.CmdLine {
+	elements := data.RangeByRank(0, data.Len(), false)
+	items := make([][][]byte, 0, len(elements))
+	for _, element := range elements {
+		items = append(items, [][]byte{[]byte(utils.FormatFloat(element.Score)), []byte(element.Member)})
+	}
+	return chunkCmds("zadd", key, items)
+}
+
+func hashToCmds(key string, data dict.Dict) []database.CmdLine {
+	items := make([][][]byte, 0, data.Len())
+	data.ForEach(func(field string, val any) bool {
+		items = append(items, [][]byte{[]byte(field), val.([]byte)})
+		return true
+	})
+	return chunkCmds("hset", key, items)
+}
+
+// streamToCmds 生成重建流的命令：XADD添加消息，XSETID恢复元信息，XGROUP和XCLAIM恢复消费者组。
+// 已经被删除的消息的待确认记录无法通过XCLAIM恢复，重写后会丢失
+func streamToCmds(key string, s *stream.Stream) []database.CmdLine {
+	var cmds []database.CmdLine
+	entries := s.Range(stream.MinID, stream.MaxID, 0, false)
+	for _, entry := range entries {
+		cmd := utils.ToCmdLine("xadd", key, entry.ID.String())
+		cmds = append(cmds, append(cmd, entry.Fields...))
+	}
+	if len(entries) == 0 { // 空的流：添加一条消息后立即删除，ID不能为0-0，之后由XSETID恢复最后的ID
+		id := s.LastID()
+		if id.IsZero() {
+			id = stream.ID{Seq: 1}
+		}
+		cmds = append(cmds, utils.ToCmdLine("xadd", key, "maxlen", "0", id.String(), "x", "y"))
+	}
+	cmds = append(cmds, utils.ToCmdLine("xsetid", key, s.LastID().String(),
+		"entriesadded", strconv.FormatInt(s.EntriesAdded(), 10),
+		"maxdeletedid", s.MaxDeletedID().String()))
+	for _, group := range s.Groups() {
+		cmds = append(cmds, utils.ToCmdLine("xgroup", "create", key, group.Name, group.LastID.String(),
+			"entriesread", strconv.FormatInt(group.EntriesRead, 10)))
+		for _, consumer := range group.Consumers() {
+			cmds = append(cmds, utils.ToCmdLine("xgroup", "createconsumer", key, group.Name, consumer.Name))
+			for _, id := range consumer.PendingIDs() {
+				if s.Get(id) == nil {
+					continue
+				}
+				pending := group.GetPending(id)
+				cmds = append(cmds, utils.ToCmdLine("xclaim", key, group.Name, consumer.Name, "0", id.String(),
+					"time", strconv.FormatInt(pending.DeliveryTime.UnixMilli(), 10),
+					"retrycount", strconv.FormatInt(pending.DeliveryCount, 10), "force", "justid"))
+			}
+		}
+	}
+	return cmds
+}
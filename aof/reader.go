@@ -0,0 +1,245 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"goRedis/interface/database"
+	"goRedis/rdb"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxBulkLen  = 512 << 20 // 单个参数的最大长度
+	maxPrealloc = 1 << 20   // 读取参数时预先分配内存的上限
+)
+
+var (
+	// ErrInvalidFormat AOF文件中出现了不是命令的内容
+	ErrInvalidFormat = errors.New("invalid AOF format")
+	// ErrMultiWithoutExec 文件在MULTI之后、EXEC之前结束，事务不完整，可以截断到MULTI之前
+	ErrMultiWithoutExec = fmt.Errorf("%w before EXEC of MULTI", io.ErrUnexpectedEOF)
+
+	errUnexpectedMulti = errors.New("unexpected MULTI")
+	errUnexpectedExec  = errors.New("unexpected EXEC")
+)
+
+// countingReader 记录从底层reader读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// commandReader 严格按照AOF格式逐条读取命令，并记录已经读取的完整命令的结束位置，
+// 用于在文件损坏时定位第一个错误的命令。事务中的命令只有读到EXEC后才算完整
+type commandReader struct {
+	counter    *countingReader
+	br         *bufio.Reader
+	multiStart int64 // 没有匹配EXEC的MULTI的开始位置，-1表示不在事务中
+}
+
+func newCommandReader(r io.Reader) *commandReader {
+	counter := &countingReader{r: r}
+	return &commandReader{
+		counter:    counter,
+		br:         bufio.NewReader(counter),
+		multiStart: -1,
+	}
+}
+
+// validOffset 返回文件损坏时可以截断到的位置：不在事务中时为已经读取的完整命令的结束位置，
+// 否则为MULTI的开始位置，截断后不会留下不完整的事务
+func (cr *commandReader) validOffset() int64 {
+	if cr.multiStart >= 0 {
+		return cr.multiStart
+	}
+	return cr.offset()
+}
+
+// offset 返回已经处理的字节数，不包含已经读入缓冲区但还没有处理的数据
+func (cr *commandReader) offset() int64 {
+	return cr.counter.n - int64(cr.br.Buffered())
+}
+
+// readPreamble 文件以快照开头时解码快照，返回是否有快照前缀
+func (cr *commandReader) readPreamble(consumer rdb.Consumer) (bool, error) {
+	header, _ := cr.br.Peek(rdb.HeaderSize)
+	if !rdb.IsRDB(header) {
+		return false, nil
+	}
+	if err := rdb.NewDecoder(cr.br).Parse(consumer); err != nil {
+		return true, errors.New("bad RDB preamble: " + err.Error())
+	}
+	return true, nil
+}
+
+// next 读取下一条命令。文件在命令之间结束时返回io.EOF，在命令中间结束时返回io.ErrUnexpectedEOF，
+// 在MULTI之后、EXEC之前结束时返回ErrMultiWithoutExec，内容不符合格式时返回ErrInvalidFormat
+func (cr *commandReader) next() (database.CmdLine, error) {
+	start := cr.offset()
+	cmdLine, err := cr.readCommand()
+	if err != nil {
+		if cr.multiStart >= 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			return nil, ErrMultiWithoutExec
+		}
+		return nil, err
+	}
+	switch {
+	case strings.EqualFold(string(cmdLine[0]), "multi"):
+		if cr.multiStart >= 0 {
+			return nil, errUnexpectedMulti
+		}
+		cr.multiStart = start
+	case strings.EqualFold(string(cmdLine[0]), "exec"):
+		if cr.multiStart < 0 {
+			return nil, errUnexpectedExec
+		}
+		cr.multiStart = -1
+	}
+	return cmdLine, nil
+}
+
+// readCommand 读取一条命令，不检查事务是否完整
+func (cr *commandReader) readCommand() (database.CmdLine, error) {
+	line, err := cr.readLine()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	count, err := parseLength(line, '*')
+	if err != nil || count == 0 {
+		return nil, ErrInvalidFormat
+	}
+	args := make(database.CmdLine, 0, min(count, maxPrealloc))
+	for i := int64(0); i < count; i++ {
+		line, err := cr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		size, err := parseLength(line, '$')
+		if err != nil || size > maxBulkLen {
+			return nil, ErrInvalidFormat
+		}
+		arg, err := cr.readBulk(size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readLine 读取以\r\n结尾的一行，返回的内容不包含\r\n
+func (cr *commandReader) readLine() ([]byte, error) {
+	line, err := cr.br.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			return line, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrInvalidFormat
+	}
+	return line[:len(line)-2], nil
+}
+
+// readBulk 读取size字节的参数和之后的\r\n
+func (cr *commandReader) readBulk(size int64) ([]byte, error) {
+	var arg []byte
+	if size > maxPrealloc { // 长度可能因为文件损坏而异常大，边读边分配内存
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, cr.br, size); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		arg = buf.Bytes()
+	} else {
+		arg = make([]byte, size)
+		if _, err := io.ReadFull(cr.br, arg); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	var crlf [2]byte
+	if _, err := io.ReadFull(cr.br, crlf[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return nil, ErrInvalidFormat
+	}
+	return arg, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// parseLength 解析"*数字"或"$数字"
+func parseLength(line []byte, prefix byte) (int64, error) {
+	if len(line) < 2 || line[0] != prefix {
+		return 0, ErrInvalidFormat
+	}
+	n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil || n < 0 {
+		return 0, ErrInvalidFormat
+	}
+	return n, nil
+}
+
+// CheckResult AOF文件的检查结果
+type CheckResult struct {
+	Size        int64 // 文件大小
+	ValidSize   int64 // 最后一条完整命令的结束位置，之后的内容是损坏的。损坏的命令在事务中时为MULTI的开始位置
+	Commands    int   // 完整命令的个数
+	HasPreamble bool  // 是否以快照开头
+	Err         error // 第一个错误，nil表示文件完整
+}
+
+// Truncated 判断文件是否只是最后一条命令或最后一个事务不完整
+func (result *CheckResult) Truncated() bool {
+	return errors.Is(result.Err, io.ErrUnexpectedEOF)
+}
+
+// CheckFile 检查AOF文件的格式，找出第一条损坏的命令的位置，不执行其中的命令
+func CheckFile(filename string) (*CheckResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Size: info.Size()}
+	reader := newCommandReader(file)
+	result.HasPreamble, result.Err = reader.readPreamble(func(int, string, *database.DataEntity, *time.Time) bool {
+		return true
+	})
+	for result.Err == nil {
+		result.ValidSize = reader.validOffset()
+		if _, err := reader.next(); err != nil {
+			if err != io.EOF {
+				result.Err = err
+			}
+			break
+		}
+		result.Commands++
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package aof
+
+import (
+	"errors"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/resp/reply"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingEngine 记录加载AOF时执行的命令
+type recordingEngine struct {
+	cmds []string
+}
+
+func (e *recordingEngine) Exec(client resp.Connection, args [][]byte) resp.Reply {
+	e.cmds = append(e.cmds, strings.ToLower(string(args[0])))
+	return reply.NewOkReply()
+}
+
+func (e *recordingEngine) Close() error {
+	return nil
+}
+
+func (e *recordingEngine) AfterClientClose(client resp.Connection) error {
+	return nil
+}
+
+func (e *recordingEngine) ForEach(consumer database.DataConsumer) {}
+
+func (e *recordingEngine) LoadEntity(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) bool {
+	return true
+}
+
+func toAof(cmd ...string) string {
+	return string(reply.NewMultiBulkReply(utils.ToCmdLine(cmd...)).ToBytes())
+}
+
+func TestLoadAndCheckFile(t *testing.T) {
+	set := toAof("set", "k", "v")
+	multi, exec := toAof("multi"), toAof("exec")
+	tests := []struct {
+		name      string
+		content   string
+		err       error // 加载和检查返回的错误，nil表示文件完整
+		truncated bool
+		validSize int
+		cmds      string // 加载时执行的命令
+	}{
+		{
+			name:      "complete",
+			content:   set + multi + set + exec,
+			validSize: len(set + multi + set + exec),
+			cmds:      "set multi set exec",
+		},
+		{
+			name:      "truncated command",
+			content:   set + set[:len(set)-3],
+			err:       io.ErrUnexpectedEOF,
+			truncated: true,
+			validSize: len(set),
+			cmds:      "set",
+		},
+		{
+			name:      "truncated line",
+			content:   set + "*3\r\n$3",
+			err:       io.ErrUnexpectedEOF,
+			truncated: true,
+			validSize: len(set),
+			cmds:      "set",
+		},
+		{
+			name:      "multi without exec",
+			content:   set + multi + set,
+			err:       ErrMultiWithoutExec,
+			truncated: true,
+			validSize: len(set),
+			cmds:      "set multi set",
+		},
+		{
+			name:      "truncated in multi",
+			content:   set + multi + set + set[:5],
+			err:       ErrMultiWithoutExec,
+			truncated: true,
+			validSize: len(set),
+			cmds:      "set multi set",
+		},
+		{
+			name:      "nested multi",
+			content:   set + multi + set + multi + set + exec + exec,
+			err:       errUnexpectedMulti,
+			validSize: len(set),
+			cmds:      "set multi set",
+		},
+		{
+			name:      "exec without multi",
+			content:   set + exec,
+			err:       errUnexpectedExec,
+			validSize: len(set),
+			cmds:      "set",
+		},
+		{
+			name:      "invalid format",
+			content:   set + "set k v\r\n",
+			err:       ErrInvalidFormat,
+			validSize: len(set),
+			cmds:      "set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "appendonly.aof")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := CheckFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(result.Err, tt.err) || (tt.err == nil && result.Err != nil) {
+				t.Errorf("check: got error %v, want %v", result.Err, tt.err)
+			}
+			if result.Truncated() != tt.truncated {
+				t.Errorf("check: got truncated %v, want %v", result.Truncated(), tt.truncated)
+			}
+			if result.ValidSize != int64(tt.validSize) {
+				t.Errorf("check: got valid size %d, want %d", result.ValidSize, tt.validSize)
+			}
+
+			engine := &recordingEngine{}
+			err = loadFile(path, engine)
+			var loadErr *loadError
+			switch {
+			case tt.err == nil:
+				if err != nil {
+					t.Errorf("load: unexpected error %v", err)
+				}
+			case !errors.As(err, &loadErr):
+				t.Errorf("load: got error %v, want %v", err, tt.err)
+			default:
+				if !errors.Is(loadErr.err, tt.err) {
+					t.Errorf("load: got error %v, want %v", loadErr.err, tt.err)
+				}
+				if loadErr.offset != int64(tt.validSize) {
+					t.Errorf("load: got offset %d, want %d", loadErr.offset, tt.validSize)
+				}
+			}
+			if got := strings.Join(engine.cmds, " "); got != tt.cmds {
+				t.Errorf("load: executed %q, want %q", got, tt.cmds)
+			}
+		})
+	}
+}
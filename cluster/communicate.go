@@ -56,6 +56,22 @@ func (cluster *ClusterDatabase) relay(peer string, c resp.Connection, args [][]b
 	return peerClient.Send(args)
 }
 
+// 转发阻塞命令，转发到其他节点时一直等待对方回复，对方在命令超时后会回复
+func (cluster *ClusterDatabase) relayBlocking(peer string, c resp.Connection, args [][]byte) resp.Reply {
+	if peer == cluster.self {
+		return cluster.db.Exec(c, args)
+	}
+	peerClient, err := cluster.getPeerClient(peer)
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	defer func() {
+		_ = cluster.returnPeerClient(peer, peerClient)
+	}()
+	peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
+	return peerClient.SendBlocking(args)
+}
+
 // 群发广播
 func (cluster *ClusterDatabase) broadcast(c resp.Connection, args [][]byte) map[string]resp.Reply {
 	results := make(map[string]resp.Reply)
@@ -2,27 +2,163 @@ package cluster
 
 import (
 	"fmt"
+	"goRedis/database"
 	"goRedis/interface/resp"
 	"goRedis/lib/logger"
 	"goRedis/resp/reply"
+	"strings"
 )
 
 func makeRouter() map[string]CmdFunc {
 	return map[string]CmdFunc{
-		"ping":    local,
-		"hello":   local,
-		"exists":  defaultFunc,
-		"type":    defaultFunc,
-		"set":     defaultFunc,
-		"setnx":   defaultFunc,
-		"get":     defaultFunc,
-		"getset":  defaultFunc,
+		"ping":   local,
+		"hello":  local,
+		"exists": defaultFunc,
+		"type":   defaultFunc,
+		"set":    defaultFunc,
+		"setnx":  defaultFunc,
+		"get":    defaultFunc,
+		"getset": defaultFunc,
+		"setex":  defaultFunc,
+		"psetex": defaultFunc,
+		"getex":  defaultFunc,
+		"getdel": defaultFunc,
+
+		"strlen":      defaultFunc,
+		"incr":        defaultFunc,
+		"decr":        defaultFunc,
+		"incrby":      defaultFunc,
+		"decrby":      defaultFunc,
+		"incrbyfloat": defaultFunc,
+		"append":      defaultFunc,
+		"getrange":    defaultFunc,
+		"setrange":    defaultFunc,
+
+		"setbit":      defaultFunc,
+		"getbit":      defaultFunc,
+		"bitcount":    defaultFunc,
+		"bitpos":      defaultFunc,
+		"bitfield":    defaultFunc,
+		"bitfield_ro": defaultFunc,
+
+		"pfadd": defaultFunc,
+
+		"geoadd":    defaultFunc,
+		"geopos":    defaultFunc,
+		"geodist":   defaultFunc,
+		"geohash":   defaultFunc,
+		"geosearch": defaultFunc,
+
+		"xadd":       defaultFunc,
+		"xlen":       defaultFunc,
+		"xrange":     defaultFunc,
+		"xrevrange":  defaultFunc,
+		"xdel":       defaultFunc,
+		"xtrim":      defaultFunc,
+		"xsetid":     defaultFunc,
+		"xack":       defaultFunc,
+		"xpending":   defaultFunc,
+		"xclaim":     defaultFunc,
+		"xautoclaim": defaultFunc,
+
+		"expire":      defaultFunc,
+		"pexpire":     defaultFunc,
+		"expireat":    defaultFunc,
+		"pexpireat":   defaultFunc,
+		"ttl":         defaultFunc,
+		"pttl":        defaultFunc,
+		"expiretime":  defaultFunc,
+		"pexpiretime": defaultFunc,
+		"persist":     defaultFunc,
+
+		"hset":         defaultFunc,
+		"hmset":        defaultFunc,
+		"hsetnx":       defaultFunc,
+		"hget":         defaultFunc,
+		"hmget":        defaultFunc,
+		"hgetall":      defaultFunc,
+		"hkeys":        defaultFunc,
+		"hvals":        defaultFunc,
+		"hlen":         defaultFunc,
+		"hexists":      defaultFunc,
+		"hstrlen":      defaultFunc,
+		"hincrby":      defaultFunc,
+		"hincrbyfloat": defaultFunc,
+		"hrandfield":   defaultFunc,
+		"hdel":         defaultFunc,
+		"hscan":        defaultFunc,
+
+		"lpush":   defaultFunc,
+		"rpush":   defaultFunc,
+		"lpushx":  defaultFunc,
+		"rpushx":  defaultFunc,
+		"lpop":    defaultFunc,
+		"rpop":    defaultFunc,
+		"llen":    defaultFunc,
+		"lrange":  defaultFunc,
+		"lindex":  defaultFunc,
+		"lset":    defaultFunc,
+		"lrem":    defaultFunc,
+		"linsert": defaultFunc,
+		"ltrim":   defaultFunc,
+		"lpos":    defaultFunc,
+
+		"blpop":      blocking,
+		"brpop":      blocking,
+		"brpoplpush": blocking,
+		"blmove":     blocking,
+		"blmpop":     blocking,
+
+		"sadd":        defaultFunc,
+		"srem":        defaultFunc,
+		"sismember":   defaultFunc,
+		"smismember":  defaultFunc,
+		"smembers":    defaultFunc,
+		"scard":       defaultFunc,
+		"spop":        defaultFunc,
+		"srandmember": defaultFunc,
+		"sscan":       defaultFunc,
+
+		"zadd":             defaultFunc,
+		"zrem":             defaultFunc,
+		"zscore":           defaultFunc,
+		"zmscore":          defaultFunc,
+		"zincrby":          defaultFunc,
+		"zcard":            defaultFunc,
+		"zcount":           defaultFunc,
+		"zrank":            defaultFunc,
+		"zrevrank":         defaultFunc,
+		"zrange":           defaultFunc,
+		"zrevrange":        defaultFunc,
+		"zrangebyscore":    defaultFunc,
+		"zrevrangebyscore": defaultFunc,
+		"zremrangebyrank":  defaultFunc,
+		"zremrangebyscore": defaultFunc,
+		"zscan":            defaultFunc,
+
 		"select":  selectDB,
 		"del":     del,
 		"rename":  rename,
 		"renamnx": rename,
 		"flushdb": flushdb,
-		"addnode": addNode,
+		"eval":    eval,
+		"evalsha": eval,
+		"script":  script,
+
+		// 发布订阅只在本节点内进行
+		"subscribe":    local,
+		"psubscribe":   local,
+		"unsubscribe":  local,
+		"punsubscribe": local,
+		"publish":      local,
+		"pubsub":       local,
+		"addnode":      addNode,
+
+		// 快照和AOF重写只处理本节点的数据
+		"save":         local,
+		"bgsave":       local,
+		"lastsave":     local,
+		"bgrewriteaof": local,
 	}
 }
 
@@ -72,6 +208,63 @@ func flushdb(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Re
 	return reply.NewOkReply()
 }
 
+// EVAL和EVALSHA，按照声明的key转发，所有key必须在同一个节点上，没有声明key时在本地执行
+func eval(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 3 {
+		return reply.NewArgNumErrReply(string(args[0])) // 参数个数错误
+	}
+	keys, _, errReply := database.ScriptCmdKeys(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if len(keys) == 0 {
+		return cluster.db.Exec(c, args)
+	}
+	peer := cluster.peerPicker.PickNode(string(keys[0]))
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(string(key)) != peer {
+			return reply.NewStandardErrReply("ERR script keys must within one node")
+		}
+	}
+	return cluster.relay(peer, c, args)
+}
+
+// SCRIPT，LOAD和FLUSH需要群发，保证所有节点的脚本缓存一致，其他子命令在本地执行
+func script(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.NewArgNumErrReply(string(args[0])) // 参数个数错误
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	if subCmd != "load" && subCmd != "flush" {
+		return cluster.db.Exec(c, args)
+	}
+	replies := cluster.broadcast(c, args)
+	for _, r := range replies {
+		if reply.IsErrReply(r) { // 只要有一个节点返回错误，就返回错误
+			return r
+		}
+	}
+	return replies[cluster.self]
+}
+
+// 阻塞的列表命令，所有key必须在同一个节点上
+func blocking(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	keys, errReply := database.CommandKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	if len(keys) == 0 { // 参数不合法，由本地返回错误
+		return cluster.db.Exec(c, args)
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.NewStandardErrReply("ERR blocking command keys must within one node")
+		}
+	}
+	return cluster.relayBlocking(peer, c, args)
+}
+
 func del(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
 	if len(args) < 2 {
 		return reply.NewArgNumErrReply(string(args[0])) // 参数个数错误
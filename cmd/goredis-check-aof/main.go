@@ -0,0 +1,98 @@
+// goredis-check-aof 检查AOF文件是否完整，报告第一条损坏的命令的位置，可以通过截断文件修复。
+// 参数为清单文件时按照清单的顺序检查其中的所有文件，只有最后一个文件可以修复
+//
+// 用法：goredis-check-aof [--fix [-y]] <file.aof|file.manifest>
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"goRedis/aof"
+	"os"
+	"strings"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "truncate the file to the last valid command")
+	yes := flag.Bool("y", false, "fix without asking for confirmation")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--fix [-y]] <file.aof|file.manifest>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	filename := flag.Arg(0)
+
+	files := []string{filename}
+	if strings.HasSuffix(filename, ".manifest") {
+		var err error
+		if files, err = aof.ManifestFiles(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read manifest %s: %v\n", filename, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Checking %d files listed in %s\n", len(files), filename)
+	}
+	for i, file := range files {
+		if !checkFile(file, *fix, *yes, i == len(files)-1) {
+			os.Exit(1)
+		}
+	}
+}
+
+// checkFile 检查一个AOF文件，返回文件是否完整或者已经修复
+func checkFile(filename string, fix bool, yes bool, last bool) bool {
+	result, err := aof.CheckFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open file %s: %v\n", filename, err)
+		return false
+	}
+	if result.HasPreamble {
+		fmt.Printf("%s starts with an RDB preamble\n", filename)
+	}
+	if result.Err == nil {
+		fmt.Printf("AOF analyzed: filename=%s, size=%d, commands=%d\n", filename, result.Size, result.Commands)
+		fmt.Printf("AOF %s is valid\n", filename)
+		return true
+	}
+
+	if errors.Is(result.Err, aof.ErrMultiWithoutExec) {
+		fmt.Printf("0x%08x: Reached EOF before reading EXEC for MULTI\n", result.ValidSize)
+	} else if result.Truncated() {
+		fmt.Printf("0x%08x: Unexpected EOF in the last command\n", result.ValidSize)
+	} else {
+		fmt.Printf("0x%08x: %v\n", result.ValidSize, result.Err)
+	}
+	fmt.Printf("AOF analyzed: filename=%s, size=%d, ok_up_to=%d, commands=%d, diff=%d\n",
+		filename, result.Size, result.ValidSize, result.Commands, result.Size-result.ValidSize)
+	if !fix {
+		fmt.Printf("AOF %s is not valid. Use the --fix option to try fixing it.\n", filename)
+		return false
+	}
+	if !last { // 截断中间的文件会丢失之后所有文件依赖的数据
+		fmt.Printf("AOF %s is not the last file in the manifest and can't be fixed by truncating\n", filename)
+		return false
+	}
+	if !yes && !confirm(result.ValidSize) {
+		fmt.Println("Aborted")
+		return false
+	}
+	if err := os.Truncate(filename, result.ValidSize); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to truncate AOF: %v\n", err)
+		return false
+	}
+	fmt.Printf("Successfully truncated AOF %s\n", filename)
+	return true
+}
+
+// confirm 截断会丢弃损坏位置之后的所有命令，需要用户确认
+func confirm(validSize int64) bool {
+	fmt.Printf("This will shrink the AOF to %d bytes, continue? [y/N]: ", validSize)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -23,28 +23,35 @@ var (
 // ServerProperties 定义服务器的全局配置属性
 type ServerProperties struct {
 	// 公共配置
-	RunID             string `cfg:"runid"`                // 每次执行时都不同的运行ID。
-	Bind              string `cfg:"bind"`                 // 服务器绑定的IP地址。
-	Port              int    `cfg:"port"`                 // 服务器监听的端口号。
-	Dir               string `cfg:"dir"`                  // 服务器的工作目录。
-	AnnounceHost      string `cfg:"announce-host"`        // 用于集群模式下，节点间通信的主机地址。
-	AppendOnly        bool   `cfg:"appendonly"`           // 是否开启追加模式。
-	AppendFilename    string `cfg:"appendfilename"`       // 追加模式下的文件名。
-	AppendFsync       string `cfg:"appendfsync"`          // 追加模式下的同步策略。
-	AofUseRdbPreamble bool   `cfg:"aof-use-rdb-preamble"` // 是否在AOF文件开头使用RDB格式数据。
-	MaxClients        int    `cfg:"maxclients"`           // 最大客户端连接数。
-	RequirePass       string `cfg:"requirepass"`          // 访问密码。
-	Databases         int    `cfg:"databases"`            // 数据库数量。
-	RDBFilename       string `cfg:"dbfilename"`           // RDB文件名。
-	MasterAuth        string `cfg:"masterauth"`           // 主节点认证密码。
-	SlaveAnnouncePort int    `cfg:"slave-announce-port"`  // 从节点宣告端口。
-	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`    // 从节点宣告IP。
-	ReplTimeout       int    `cfg:"repl-timeout"`         // 复制超时时间。
-	ClusterEnable     bool   `cfg:"cluster-enable"`       // 是否启用集群模式。
-	ClusterAsSeed     bool   `cfg:"cluster-as-seed"`      // 是否作为种子节点。
-	ClusterSeed       string `cfg:"cluster-seed"`         // 集群种子节点。
-	ClusterConfigFile string `cfg:"cluster-config-file"`  // 集群配置文件。
-	ClusterReplicas   int    `cfg:"cluster-replicas"`     // 每个节点虚拟节点的数量。
+	RunID                    string `cfg:"runid"`                       // 每次执行时都不同的运行ID。
+	Bind                     string `cfg:"bind"`                        // 服务器绑定的IP地址。
+	Port                     int    `cfg:"port"`                        // 服务器监听的端口号。
+	Dir                      string `cfg:"dir"`                         // 服务器的工作目录。
+	AnnounceHost             string `cfg:"announce-host"`               // 用于集群模式下，节点间通信的主机地址。
+	AppendOnly               bool   `cfg:"appendonly"`                  // 是否开启追加模式。
+	AppendFilename           string `cfg:"appendfilename"`              // 追加模式下AOF文件名的前缀，默认appendonly.aof。
+	AppendDirname            string `cfg:"appenddirname"`               // 存放AOF基础文件、增量文件和清单的目录，默认appendonlydir。
+	AppendFsync              string `cfg:"appendfsync"`                 // 追加模式下的同步策略：always、everysec或no，默认everysec。
+	AofUseRdbPreamble        bool   `cfg:"aof-use-rdb-preamble"`        // 是否在AOF文件开头使用RDB格式数据。
+	AofLoadTruncated         bool   `cfg:"aof-load-truncated"`          // AOF文件最后一条命令或事务不完整时是否截断后继续启动，默认yes。
+	AutoAofRewritePercentage int    `cfg:"auto-aof-rewrite-percentage"` // AOF文件相对上一次重写后增长的百分比达到该值时自动重写，0表示关闭，默认100。
+	AutoAofRewriteMinSize    int    `cfg:"auto-aof-rewrite-min-size"`   // AOF文件小于该大小(字节)时不自动重写，支持kb、mb、gb等单位，默认64mb。
+	MaxClients               int    `cfg:"maxclients"`                  // 最大客户端连接数。
+	RequirePass              string `cfg:"requirepass"`                 // 访问密码。
+	Databases                int    `cfg:"databases"`                   // 数据库数量。
+	RDBFilename              string `cfg:"dbfilename"`                  // RDB文件名，默认dump.rdb。
+	Save                     string `cfg:"save"`                        // 自动快照的条件，如"900 1 300 10"表示900秒内至少1次修改或300秒内至少10次修改，为空表示关闭。
+	MasterAuth               string `cfg:"masterauth"`                  // 主节点认证密码。
+	SlaveAnnouncePort        int    `cfg:"slave-announce-port"`         // 从节点宣告端口。
+	SlaveAnnounceIP          string `cfg:"slave-announce-ip"`           // 从节点宣告IP。
+	ReplTimeout              int    `cfg:"repl-timeout"`                // 复制超时时间。
+	ClusterEnable            bool   `cfg:"cluster-enable"`              // 是否启用集群模式。
+	ClusterAsSeed            bool   `cfg:"cluster-as-seed"`             // 是否作为种子节点。
+	ClusterSeed              string `cfg:"cluster-seed"`                // 集群种子节点。
+	ClusterConfigFile        string `cfg:"cluster-config-file"`         // 集群配置文件。
+	ClusterReplicas          int    `cfg:"cluster-replicas"`            // 每个节点虚拟节点的数量。
+	LuaTimeLimit             int    `cfg:"lua-time-limit"`              // Lua脚本执行超过该时间(毫秒)后视为繁忙，可以被SCRIPT KILL终止，默认5000。
+	NotifyKeyspaceEvents     string `cfg:"notify-keyspace-events"`      // 键空间通知的类别，如"KEA"，为空表示关闭通知，可以通过CONFIG SET修改。
 
 	// 集群模式配置
 	ClusterEnabled string   `cfg:"cluster-enabled"` // 目前未使用。
@@ -72,11 +79,42 @@ func (p *ServerProperties) GetConfig(cfgName string) string {
 		return strconv.Itoa(p.Port)
 	case "databases":
 		return strconv.Itoa(p.Databases)
+	case "lua-time-limit":
+		return strconv.Itoa(p.LuaTimeLimit)
+	case "notify-keyspace-events":
+		return p.NotifyKeyspaceEvents
+	case "dbfilename":
+		return p.RDBFilename
+	case "save":
+		return p.Save
+	case "appendonly":
+		return yesNo(p.AppendOnly)
+	case "appendfilename":
+		return p.AppendFilename
+	case "appenddirname":
+		return p.AppendDirname
+	case "appendfsync":
+		return p.AppendFsync
+	case "aof-load-truncated":
+		return yesNo(p.AofLoadTruncated)
+	case "aof-use-rdb-preamble":
+		return yesNo(p.AofUseRdbPreamble)
+	case "auto-aof-rewrite-percentage":
+		return strconv.Itoa(p.AutoAofRewritePercentage)
+	case "auto-aof-rewrite-min-size":
+		return strconv.Itoa(p.AutoAofRewriteMinSize)
 	default:
 		return ""
 	}
 }
 
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
 // Properties holds global config properties
 var Properties *ServerProperties   // 全局配置属性
 var EachTimeServerInfo *ServerInfo // 服务器信息
@@ -94,11 +132,54 @@ func init() {
 		AppendOnly:      false,
 		RunID:           utils.RandString(40),
 		ClusterReplicas: 1,
+
+		AofLoadTruncated:         true,
+		AutoAofRewritePercentage: defaultAutoAofRewritePercentage,
+		AutoAofRewriteMinSize:    defaultAutoAofRewriteMinSize,
 	}
 }
 
+const (
+	defaultAutoAofRewritePercentage = 100
+	defaultAutoAofRewriteMinSize    = 64 << 20
+)
+
+// ParseMemory 解析整数，支持k、kb、m、mb、g、gb单位(不区分大小写)，k=1000，kb=1024
+func ParseMemory(s string) (int64, bool) {
+	s = strings.ToLower(s)
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			factor = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n * factor, true
+}
+
+// multiValueKeys 可以在配置文件中出现多次的配置，如多行save
+var multiValueKeys = map[string]bool{
+	"save": true,
+}
+
 func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+	config := &ServerProperties{ // 0值有特殊含义的配置需要设置默认值
+		AofLoadTruncated:         true,
+		AutoAofRewritePercentage: defaultAutoAofRewritePercentage,
+		AutoAofRewriteMinSize:    defaultAutoAofRewriteMinSize,
+	}
 
 	// 读取解析配置文件
 	rawMap := make(map[string]string)
@@ -110,9 +191,12 @@ func parse(src io.Reader) *ServerProperties {
 		}
 		pivot := strings.IndexAny(line, " ")
 		if pivot > 0 && pivot < len(line)-1 {
-			key := line[0:pivot]
+			key := strings.ToLower(line[0:pivot])
 			value := strings.Trim(line[pivot+1:], " ")
-			rawMap[strings.ToLower(key)] = value
+			if prev, exists := rawMap[key]; exists && multiValueKeys[key] { // 可以出现多次的配置，多行的值用空格连接
+				value = prev + " " + value
+			}
+			rawMap[key] = value
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -136,8 +220,8 @@ func parse(src io.Reader) *ServerProperties {
 			case reflect.String:
 				fieldVal.SetString(value)
 			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err == nil {
+				intValue, ok := ParseMemory(value)
+				if ok {
 					fieldVal.SetInt(intValue)
 				}
 			case reflect.Bool:
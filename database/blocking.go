@@ -0,0 +1,247 @@
+package database
+
+import (
+	"container/list"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"sync"
+	"time"
+)
+
+// TryFunc 尝试完成一次阻塞命令，ok为false表示所有key上都没有数据，需要继续等待
+type TryFunc func() (result resp.Reply, ok bool)
+
+// waiter 阻塞在一个或多个key上的客户端
+type waiter struct {
+	keys    []string
+	ready   chan struct{}            // 容量为1，监听的key上可能有数据时收到通知
+	entries map[string]*list.Element // key -> 在该key等待队列中的位置，用于快速移除
+}
+
+// blockingRegistry 记录阻塞在每个key上的客户端，同一个key上的客户端按阻塞的先后顺序排队。
+// key上有新数据时唤醒队首的客户端，在它处理完之前其他修改这个key的命令需要等待，
+// 保证数据按照阻塞的先后顺序交给等待的客户端，不会被之后到达的命令取走
+type blockingRegistry struct {
+	mu      sync.Mutex
+	served  *sync.Cond            // serving中有key被移除时广播
+	waiters map[string]*list.List // key -> *waiter队列
+	serving map[string]*waiter    // key -> 已经唤醒但还没有处理完的队首客户端
+}
+
+func newBlockingRegistry() *blockingRegistry {
+	registry := &blockingRegistry{
+		waiters: make(map[string]*list.List),
+		serving: make(map[string]*waiter),
+	}
+	registry.served = sync.NewCond(&registry.mu)
+	return registry
+}
+
+// add 将客户端加入所有key的等待队列末尾
+func (registry *blockingRegistry) add(keys []string) *waiter {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	w := &waiter{
+		keys:    keys,
+		ready:   make(chan struct{}, 1),
+		entries: make(map[string]*list.Element, len(keys)),
+	}
+	for _, key := range keys {
+		if _, ok := w.entries[key]; ok { // 同一个key重复出现时只排队一次
+			continue
+		}
+		queue, ok := registry.waiters[key]
+		if !ok {
+			queue = list.New()
+			registry.waiters[key] = queue
+		}
+		w.entries[key] = queue.PushBack(w)
+	}
+	return w
+}
+
+// remove 将客户端从所有key的等待队列中移除，并唤醒这些key上的下一个客户端，
+// 由于数据可能没有被取完，或者客户端收到的通知还没有处理，需要由下一个客户端继续尝试
+func (registry *blockingRegistry) remove(w *waiter) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for key, element := range w.entries {
+		queue := registry.waiters[key]
+		queue.Remove(element)
+		if queue.Len() == 0 {
+			delete(registry.waiters, key)
+		}
+	}
+	keys := w.entries
+	w.entries = nil
+	for key := range keys {
+		registry.doneLocked(w, key)
+		registry.signalLocked(key)
+	}
+}
+
+// signal 唤醒key等待队列中最早阻塞的客户端，队首客户端处理完后才会唤醒下一个客户端，以保证FIFO顺序
+func (registry *blockingRegistry) signal(key string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.signalLocked(key)
+}
+
+func (registry *blockingRegistry) signalLocked(key string) {
+	if _, ok := registry.serving[key]; ok { // 队首客户端处理完后会唤醒下一个
+		return
+	}
+	queue, ok := registry.waiters[key]
+	if !ok {
+		return
+	}
+	w := queue.Front().Value.(*waiter)
+	registry.serving[key] = w
+	select {
+	case w.ready <- struct{}{}:
+	default: // 已经有未处理的通知
+	}
+}
+
+// done 客户端重试失败，继续等待，结束它在所有key上的唤醒
+func (registry *blockingRegistry) done(w *waiter) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for key := range w.entries {
+		registry.doneLocked(w, key)
+	}
+}
+
+func (registry *blockingRegistry) doneLocked(w *waiter, key string) {
+	if registry.serving[key] == w {
+		delete(registry.serving, key)
+		registry.served.Broadcast()
+	}
+}
+
+// waitServed 等待keys上已经唤醒的客户端处理完，修改key的命令在加锁前调用，
+// 避免在等待的客户端之前取走数据
+func (registry *blockingRegistry) waitServed(keys []string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for registry.isServingLocked(keys) {
+		registry.served.Wait()
+	}
+}
+
+// isServing 判断keys上是否有已经唤醒但还没有处理完的客户端
+func (registry *blockingRegistry) isServing(keys []string) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.isServingLocked(keys)
+}
+
+func (registry *blockingRegistry) isServingLocked(keys []string) bool {
+	for _, key := range keys {
+		if _, ok := registry.serving[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockingReply 阻塞命令的回复，由协议层调用Wait等待命令完成
+type BlockingReply struct {
+	db      *RedisDb
+	waiter  *waiter
+	timeout time.Duration // 为0表示永久阻塞
+	try     TryFunc
+
+	writeKeys []string // 命令声明的key，每次重试时加锁
+	readKeys  []string
+	tracker   *execTracker // 由Exec设置，记录重试时是否修改了数据以及写入AOF的错误
+}
+
+// Wait 等待命令完成，直到try成功、超时或cancel被关闭
+func (r *BlockingReply) Wait(cancel <-chan struct{}) resp.Reply {
+	var timer <-chan time.Time
+	if r.timeout > 0 {
+		t := time.NewTimer(r.timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	for {
+		select {
+		case <-r.waiter.ready:
+			if result, ok := r.tryLocked(); ok {
+				r.finish()
+				return result
+			}
+		case <-timer:
+			r.finish()
+			return reply.NewNullMultiBulkReply()
+		case <-cancel:
+			r.finish()
+			return nil
+		}
+	}
+}
+
+// tryLocked 持有命令声明的key锁重试。失败时在释放锁之前结束唤醒，
+// 之后写入的数据会重新唤醒队首的客户端，不会丢失通知
+func (r *BlockingReply) tryLocked() (resp.Reply, bool) {
+	r.db.locker.RWLocks(r.writeKeys, r.readKeys)
+	defer r.db.locker.RWUnLocks(r.writeKeys, r.readKeys)
+	r.tracker.reset()
+	r.db.expireKeys(r.writeKeys)
+	result, ok := r.try()
+	if !ok {
+		r.db.blocking.done(r.waiter)
+		return nil, false
+	}
+	if r.tracker.modified {
+		r.db.touch(r.writeKeys...)
+	}
+	if r.tracker.aofErr != nil {
+		return newAofErrReply(r.tracker.aofErr), true
+	}
+	return result, true
+}
+
+// finish 结束等待，并唤醒下一个等待的客户端
+func (r *BlockingReply) finish() {
+	r.db.blocking.remove(r.waiter)
+}
+
+// ToBytes 阻塞回复本身没有内容，未经等待直接输出时视为超时
+func (r *BlockingReply) ToBytes() []byte {
+	return reply.NewNullMultiBulkReply().ToBytes()
+}
+
+// Block 将客户端阻塞在keys上，返回的BlockingReply需要由协议层等待，
+// 每当keys中的某个key可能有新数据时，会按阻塞顺序调用try重试。
+// 调用时需要持有keys的锁，首次尝试和加入队列之间不会有数据写入
+func (db *RedisDb) Block(keys []string, timeout time.Duration, try TryFunc) *BlockingReply {
+	w := db.blocking.add(keys)
+	return &BlockingReply{
+		db:      db,
+		waiter:  w,
+		timeout: timeout,
+		try:     try,
+	}
+}
+
+// SignalKeyReady 通知阻塞在key上的客户端key上可能有新的数据，写入数据的命令在修改key后调用
+func (db *RedisDb) SignalKeyReady(key string) {
+	db.blocking.signal(key)
+}
+
+// lockKeys 对命令声明的key加锁。writeKeys上有已经被唤醒的阻塞客户端时，先等待它们处理完再加锁，
+// 加锁后再次检查，避免在等待和加锁之间又有客户端被唤醒
+func (db *RedisDb) lockKeys(writeKeys []string, readKeys []string) {
+	for {
+		db.blocking.waitServed(writeKeys)
+		db.locker.RWLocks(writeKeys, readKeys)
+		if !db.blocking.isServing(writeKeys) {
+			return
+		}
+		db.locker.RWUnLocks(writeKeys, readKeys)
+	}
+}
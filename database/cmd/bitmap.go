@@ -0,0 +1,508 @@
+package cmd
+
+import (
+	"goRedis/database"
+	interdb "goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/meta/bitmap"
+	"goRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const maxBitOffset = maxStringSize*8 - 1 // 位偏移量的最大值
+
+func init() {
+	database.RegisterCommand("setbit", SetBit, database.WriteFirstKey, 4)
+	database.RegisterCommand("getbit", GetBit, database.ReadFirstKey, 3)
+	database.RegisterCommand("bitcount", BitCount, database.ReadFirstKey, -2)
+	database.RegisterCommand("bitpos", BitPos, database.ReadFirstKey, -3)
+	database.RegisterCommand("bitop", BitOp, bitOpKeys, -4)
+	database.RegisterCommand("bitfield", BitField, database.WriteFirstKey, -2)
+	database.RegisterCommand("bitfield_ro", BitFieldRO, database.ReadFirstKey, -2)
+}
+
+// bitOpKeys BITOP operation destkey key [key ...]
+func bitOpKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, database.ToKeys(args[2:])
+}
+
+// getAsBitMap 获取key对应的位图，key不存在时返回nil
+func getAsBitMap(db *database.RedisDb, key string) (*bitmap.BitMap, resp.Reply) {
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return bitmap.FromBytes(value), nil
+}
+
+// parseBitOffset 解析位偏移量
+func parseBitOffset(arg []byte) (int64, resp.Reply) {
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, reply.NewStandardErrReply("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// SetBit 设置key的第offset位为0或1，返回原来的值，字符串长度不足时自动扩展
+// SETBIT key offset value
+func SetBit(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value := string(args[2])
+	if value != "0" && value != "1" {
+		return reply.NewStandardErrReply("ERR bit is not an integer or out of range")
+	}
+	bm, errReply := getAsBitMap(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if bm == nil {
+		bm = bitmap.FromBytes(nil)
+	}
+	old := bm.SetBit(offset, value[0]-'0')
+	db.PutEntity(key, interdb.NewDataEntity(bm.ToBytes())) // 扩展后底层数组可能发生变化
+	db.AddAof(utils.ToCmdLine3("setbit", args...))
+	db.Notify(database.NotifyString, "setbit", key)
+	return reply.NewIntReply(int64(old))
+}
+
+// GetBit 返回key的第offset位，超出长度时返回0
+// GETBIT key offset
+func GetBit(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	offset, errReply := parseBitOffset(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	bm, errReply := getAsBitMap(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if bm == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(int64(bm.GetBit(offset)))
+}
+
+// parseBitRange 解析[start end [BYTE|BIT]]，将其转换为位的闭区间，支持负数下标。
+// endGiven表示是否指定了end，范围为空时ok为false
+func parseBitRange(args [][]byte, bitSize int64) (start int64, end int64, endGiven bool, ok bool, errReply resp.Reply) {
+	start, end = 0, bitSize-1
+	if len(args) == 0 {
+		return start, end, false, bitSize > 0, nil
+	}
+	if len(args) > 3 {
+		return 0, 0, false, false, reply.NewSyntaxErrReply()
+	}
+	var err error
+	start, err = strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, 0, false, false, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if len(args) >= 2 {
+		end, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return 0, 0, false, false, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		endGiven = true
+	}
+	isBit := false
+	if len(args) == 3 {
+		switch strings.ToLower(string(args[2])) {
+		case "byte":
+		case "bit":
+			isBit = true
+		default:
+			return 0, 0, false, false, reply.NewSyntaxErrReply()
+		}
+	}
+	size := bitSize
+	if !isBit {
+		size = bitSize / 8
+		if !endGiven {
+			end = size - 1
+		}
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return 0, 0, endGiven, false, nil
+	}
+	if !isBit {
+		start, end = start*8, end*8+7
+	}
+	return start, end, endGiven, true, nil
+}
+
+// BitCount 统计key中值为1的位数，可以按字节或者按位指定范围
+// BITCOUNT key [start end [BYTE|BIT]]
+func BitCount(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) == 2 { // start和end必须同时指定
+		return reply.NewSyntaxErrReply()
+	}
+	bm, errReply := getAsBitMap(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if bm == nil {
+		bm = bitmap.FromBytes(nil)
+	}
+	start, end, _, ok, errReply := parseBitRange(args[1:], bm.BitSize())
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(bm.CountBits(start, end))
+}
+
+// BitPos 返回key中第一个值为bit的位置。查找0且没有指定end时，如果范围内全是1，返回字符串末尾之后的第一位
+// BITPOS key bit [start [end [BYTE|BIT]]]
+func BitPos(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	bitArg := string(args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return reply.NewStandardErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	bit := bitArg[0] - '0'
+	bm, errReply := getAsBitMap(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if bm == nil {
+		bm = bitmap.FromBytes(nil)
+	}
+	start, end, endGiven, ok, errReply := parseBitRange(args[2:], bm.BitSize())
+	if errReply != nil {
+		return errReply
+	}
+	if bm.BitSize() == 0 { // key不存在时视为无限长的0
+		if bit == 0 {
+			return reply.NewIntReply(0)
+		}
+		return reply.NewIntReply(-1)
+	}
+	if !ok {
+		return reply.NewIntReply(-1)
+	}
+	pos := bm.FindBit(bit, start, end)
+	if pos == -1 && bit == 0 && !endGiven {
+		pos = bm.BitSize()
+	}
+	return reply.NewIntReply(pos)
+}
+
+// BitOp 对多个key进行按位运算并将结果保存在destkey中，返回结果的长度。长度不足的key视为用0填充
+// BITOP AND|OR|XOR|NOT destkey key [key ...]
+func BitOp(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	op := strings.ToLower(string(args[0]))
+	dest := string(args[1])
+	keys := args[2:]
+	switch op {
+	case "and", "or", "xor":
+	case "not":
+		if len(keys) != 1 {
+			return reply.NewStandardErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return reply.NewSyntaxErrReply()
+	}
+	values := make([][]byte, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		value, errReply := getAsString(db, string(key))
+		if errReply != nil {
+			return errReply
+		}
+		values[i] = value
+		if len(value) > maxLen {
+			maxLen = len(value)
+		}
+	}
+	result := make([]byte, maxLen)
+	for i := range result {
+		var b byte
+		for j, value := range values {
+			var v byte
+			if i < len(value) {
+				v = value[i]
+			}
+			if j == 0 {
+				b = v
+				continue
+			}
+			switch op {
+			case "and":
+				b &= v
+			case "or":
+				b |= v
+			case "xor":
+				b ^= v
+			}
+		}
+		if op == "not" {
+			b = ^b
+		}
+		result[i] = b
+	}
+	if maxLen == 0 { // 结果为空字符串时删除destkey
+		if db.Remove(dest) > 0 {
+			db.Notify(database.NotifyGeneric, "del", dest)
+		}
+		db.AddAof(utils.ToCmdLine("del", dest))
+		return reply.NewIntReply(0)
+	}
+	db.PutEntity(dest, interdb.NewDataEntity(result))
+	db.Persist(dest)
+	db.AddAof(utils.ToCmdLine3("bitop", args...))
+	db.Notify(database.NotifyString, "set", dest)
+	return reply.NewIntReply(int64(maxLen))
+}
+
+const (
+	overflowWrap = iota // 溢出时回绕
+	overflowSat         // 溢出时取最大值或最小值
+	overflowFail        // 溢出时不做修改并返回nil
+)
+
+// bitFieldType BITFIELD中的整数类型，如i8、u16
+type bitFieldType struct {
+	signed bool
+	width  int
+}
+
+// bitFieldOp BITFIELD中的一个子命令
+type bitFieldOp struct {
+	name     string // get、set或incrby
+	typ      bitFieldType
+	offset   int64
+	value    int64 // set的值或incrby的增量
+	overflow int   // 该子命令生效的溢出策略
+}
+
+// parseBitFieldType 解析i1~i64或u1~u63
+func parseBitFieldType(arg []byte) (bitFieldType, bool) {
+	s := strings.ToLower(string(arg))
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u') {
+		return bitFieldType{}, false
+	}
+	width, err := strconv.Atoi(s[1:])
+	if err != nil || width < 1 || width > 64 || (s[0] == 'u' && width == 64) {
+		return bitFieldType{}, false
+	}
+	return bitFieldType{signed: s[0] == 'i', width: width}, true
+}
+
+// parseBitFieldOffset 解析位偏移量，以#开头时表示以类型宽度为单位
+func parseBitFieldOffset(arg []byte, typ bitFieldType) (int64, bool) {
+	s := string(arg)
+	multiply := false
+	if strings.HasPrefix(s, "#") {
+		multiply = true
+		s = s[1:]
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(typ.width) {
+			return 0, false
+		}
+		offset *= int64(typ.width)
+	}
+	if offset+int64(typ.width)-1 > maxBitOffset {
+		return 0, false
+	}
+	return offset, true
+}
+
+// parseBitFieldOps 解析BITFIELD的子命令，readonly为true时只允许GET
+func parseBitFieldOps(args [][]byte, readonly bool) ([]*bitFieldOp, resp.Reply) {
+	var ops []*bitFieldOp
+	overflow := overflowWrap
+	for i := 0; i < len(args); {
+		name := strings.ToLower(string(args[i]))
+		if name == "overflow" {
+			if i+1 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			switch strings.ToLower(string(args[i+1])) {
+			case "wrap":
+				overflow = overflowWrap
+			case "sat":
+				overflow = overflowSat
+			case "fail":
+				overflow = overflowFail
+			default:
+				return nil, reply.NewStandardErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+		argCount := 0
+		switch name {
+		case "get":
+			argCount = 2
+		case "set", "incrby":
+			if readonly {
+				return nil, reply.NewStandardErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+			}
+			argCount = 3
+		default:
+			return nil, reply.NewSyntaxErrReply()
+		}
+		if i+argCount >= len(args) {
+			return nil, reply.NewSyntaxErrReply()
+		}
+		typ, ok := parseBitFieldType(args[i+1])
+		if !ok {
+			return nil, reply.NewStandardErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		offset, ok := parseBitFieldOffset(args[i+2], typ)
+		if !ok {
+			return nil, reply.NewStandardErrReply("ERR bit offset is not an integer or out of range")
+		}
+		op := &bitFieldOp{name: name, typ: typ, offset: offset, overflow: overflow}
+		if argCount == 3 {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argCount + 1
+	}
+	return ops, nil
+}
+
+// BitField 将字符串视为整数数组，对其中任意位置、任意宽度的整数进行读写
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func BitField(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return bitFieldGeneric(db, args, false)
+}
+
+// BitFieldRO BITFIELD的只读版本，只支持GET
+// BITFIELD_RO key [GET type offset ...]
+func BitFieldRO(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return bitFieldGeneric(db, args, true)
+}
+
+func bitFieldGeneric(db *database.RedisDb, args [][]byte, readonly bool) resp.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:], readonly)
+	if errReply != nil {
+		return errReply
+	}
+	bm, errReply := getAsBitMap(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if bm == nil {
+		bm = bitmap.FromBytes(nil)
+	}
+	results := make([]resp.Reply, len(ops))
+	modified := false
+	for i, op := range ops {
+		old := readBitField(bm, op.typ, op.offset)
+		if op.name == "get" {
+			results[i] = reply.NewIntReply(old)
+			continue
+		}
+		var value int64
+		var ok bool
+		if op.name == "set" {
+			value, ok = handleBitFieldOverflow(op.typ, 0, op.value, op.overflow)
+		} else {
+			value, ok = handleBitFieldOverflow(op.typ, old, op.value, op.overflow)
+		}
+		if !ok { // FAIL策略下溢出，不做修改
+			results[i] = reply.NewNullBulkReply()
+			continue
+		}
+		bm.SetUint(op.offset, op.typ.width, uint64(value))
+		modified = true
+		if op.name == "set" {
+			results[i] = reply.NewIntReply(old)
+		} else {
+			results[i] = reply.NewIntReply(value)
+		}
+	}
+	if modified {
+		db.PutEntity(key, interdb.NewDataEntity(bm.ToBytes()))
+		db.AddAof(utils.ToCmdLine3("bitfield", args...))
+		db.Notify(database.NotifyString, "setbit", key)
+	}
+	return reply.NewMultiRawReply(results)
+}
+
+// readBitField 按照类型读取整数
+func readBitField(bm *bitmap.BitMap, typ bitFieldType, offset int64) int64 {
+	if typ.signed {
+		return bm.GetInt(offset, typ.width)
+	}
+	return int64(bm.GetUint(offset, typ.width))
+}
+
+// handleBitFieldOverflow 计算value+incr，并按照溢出策略处理超出类型范围的结果，FAIL策略下溢出时ok为false
+func handleBitFieldOverflow(typ bitFieldType, value int64, incr int64, overflow int) (result int64, ok bool) {
+	var min, max int64
+	if typ.signed {
+		max = int64(uint64(1)<<(typ.width-1) - 1)
+		min = -max - 1
+	} else {
+		max = int64(uint64(1)<<typ.width - 1)
+	}
+	upper := incr > 0 && value > max-incr
+	lower := incr < 0 && value < min-incr
+	if typ.signed && typ.width == 64 { // int64的最大最小值相减本身可能溢出，单独处理
+		upper = incr > 0 && value > math.MaxInt64-incr
+		lower = incr < 0 && value < math.MinInt64-incr
+	} else if !typ.signed && incr == math.MinInt64 { // 0-incr溢出，无符号数减去2^63必然下溢
+		lower = true
+	}
+	if !upper && !lower {
+		return value + incr, true
+	}
+	switch overflow {
+	case overflowSat:
+		if upper {
+			return max, true
+		}
+		return min, true
+	case overflowFail:
+		return 0, false
+	default: // 回绕，取低width位
+		sum := uint64(value) + uint64(incr)
+		if typ.width < 64 {
+			sum &= uint64(1)<<typ.width - 1
+			if typ.signed && sum&(uint64(1)<<(typ.width-1)) != 0 {
+				sum |= ^uint64(0) << typ.width
+			}
+		}
+		return int64(sum), true
+	}
+}
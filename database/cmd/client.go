@@ -9,7 +9,7 @@ import (
 )
 
 func init() {
-	database.RegisterCommand("client", Client, -2)
+	database.RegisterCommand("client", Client, nil, -2)
 	registerClientCmd("setname", 2)
 	registerClientCmd("getname", 1)
 }
@@ -1,17 +1,20 @@
 package cmd
 
 import (
+	"goRedis/aof"
 	"goRedis/config"
 	"goRedis/database"
 	"goRedis/interface/resp"
 	"goRedis/lib/utils"
 	"goRedis/resp/reply"
+	"strconv"
 	"strings"
 )
 
 func init() {
-	database.RegisterCommand("config", Config, -2)
+	database.RegisterCommand("config", Config, nil, -2)
 	registerConfigCmd("get", -2)
+	registerConfigCmd("set", -3)
 }
 
 var configCmdTable map[string]int = make(map[string]int)
@@ -27,6 +30,8 @@ func Config(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Re
 	switch cmdName {
 	case "get":
 		return ConfigGet(client, db, args[1:])
+	case "set":
+		return ConfigSet(client, db, args[1:])
 	default:
 		return reply.NewStandardErrReply("ERR unknown command 'config " + cmdName + "'")
 	}
@@ -39,12 +44,130 @@ func ConfigGet(client resp.Connection, db *database.RedisDb, args [][]byte) resp
 		cmdName := string(arg)
 		cmdName = strings.ToLower(cmdName)
 		result = append(result, []byte(cmdName))
+		if getter, ok := configGetters[cmdName]; ok { // 运行时可修改的配置读取当前生效的值
+			result = append(result, []byte(getter()))
+			continue
+		}
 		result = append(result, []byte(config.Properties.GetConfig(cmdName)))
 	}
 
 	return reply.NewMultiBulkReply(result)
 }
 
+// configGetters 运行时可修改的配置，这些配置的当前值只保存在各模块中，不再写回config.Properties
+var configGetters = map[string]func() string{
+	"notify-keyspace-events": database.NotifyKeyspaceEvents,
+	"save":                   database.SaveParams,
+	"appendfsync":            aof.FsyncPolicy,
+	"auto-aof-rewrite-percentage": func() string {
+		return strconv.Itoa(aof.AutoRewritePercentage())
+	},
+	"auto-aof-rewrite-min-size": func() string {
+		return strconv.FormatInt(aof.AutoRewriteMinSize(), 10)
+	},
+	"aof-use-rdb-preamble": func() string {
+		if aof.UseRdbPreamble() {
+			return "yes"
+		}
+		return "no"
+	},
+	"lua-time-limit": func() string {
+		return strconv.Itoa(database.LuaTimeLimit())
+	},
+}
+
+// configSetter 校验配置值，返回修改配置的函数，配置值不合法时返回false
+type configSetter func(value string) (apply func(), ok bool)
+
+// configSetters 支持在运行时修改的配置
+var configSetters = map[string]configSetter{
+	"notify-keyspace-events": func(value string) (func(), bool) {
+		if _, ok := database.CheckNotifyKeyspaceEvents(value); !ok {
+			return nil, false
+		}
+		return func() {
+			database.SetNotifyKeyspaceEvents(value)
+		}, true
+	},
+	"save": func(value string) (func(), bool) {
+		if _, ok := database.CheckSaveParams(value); !ok {
+			return nil, false
+		}
+		return func() {
+			database.SetSaveParams(value)
+		}, true
+	},
+	"appendfsync": func(value string) (func(), bool) {
+		if _, ok := aof.CheckFsyncPolicy(value); !ok || value == "" {
+			return nil, false
+		}
+		return func() {
+			aof.SetFsyncPolicy(value)
+		}, true
+	},
+	"auto-aof-rewrite-percentage": func(value string) (func(), bool) {
+		percentage, err := strconv.Atoi(value)
+		if err != nil || percentage < 0 {
+			return nil, false
+		}
+		return func() {
+			aof.SetAutoRewritePercentage(percentage)
+		}, true
+	},
+	"auto-aof-rewrite-min-size": func(value string) (func(), bool) {
+		size, ok := config.ParseMemory(value)
+		if !ok || size < 0 {
+			return nil, false
+		}
+		return func() {
+			aof.SetAutoRewriteMinSize(size)
+		}, true
+	},
+	"aof-use-rdb-preamble": func(value string) (func(), bool) {
+		value = strings.ToLower(value)
+		if value != "yes" && value != "no" {
+			return nil, false
+		}
+		return func() {
+			aof.SetUseRdbPreamble(value == "yes")
+		}, true
+	},
+	"lua-time-limit": func(value string) (func(), bool) {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, false
+		}
+		return func() {
+			database.SetLuaTimeLimit(limit)
+		}, true
+	},
+}
+
+// ConfigSet 在运行时修改服务器配置：CONFIG SET parameter value [parameter value ...]，
+// 先校验所有配置，全部合法时才修改
+func ConfigSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.NewArgNumErrReply("config|set")
+	}
+	applies := make([]func(), 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		setter, ok := configSetters[name]
+		if !ok {
+			return reply.NewStandardErrReply("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+		}
+		apply, ok := setter(string(args[i+1]))
+		if !ok {
+			return reply.NewStandardErrReply("ERR Invalid argument '" + string(args[i+1]) + "' for CONFIG SET '" + name + "'")
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	return reply.NewOkReply()
+}
+
 func registerConfigCmd(cmdName string, args int) {
 	configCmdTable[cmdName] = args
 }
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	database.RegisterCommand("expire", Expire, database.WriteFirstKey, -3)
+	database.RegisterCommand("pexpire", PExpire, database.WriteFirstKey, -3)
+	database.RegisterCommand("expireat", ExpireAt, database.WriteFirstKey, -3)
+	database.RegisterCommand("pexpireat", PExpireAt, database.WriteFirstKey, -3)
+	database.RegisterCommand("ttl", TTL, database.ReadFirstKey, 2)
+	database.RegisterCommand("pttl", PTTL, database.ReadFirstKey, 2)
+	database.RegisterCommand("expiretime", ExpireTime, database.ReadFirstKey, 2)
+	database.RegisterCommand("pexpiretime", PExpireTime, database.ReadFirstKey, 2)
+	database.RegisterCommand("persist", Persist, database.WriteFirstKey, 2)
+}
+
+// 设置过期时间时的可选条件，可以按位组合
+const (
+	expireNX = 1 << iota // 仅当key没有过期时间时设置
+	expireXX             // 仅当key已有过期时间时设置
+	expireGT             // 仅当新的过期时间大于当前过期时间时设置
+	expireLT             // 仅当新的过期时间小于当前过期时间时设置
+)
+
+// Expire 以秒为单位设置key的剩余生存时间
+func Expire(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if seconds > math.MaxInt64/int64(time.Second) || seconds < math.MinInt64/int64(time.Second) {
+		return reply.NewStandardErrReply("ERR invalid expire time in 'expire' command")
+	}
+	expireAt := time.Now().Add(time.Duration(seconds) * time.Second)
+	return expireGeneric(db, string(args[0]), expireAt, args[2:])
+}
+
+// PExpire 以毫秒为单位设置key的剩余生存时间
+func PExpire(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	millis, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if millis > math.MaxInt64/int64(time.Millisecond) || millis < math.MinInt64/int64(time.Millisecond) {
+		return reply.NewStandardErrReply("ERR invalid expire time in 'pexpire' command")
+	}
+	expireAt := time.Now().Add(time.Duration(millis) * time.Millisecond)
+	return expireGeneric(db, string(args[0]), expireAt, args[2:])
+}
+
+// ExpireAt 以秒级unix时间戳设置key的过期时间点
+func ExpireAt(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	timestamp, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if timestamp > math.MaxInt64/1000 || timestamp < math.MinInt64/1000 {
+		return reply.NewStandardErrReply("ERR invalid expire time in 'expireat' command")
+	}
+	return expireGeneric(db, string(args[0]), time.UnixMilli(timestamp*1000), args[2:])
+}
+
+// PExpireAt 以毫秒级unix时间戳设置key的过期时间点
+func PExpireAt(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	timestamp, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	return expireGeneric(db, string(args[0]), time.UnixMilli(timestamp), args[2:])
+}
+
+// TTL 以秒为单位返回key的剩余生存时间，key不存在返回-2，没有设置过期时间返回-1
+func TTL(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return ttlGeneric(db, string(args[0]), func(d time.Duration) int64 {
+		return int64((d + 500*time.Millisecond) / time.Second) // 四舍五入
+	})
+}
+
+// PTTL 以毫秒为单位返回key的剩余生存时间，key不存在返回-2，没有设置过期时间返回-1
+func PTTL(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return ttlGeneric(db, string(args[0]), func(d time.Duration) int64 {
+		return d.Milliseconds()
+	})
+}
+
+// ExpireTime 返回key过期时间点的秒级unix时间戳，key不存在返回-2，没有设置过期时间返回-1
+func ExpireTime(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return expireTimeGeneric(db, string(args[0]), func(t time.Time) int64 {
+		return t.Unix()
+	})
+}
+
+// PExpireTime 返回key过期时间点的毫秒级unix时间戳，key不存在返回-2，没有设置过期时间返回-1
+func PExpireTime(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return expireTimeGeneric(db, string(args[0]), func(t time.Time) int64 {
+		return t.UnixMilli()
+	})
+}
+
+// Persist 移除key的过期时间，使其永久有效
+func Persist(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if _, exists := db.PeekEntity(key); !exists {
+		return reply.NewIntReply(0)
+	}
+	result := db.Persist(key)
+	if result > 0 {
+		db.AddAof(utils.ToCmdLine3("persist", args...))
+		db.Notify(database.NotifyGeneric, "persist", key)
+	}
+	return reply.NewIntReply(int64(result))
+}
+
+// expireGeneric 按NX/XX/GT/LT条件为key设置过期时间点，AOF中统一记录为绝对时间的PEXPIREAT，保证重放时过期时间不变
+func expireGeneric(db *database.RedisDb, key string, expireAt time.Time, options [][]byte) resp.Reply {
+	flag, errReply := parseExpireFlag(options)
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := db.PeekEntity(key); !exists {
+		return reply.NewIntReply(0)
+	}
+	current, hasTTL := db.GetExpireTime(key)
+	if flag&expireNX > 0 && hasTTL {
+		return reply.NewIntReply(0)
+	}
+	if flag&expireXX > 0 && !hasTTL {
+		return reply.NewIntReply(0)
+	}
+	if flag&expireGT > 0 && (!hasTTL || !expireAt.After(current)) { // 没有过期时间视为无限大
+		return reply.NewIntReply(0)
+	}
+	if flag&expireLT > 0 && hasTTL && !expireAt.Before(current) {
+		return reply.NewIntReply(0)
+	}
+	if !expireAt.After(time.Now()) { // 过期时间已经过去，直接删除key
+		db.Remove(key)
+		db.AddAof(utils.ToCmdLine("del", key))
+		db.Notify(database.NotifyGeneric, "del", key)
+		return reply.NewIntReply(1)
+	}
+	db.Expire(key, expireAt)
+	db.AddAof(makePExpireAtCmd(key, expireAt))
+	db.Notify(database.NotifyGeneric, "expire", key)
+	return reply.NewIntReply(1)
+}
+
+// parseExpireFlag 解析EXPIRE系列命令的NX/XX/GT/LT选项
+func parseExpireFlag(options [][]byte) (int, resp.Reply) {
+	flag := 0
+	for _, option := range options {
+		switch strings.ToLower(string(option)) {
+		case "nx":
+			flag |= expireNX
+		case "xx":
+			flag |= expireXX
+		case "gt":
+			flag |= expireGT
+		case "lt":
+			flag |= expireLT
+		default:
+			return 0, reply.NewStandardErrReply("ERR Unsupported option " + string(option))
+		}
+	}
+	if flag&expireNX > 0 && flag&(expireXX|expireGT|expireLT) > 0 {
+		return 0, reply.NewStandardErrReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flag&expireGT > 0 && flag&expireLT > 0 {
+		return 0, reply.NewStandardErrReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return flag, nil
+}
+
+// ttlGeneric 计算key的剩余生存时间，convert负责将剩余时间转换为回复中的数值
+func ttlGeneric(db *database.RedisDb, key string, convert func(time.Duration) int64) resp.Reply {
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.NewIntReply(-2)
+	}
+	expireAt, hasTTL := db.GetExpireTime(key)
+	if !hasTTL {
+		return reply.NewIntReply(-1)
+	}
+	remain := time.Until(expireAt)
+	if remain < 0 {
+		remain = 0
+	}
+	return reply.NewIntReply(convert(remain))
+}
+
+// expireTimeGeneric 获取key的过期时间点，convert负责将时间点转换为回复中的数值
+func expireTimeGeneric(db *database.RedisDb, key string, convert func(time.Time) int64) resp.Reply {
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.NewIntReply(-2)
+	}
+	expireAt, hasTTL := db.GetExpireTime(key)
+	if !hasTTL {
+		return reply.NewIntReply(-1)
+	}
+	return reply.NewIntReply(convert(expireAt))
+}
+
+// makePExpireAtCmd 生成记录绝对过期时间的PEXPIREAT命令，用于AOF持久化
+func makePExpireAtCmd(key string, expireAt time.Time) [][]byte {
+	return utils.ToCmdLine("pexpireat", key, strconv.FormatInt(expireAt.UnixMilli(), 10))
+}
@@ -0,0 +1,557 @@
+package cmd
+
+import (
+	"goRedis/database"
+	interdb "goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/geohash"
+	"goRedis/lib/utils"
+	"goRedis/meta/sortedset"
+	"goRedis/resp/reply"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	database.RegisterCommand("geoadd", GeoAdd, database.WriteFirstKey, -5)
+	database.RegisterCommand("geopos", GeoPos, database.ReadFirstKey, -2)
+	database.RegisterCommand("geodist", GeoDist, database.ReadFirstKey, -4)
+	database.RegisterCommand("geohash", GeoHash, database.ReadFirstKey, -2)
+	database.RegisterCommand("geosearch", GeoSearch, database.ReadFirstKey, -7)
+	database.RegisterCommand("geosearchstore", GeoSearchStore, geoSearchStoreKeys, -8)
+}
+
+// geoSearchStoreKeys GEOSEARCHSTORE destination source ...
+func geoSearchStoreKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// GeoAdd 将经纬度编码为geohash作为分数添加到有序集合中
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func GeoAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var nx, xx, ch bool
+	i := 1
+parseOptions:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ch":
+			ch = true
+		default:
+			break parseOptions
+		}
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return reply.NewSyntaxErrReply()
+	}
+	if nx && xx {
+		return reply.NewStandardErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	elements := make([]*sortedset.Element, len(triples)/3)
+	for j := 0; j < len(triples); j += 3 {
+		longitude, latitude, errReply := parseCoordinate(triples[j], triples[j+1])
+		if errReply != nil {
+			return errReply
+		}
+		elements[j/3] = &sortedset.Element{
+			Member: string(triples[j+2]),
+			Score:  float64(geohash.Encode(longitude, latitude, geohash.MaxSteps)),
+		}
+	}
+
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if xx {
+			return reply.NewIntReply(0)
+		}
+		zset = sortedset.NewSortedSet()
+		db.PutEntity(key, interdb.NewDataEntity(zset))
+	}
+	added, updated := 0, 0
+	for _, element := range elements {
+		current, exists := zset.Get(element.Member)
+		if exists {
+			if nx || current.Score == element.Score {
+				continue
+			}
+			updated++
+		} else {
+			if xx {
+				continue
+			}
+			added++
+		}
+		zset.Add(element.Member, element.Score)
+	}
+	if added+updated > 0 {
+		db.AddAof(utils.ToCmdLine3("geoadd", args...))
+		db.Notify(database.NotifyZSet, "zadd", string(args[0]))
+	}
+	if ch {
+		return reply.NewIntReply(int64(added + updated))
+	}
+	return reply.NewIntReply(int64(added))
+}
+
+// GeoPos 返回成员的经纬度，成员不存在时对应位置返回nil
+// GEOPOS key [member ...]
+func GeoPos(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		longitude, latitude, ok := getMemberCoordinate(zset, string(member))
+		if !ok {
+			result[i] = reply.NewNullMultiBulkReply()
+			continue
+		}
+		result[i] = coordinateToReply(longitude, latitude)
+	}
+	return reply.NewMultiRawReply(result)
+}
+
+// GeoDist 返回两个成员之间的距离，默认单位为米，任意一个成员不存在时返回nil
+// GEODIST key member1 member2 [M|KM|FT|MI]
+func GeoDist(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) > 4 {
+		return reply.NewSyntaxErrReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply resp.Reply
+		unit, errReply = parseDistanceUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	lon1, lat1, ok1 := getMemberCoordinate(zset, string(args[1]))
+	lon2, lat2, ok2 := getMemberCoordinate(zset, string(args[2]))
+	if !ok1 || !ok2 {
+		return reply.NewNullBulkReply()
+	}
+	return reply.NewBulkReply(formatDistance(geohash.Distance(lon1, lat1, lon2, lat2), unit))
+}
+
+// GeoHash 返回成员位置的11个字符的标准geohash字符串
+// GEOHASH key [member ...]
+func GeoHash(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if zset == nil {
+			continue
+		}
+		element, ok := zset.Get(string(member))
+		if !ok {
+			continue
+		}
+		result[i] = []byte(geohash.ToString(uint64(element.Score)))
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchOptions GEOSEARCH和GEOSEARCHSTORE的参数
+type geoSearchOptions struct {
+	fromMember    string
+	hasFromMember bool
+	longitude     float64
+	latitude      float64
+	hasFromLonLat bool
+	byRadius      bool
+	byBox         bool
+	radius        float64 // 单位为米
+	width         float64 // 单位为米
+	height        float64 // 单位为米
+	unit          float64 // 距离单位对应的米数
+	sort          int
+	count         int64 // 0表示不限制
+	any           bool  // 找到count个结果后立即返回，不保证是最近的
+	withCoord     bool
+	withDist      bool
+	withHash      bool
+	storeDist     bool // 仅GEOSEARCHSTORE，将距离作为分数保存
+}
+
+// geoResult 搜索结果
+type geoResult struct {
+	member    string
+	score     float64
+	distance  float64 // 单位为米
+	longitude float64
+	latitude  float64
+}
+
+// GeoSearch 在以成员或经纬度为中心的圆形或矩形范围内搜索成员
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func GeoSearch(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options, errReply := parseGeoSearchOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	results, errReply := geoSearchGeneric(db, string(args[0]), options)
+	if errReply != nil {
+		return errReply
+	}
+	if !options.withCoord && !options.withDist && !options.withHash {
+		members := make([][]byte, len(results))
+		for i, result := range results {
+			members[i] = []byte(result.member)
+		}
+		return reply.NewMultiBulkReply(members)
+	}
+	replies := make([]resp.Reply, len(results))
+	for i, result := range results {
+		item := []resp.Reply{reply.NewBulkReply([]byte(result.member))}
+		if options.withDist {
+			item = append(item, reply.NewBulkReply(formatDistance(result.distance, options.unit)))
+		}
+		if options.withHash {
+			item = append(item, reply.NewIntReply(int64(result.score)))
+		}
+		if options.withCoord {
+			item = append(item, coordinateToReply(result.longitude, result.latitude))
+		}
+		replies[i] = reply.NewMultiRawReply(item)
+	}
+	return reply.NewMultiRawReply(replies)
+}
+
+// GeoSearchStore 与GEOSEARCH相同，但是将结果保存到destination中，返回结果的个数。
+// 默认以geohash作为分数，指定STOREDIST时以距离作为分数。AOF中记录为DEL加上ZADD
+// GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func GeoSearchStore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	options, errReply := parseGeoSearchOptions(args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	results, errReply := geoSearchGeneric(db, string(args[1]), options)
+	if errReply != nil {
+		return errReply
+	}
+	removed := db.Remove(dest)
+	db.AddAof(utils.ToCmdLine("del", dest))
+	if len(results) == 0 {
+		if removed > 0 {
+			db.Notify(database.NotifyGeneric, "del", dest)
+		}
+		return reply.NewIntReply(0)
+	}
+	zset := sortedset.NewSortedSet()
+	cmdLine := utils.ToCmdLine("zadd", dest)
+	for _, result := range results {
+		score := result.score
+		if options.storeDist {
+			score = result.distance / options.unit
+		}
+		zset.Add(result.member, score)
+		cmdLine = append(cmdLine, []byte(utils.FormatFloat(score)), []byte(result.member))
+	}
+	db.PutEntity(dest, interdb.NewDataEntity(zset))
+	db.AddAof(cmdLine)
+	db.Notify(database.NotifyZSet, "geosearchstore", dest)
+	return reply.NewIntReply(zset.Len())
+}
+
+// parseGeoSearchOptions 解析GEOSEARCH的参数，store为true时解析GEOSEARCHSTORE的参数
+func parseGeoSearchOptions(args [][]byte, store bool) (*geoSearchOptions, resp.Reply) {
+	options := &geoSearchOptions{}
+	countGiven := false
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToLower(string(args[i])) {
+		case "frommember":
+			if remaining < 1 {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			if options.hasFromLonLat {
+				return nil, reply.NewStandardErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			options.fromMember = string(args[i+1])
+			options.hasFromMember = true
+			i++
+		case "fromlonlat":
+			if remaining < 2 {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			if options.hasFromMember {
+				return nil, reply.NewStandardErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			longitude, latitude, errReply := parseCoordinate(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.longitude, options.latitude = longitude, latitude
+			options.hasFromLonLat = true
+			i += 2
+		case "byradius":
+			if remaining < 2 {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			if options.byBox {
+				return nil, reply.NewStandardErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			radius, ok := utils.ParseFloat(string(args[i+1]))
+			if !ok {
+				return nil, reply.NewStandardErrReply("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, reply.NewStandardErrReply("ERR radius cannot be negative")
+			}
+			unit, errReply := parseDistanceUnit(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.radius = radius * unit
+			options.unit = unit
+			options.byRadius = true
+			i += 2
+		case "bybox":
+			if remaining < 3 {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			if options.byRadius {
+				return nil, reply.NewStandardErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			width, ok1 := utils.ParseFloat(string(args[i+1]))
+			height, ok2 := utils.ParseFloat(string(args[i+2]))
+			if !ok1 || !ok2 {
+				return nil, reply.NewStandardErrReply("ERR need numeric width and height")
+			}
+			if width < 0 || height < 0 {
+				return nil, reply.NewStandardErrReply("ERR height or width cannot be negative")
+			}
+			unit, errReply := parseDistanceUnit(args[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.width, options.height = width*unit, height*unit
+			options.unit = unit
+			options.byBox = true
+			i += 3
+		case "asc":
+			options.sort = geoSortAsc
+		case "desc":
+			options.sort = geoSortDesc
+		case "count":
+			if remaining < 1 {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, reply.NewStandardErrReply("ERR COUNT must be > 0")
+			}
+			options.count = count
+			countGiven = true
+			i++
+		case "any":
+			options.any = true
+		case "withcoord":
+			if store {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.withCoord = true
+		case "withdist":
+			if store {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.withDist = true
+		case "withhash":
+			if store {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.withHash = true
+		case "storedist":
+			if !store {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.storeDist = true
+		default:
+			return nil, reply.NewSyntaxErrReply()
+		}
+	}
+	if !options.hasFromMember && !options.hasFromLonLat {
+		return nil, reply.NewStandardErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !options.byRadius && !options.byBox {
+		return nil, reply.NewStandardErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	if options.any && !countGiven {
+		return nil, reply.NewStandardErrReply("ERR the ANY argument requires COUNT argument")
+	}
+	if countGiven && options.sort == geoSortNone && !options.any { // 只取count个时需要返回最近的
+		options.sort = geoSortAsc
+	}
+	return options, nil
+}
+
+// geoSearchGeneric 根据搜索范围选择合适精度的geohash格子，在中心格子及周围8个格子对应的分数范围内查找成员，
+// 再按照实际距离过滤
+func geoSearchGeneric(db *database.RedisDb, key string, options *geoSearchOptions) ([]*geoResult, resp.Reply) {
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if zset == nil {
+		return nil, nil
+	}
+	if options.hasFromMember {
+		var ok bool
+		options.longitude, options.latitude, ok = getMemberCoordinate(zset, options.fromMember)
+		if !ok {
+			return nil, reply.NewStandardErrReply("ERR could not decode requested zset member")
+		}
+	}
+
+	width, height, radius := options.width, options.height, options.radius
+	if options.byRadius {
+		width, height = radius*2, radius*2
+	} else {
+		radius = math.Sqrt(width*width+height*height) / 2
+	}
+	box := geohash.BoundingBox(options.longitude, options.latitude, width, height)
+	step := geohash.EstimateSteps(radius, options.latitude)
+	for step > 1 && !geohash.Covers(options.longitude, options.latitude, step, box) {
+		step--
+	}
+
+	results := make([]*geoResult, 0)
+	limitReached := false
+	for _, hash := range geohash.Neighbors(options.longitude, options.latitude, step) {
+		min, max := geohash.ScoreRange(hash, step)
+		minBorder := &sortedset.ScoreBorder{Value: float64(min)}
+		maxBorder := &sortedset.ScoreBorder{Value: float64(max), Exclude: true}
+		zset.ForEach(minBorder, maxBorder, 0, -1, false, func(element *sortedset.Element) bool {
+			longitude, latitude := geohash.DecodeToCoordinate(uint64(element.Score))
+			distance, ok := inSearchShape(options, longitude, latitude)
+			if !ok {
+				return true
+			}
+			results = append(results, &geoResult{
+				member:    element.Member,
+				score:     element.Score,
+				distance:  distance,
+				longitude: longitude,
+				latitude:  latitude,
+			})
+			limitReached = options.any && int64(len(results)) >= options.count
+			return !limitReached
+		})
+		if limitReached {
+			break
+		}
+	}
+
+	switch options.sort {
+	case geoSortAsc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance < results[j].distance })
+	case geoSortDesc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance > results[j].distance })
+	}
+	if options.count > 0 && int64(len(results)) > options.count {
+		results = results[:options.count]
+	}
+	return results, nil
+}
+
+// inSearchShape 判断点是否在搜索范围内，并返回点到中心的距离
+func inSearchShape(options *geoSearchOptions, longitude float64, latitude float64) (float64, bool) {
+	if options.byRadius {
+		distance := geohash.Distance(options.longitude, options.latitude, longitude, latitude)
+		return distance, distance <= options.radius
+	}
+	// 先比较计算量较小的南北距离
+	if geohash.LatitudeDistance(options.latitude, latitude) > options.height/2 {
+		return 0, false
+	}
+	if geohash.Distance(options.longitude, latitude, longitude, latitude) > options.width/2 {
+		return 0, false
+	}
+	return geohash.Distance(options.longitude, options.latitude, longitude, latitude), true
+}
+
+// parseCoordinate 解析经纬度，超出范围时返回错误
+func parseCoordinate(rawLongitude []byte, rawLatitude []byte) (float64, float64, resp.Reply) {
+	longitude, ok1 := utils.ParseFloat(string(rawLongitude))
+	latitude, ok2 := utils.ParseFloat(string(rawLatitude))
+	if !ok1 || !ok2 {
+		return 0, 0, reply.NewStandardErrReply("ERR value is not a valid float")
+	}
+	if !geohash.ValidCoordinate(longitude, latitude) {
+		return 0, 0, reply.NewStandardErrReply("ERR invalid longitude,latitude pair " +
+			strconv.FormatFloat(longitude, 'f', 6, 64) + "," + strconv.FormatFloat(latitude, 'f', 6, 64))
+	}
+	return longitude, latitude, nil
+}
+
+// parseDistanceUnit 解析距离单位，返回该单位对应的米数
+func parseDistanceUnit(arg []byte) (float64, resp.Reply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	default:
+		return 0, reply.NewStandardErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+	}
+}
+
+// getMemberCoordinate 返回成员的经纬度
+func getMemberCoordinate(zset *sortedset.SortedSet, member string) (float64, float64, bool) {
+	if zset == nil {
+		return 0, 0, false
+	}
+	element, ok := zset.Get(member)
+	if !ok {
+		return 0, 0, false
+	}
+	longitude, latitude := geohash.DecodeToCoordinate(uint64(element.Score))
+	return longitude, latitude, true
+}
+
+// formatDistance 将以米为单位的距离转换为指定单位，保留4位小数
+func formatDistance(distance float64, unit float64) []byte {
+	return []byte(strconv.FormatFloat(distance/unit, 'f', 4, 64))
+}
+
+// coordinateToReply 将经纬度转换为数组回复
+func coordinateToReply(longitude float64, latitude float64) resp.Reply {
+	return reply.NewMultiBulkReply([][]byte{
+		[]byte(utils.FormatFloat(longitude)),
+		[]byte(utils.FormatFloat(latitude)),
+	})
+}
@@ -8,41 +8,115 @@ import (
 	"goRedis/lib/utils"
 	"goRedis/meta/dict"
 	"goRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
 )
 
 func init() {
-	database.RegisterCommand("hset", HSet, 4)
-	database.RegisterCommand("hget", HGet, 3)
-	database.RegisterCommand("hdel", HDel, -3)
+	database.RegisterCommand("hset", HSet, database.WriteFirstKey, -4)
+	database.RegisterCommand("hmset", HMSet, database.WriteFirstKey, -4)
+	database.RegisterCommand("hsetnx", HSetNX, database.WriteFirstKey, 4)
+	database.RegisterCommand("hget", HGet, database.ReadFirstKey, 3)
+	database.RegisterCommand("hmget", HMGet, database.ReadFirstKey, -3)
+	database.RegisterCommand("hgetall", HGetAll, database.ReadFirstKey, 2)
+	database.RegisterCommand("hkeys", HKeys, database.ReadFirstKey, 2)
+	database.RegisterCommand("hvals", HVals, database.ReadFirstKey, 2)
+	database.RegisterCommand("hlen", HLen, database.ReadFirstKey, 2)
+	database.RegisterCommand("hexists", HExists, database.ReadFirstKey, 3)
+	database.RegisterCommand("hstrlen", HStrLen, database.ReadFirstKey, 3)
+	database.RegisterCommand("hincrby", HIncrBy, database.WriteFirstKey, 4)
+	database.RegisterCommand("hincrbyfloat", HIncrByFloat, database.WriteFirstKey, 4)
+	database.RegisterCommand("hrandfield", HRandField, database.ReadFirstKey, -2)
+	database.RegisterCommand("hdel", HDel, database.WriteFirstKey, -3)
+	database.RegisterCommand("hscan", HScan, database.ReadFirstKey, -3)
 }
 
-// HSet 向哈希表中添加一个字段
-func HSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
+// getAsDict 获取key对应的哈希表，key不存在时返回nil，类型不匹配时返回错误回复
+func getAsDict(db *database.RedisDb, key string) (idict.Dict, resp.Reply) {
 	entity, exists := db.GetEntity(key)
 	if !exists {
-		entity = idatabase.NewDataEntity(dict.NewSyncDict())
-		db.PutEntity(key, entity)
+		return nil, nil
 	}
 	data, ok := entity.Data.(idict.Dict)
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		return nil, reply.NewStandardErrReply("ERR type error")
+	}
+	return data, nil
+}
+
+// getOrInitDict 获取key对应的哈希表，key不存在时创建一个新的哈希表
+func getOrInitDict(db *database.RedisDb, key string) (idict.Dict, resp.Reply) {
+	data, errReply := getAsDict(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if data == nil {
+		data = dict.NewSyncDict()
+		db.PutEntity(key, idatabase.NewDataEntity(data))
+	}
+	return data, nil
+}
+
+// HSet 向哈希表中设置一个或多个字段，返回新增字段的数量
+// HSET key field value [field value ...]
+func HSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.NewArgNumErrReply("hset")
+	}
+	data, errReply := getOrInitDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := 0
+	for i := 1; i < len(args); i += 2 {
+		result += data.Put(string(args[i]), args[i+1])
 	}
-	field := string(args[1])
 	db.AddAof(utils.ToCmdLine3("hset", args...))
-	return reply.NewIntReply(int64(data.Put(field, args[2])))
+	db.Notify(database.NotifyHash, "hset", string(args[0]))
+	return reply.NewIntReply(int64(result))
+}
+
+// HMSet 向哈希表中设置一个或多个字段，与HSET相同，但返回OK
+// HMSET key field value [field value ...]
+func HMSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.NewArgNumErrReply("hmset")
+	}
+	data, errReply := getOrInitDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	for i := 1; i < len(args); i += 2 {
+		data.Put(string(args[i]), args[i+1])
+	}
+	db.AddAof(utils.ToCmdLine3("hmset", args...))
+	db.Notify(database.NotifyHash, "hset", string(args[0]))
+	return reply.NewOkReply()
+}
+
+// HSetNX 仅当字段不存在时设置字段的值
+func HSetNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getOrInitDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := data.PutIfAbsent(string(args[1]), args[2])
+	if result > 0 {
+		db.AddAof(utils.ToCmdLine3("hsetnx", args...))
+		db.Notify(database.NotifyHash, "hset", string(args[0]))
+	}
+	return reply.NewIntReply(int64(result))
 }
 
 // HGet 获取存储在哈希表中指定字段的值
 func HGet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		return reply.NewNullBulkReply()
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
 	}
-	data, ok := entity.Data.(idict.Dict)
-	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+	if data == nil {
+		return reply.NewNullBulkReply()
 	}
 	field := string(args[1])
 	val, exists := data.Get(field)
@@ -52,26 +126,291 @@ func HGet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Repl
 	return reply.NewBulkReply(val.([]byte))
 }
 
-// HDel 删除存储在哈希表中指定字段的值
-func HDel(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
+// HMGet 获取哈希表中多个字段的值，不存在的字段对应nil
+func HMGet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if data == nil {
+		return reply.NewMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		if val, exists := data.Get(string(field)); exists {
+			result[i] = val.([]byte)
+		}
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// HGetAll 返回哈希表中所有的字段和值
+func HGetAll(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, data.Len()*2)
+	data.ForEach(func(field string, val any) bool {
+		result = append(result, []byte(field), val.([]byte))
+		return true
+	})
+	return reply.NewMultiBulkReply(result)
+}
+
+// HKeys 返回哈希表中所有的字段
+func HKeys(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, data.Len())
+	data.ForEach(func(field string, val any) bool {
+		result = append(result, []byte(field))
+		return true
+	})
+	return reply.NewMultiBulkReply(result)
+}
+
+// HVals 返回哈希表中所有的值
+func HVals(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, data.Len())
+	data.ForEach(func(field string, val any) bool {
+		result = append(result, val.([]byte))
+		return true
+	})
+	return reply.NewMultiBulkReply(result)
+}
+
+// HLen 返回哈希表中字段的数量
+func HLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(int64(data.Len()))
+}
+
+// HExists 判断哈希表中是否存在指定字段
+func HExists(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	if _, exists := data.Get(string(args[1])); exists {
+		return reply.NewIntReply(1)
+	}
+	return reply.NewIntReply(0)
+}
+
+// HStrLen 返回哈希表中指定字段值的长度
+func HStrLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	val, exists := data.Get(string(args[1]))
 	if !exists {
 		return reply.NewIntReply(0)
 	}
-	data, ok := entity.Data.(idict.Dict)
+	return reply.NewIntReply(int64(len(val.([]byte))))
+}
+
+// HIncrBy 为哈希表中字段的整数值加上增量，字段不存在时视为0
+func HIncrBy(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	increment, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	data, errReply := getOrInitDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	field := string(args[1])
+	var current int64
+	if val, exists := data.Get(field); exists {
+		current, err = strconv.ParseInt(string(val.([]byte)), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR hash value is not an integer")
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return reply.NewStandardErrReply("ERR increment or decrement would overflow")
+	}
+	result := current + increment
+	data.Put(field, []byte(strconv.FormatInt(result, 10)))
+	db.AddAof(utils.ToCmdLine3("hincrby", args...))
+	db.Notify(database.NotifyHash, "hincrby", string(args[0]))
+	return reply.NewIntReply(result)
+}
+
+// HIncrByFloat 为哈希表中字段的浮点数值加上增量，AOF中记录为HSET计算结果，避免重放时的精度误差
+func HIncrByFloat(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	increment, ok := utils.ParseFloat(string(args[2]))
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		return reply.NewStandardErrReply("ERR value is not a valid float")
 	}
-	result := 0
-	for i, arg := range args {
-		if i == 0 {
-			continue
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	field := string(args[1])
+	var current float64
+	if data != nil {
+		if val, exists := data.Get(field); exists {
+			current, ok = utils.ParseFloat(string(val.([]byte)))
+			if !ok {
+				return reply.NewStandardErrReply("ERR hash value is not a float")
+			}
+		}
+	}
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return reply.NewStandardErrReply("ERR increment would produce NaN or Infinity")
+	}
+	if data == nil { // 结果合法后才创建哈希表，出错时不留下空的key
+		data, _ = getOrInitDict(db, string(args[0]))
+	}
+	value := []byte(utils.FormatFloat(result))
+	data.Put(field, value)
+	db.AddAof(utils.ToCmdLine3("hset", args[0], args[1], value))
+	db.Notify(database.NotifyHash, "hincrbyfloat", string(args[0]))
+	return reply.NewBulkReply(value)
+}
+
+// HRandField 随机返回哈希表中的字段
+// HRANDFIELD key [count [WITHVALUES]]，count为正数时返回不重复的字段，为负数时可能返回重复的字段
+func HRandField(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) > 3 {
+		return reply.NewSyntaxErrReply()
+	}
+	withCount := len(args) >= 2
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
 		}
-		result += data.Remove(string(arg))
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToLower(string(args[2])) != "withvalues" {
+			return reply.NewSyntaxErrReply()
+		}
+		withValues = true
+	}
+	if count == math.MinInt64 || (withValues && count < -math.MaxInt64/2) { // 与Redis相同，避免取反和返回的数组长度溢出
+		return reply.NewStandardErrReply("ERR value is out of range")
+	}
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		if withCount {
+			return reply.NewEmptyMultiBulkReply()
+		}
+		return reply.NewNullBulkReply()
+	}
+	var fields []string
+	if count == 0 {
+		return reply.NewEmptyMultiBulkReply()
+	} else if count > 0 {
+		fields = data.RandomDistinctKeys(int(count))
+	} else {
+		fields = data.RandomKeys(int(-count))
+	}
+	if !withCount {
+		if len(fields) == 0 {
+			return reply.NewNullBulkReply()
+		}
+		return reply.NewBulkReply([]byte(fields[0]))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			val, _ := data.Get(field)
+			value, _ := val.([]byte)
+			result = append(result, value)
+		}
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// HDel 删除存储在哈希表中指定字段的值，最后一个字段被删除时删除key
+func HDel(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	data, errReply := getAsDict(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	result := 0
+	for _, field := range args[1:] {
+		result += data.Remove(string(field))
+	}
+	if data.Len() == 0 {
+		db.Remove(key)
 	}
 	if result > 0 {
 		db.AddAof(utils.ToCmdLine3("hdel", args...))
+		db.Notify(database.NotifyHash, "hdel", key)
+		if data.Len() == 0 {
+			db.Notify(database.NotifyGeneric, "del", key)
+		}
 	}
 	return reply.NewIntReply(int64(result))
 }
+
+// HScan 增量遍历哈希表中的字段和值，语义与SCAN相同
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func HScan(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	cursor, options, errReply := parseScanArgs(args[1:], false, true)
+	if errReply != nil {
+		return errReply
+	}
+	data, errReply := getAsDict(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if data == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = data.Scan(cursor, options.count, func(field string, val any) bool {
+		if options.match(field) {
+			result = append(result, []byte(field))
+			if !options.noValues {
+				result = append(result, val.([]byte))
+			}
+		}
+		return true
+	})
+	return makeScanReply(cursor, result)
+}
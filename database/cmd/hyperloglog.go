@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"goRedis/database"
+	interdb "goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/meta/hyperloglog"
+	"goRedis/resp/reply"
+)
+
+func init() {
+	database.RegisterCommand("pfadd", PFAdd, database.WriteFirstKey, -2)
+	database.RegisterCommand("pfcount", PFCount, database.WriteAllKeys, -2)
+	database.RegisterCommand("pfmerge", PFMerge, database.WriteFirstKeyReadRest, -2)
+}
+
+// getAsHyperLogLog 获取key对应的HyperLogLog，key不存在时返回nil。HyperLogLog以字符串的形式存储
+func getAsHyperLogLog(db *database.RedisDb, key string) (*hyperloglog.HyperLogLog, resp.Reply) {
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if value == nil {
+		return nil, nil
+	}
+	hll, err := hyperloglog.Load(value)
+	if err != nil {
+		return nil, reply.NewStandardErrReply(err.Error())
+	}
+	return hll, nil
+}
+
+// PFAdd 将元素添加到HyperLogLog中，key不存在时创建，基数估计值可能发生变化时返回1，否则返回0
+// PFADD key [element ...]
+func PFAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	hll, errReply := getAsHyperLogLog(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	created := false
+	if hll == nil {
+		hll = hyperloglog.New()
+		created = true
+	}
+	changed, err := hll.Add(args[1:]...)
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	if !created && !changed {
+		return reply.NewIntReply(0)
+	}
+	db.PutEntity(key, interdb.NewDataEntity(hll.Bytes())) // 稀疏编码重新编码后底层数组会发生变化
+	db.AddAof(utils.ToCmdLine3("pfadd", args...))
+	db.Notify(database.NotifyString, "pfadd", key)
+	return reply.NewIntReply(1)
+}
+
+// PFCount 返回HyperLogLog的基数估计值，指定多个key时返回它们并集的基数估计值
+// PFCOUNT key [key ...]
+func PFCount(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) == 1 { // 单个key时使用并更新头部缓存的基数
+		hll, errReply := getAsHyperLogLog(db, string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if hll == nil {
+			return reply.NewIntReply(0)
+		}
+		count, err := hll.Count()
+		if err != nil {
+			return reply.NewStandardErrReply(err.Error())
+		}
+		return reply.NewIntReply(count)
+	}
+	hlls, errReply := getAsHyperLogLogs(db, args)
+	if errReply != nil {
+		return errReply
+	}
+	count, err := hyperloglog.CountUnion(hlls...)
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	return reply.NewIntReply(count)
+}
+
+// PFMerge 将多个HyperLogLog合并到destkey中，destkey已经存在时也参与合并
+// PFMERGE destkey [sourcekey ...]
+func PFMerge(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	hlls, errReply := getAsHyperLogLogs(db, args)
+	if errReply != nil {
+		return errReply
+	}
+	merged, err := hyperloglog.Merge(hlls...)
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	db.PutEntity(dest, interdb.NewDataEntity(merged.Bytes()))
+	db.AddAof(utils.ToCmdLine3("pfmerge", args...))
+	db.Notify(database.NotifyString, "pfadd", dest)
+	return reply.NewOkReply()
+}
+
+// getAsHyperLogLogs 获取多个key对应的HyperLogLog，忽略不存在的key
+func getAsHyperLogLogs(db *database.RedisDb, keys [][]byte) ([]*hyperloglog.HyperLogLog, resp.Reply) {
+	hlls := make([]*hyperloglog.HyperLogLog, 0, len(keys))
+	for _, key := range keys {
+		hll, errReply := getAsHyperLogLog(db, string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if hll != nil {
+			hlls = append(hlls, hll)
+		}
+	}
+	return hlls, nil
+}
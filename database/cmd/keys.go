@@ -2,29 +2,67 @@ package cmd
 
 import (
 	"goRedis/database"
+	idatabase "goRedis/interface/database"
+	idict "goRedis/interface/meta/dict"
 	"goRedis/interface/resp"
 	"goRedis/lib/utils"
 	"goRedis/lib/wildcard"
+	"goRedis/meta/list"
+	"goRedis/meta/set"
+	"goRedis/meta/sortedset"
+	"goRedis/meta/stream"
 	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
-	database.RegisterCommand("del", Del, -2)
-	database.RegisterCommand("exists", Exists, -2)
-	database.RegisterCommand("flushdb", FlushDb, -1)
-	database.RegisterCommand("type", Type, 2)
-	database.RegisterCommand("rename", Rename, 3)
-	database.RegisterCommand("renamenx", RenameNX, 3)
-	database.RegisterCommand("keys", Keys, 2)
+	database.RegisterCommand("del", Del, database.WriteAllKeys, -2)
+	database.RegisterCommand("exists", Exists, database.ReadAllKeys, -2)
+	database.RegisterCommand("flushdb", FlushDb, nil, -1)
+	database.RegisterCommand("type", Type, database.ReadFirstKey, 2)
+	database.RegisterCommand("rename", Rename, database.WriteFirstTwoKeys, 3)
+	database.RegisterCommand("renamenx", RenameNX, database.WriteFirstTwoKeys, 3)
+	database.RegisterCommand("keys", Keys, nil, 2)
+	database.RegisterCommand("scan", Scan, nil, -2)
+	database.RegisterCommand("object", Object, objectKeys, -2)
+}
+
+// keysAfterNumKeys 解析numkeys key [key ...]形式的参数，args[i]为numkeys，numkeys不合法时返回nil
+func keysAfterNumKeys(args [][]byte, i int) []string {
+	if i >= len(args) {
+		return nil
+	}
+	n, err := strconv.Atoi(string(args[i]))
+	if err != nil || n <= 0 || i+1+n > len(args) {
+		return nil
+	}
+	keys := make([]string, n)
+	for j := range keys {
+		keys[j] = string(args[i+1+j])
+	}
+	return keys
+}
+
+// objectKeys OBJECT subcommand key
+func objectKeys(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
 }
 
 // Del 删除多个键值对，返回成功删除的个数
 func Del(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	keys := make([]string, len(args))
-	for i, arg := range args {
-		keys[i] = string(arg)
+	count := 0
+	for _, arg := range args {
+		key := string(arg)
+		if db.RemoveAll(key) > 0 {
+			count++
+			db.Notify(database.NotifyGeneric, "del", key)
+		}
 	}
-	count := db.RemoveAll(keys...)
 	if count > 0 {
 		db.AddAof(utils.ToCmdLine3("del", args...))
 	}
@@ -44,24 +82,18 @@ func Exists(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Re
 
 // FlushDb 清空数据库 TODO: 参数：SYNC同步刷新数据库，ASYNC异步刷新数据库
 func FlushDb(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	db.Close()
+	db.Flush()
 	db.AddAof(utils.ToCmdLine3("flushdb", args...))
 	return reply.NewOkReply()
 }
 
-// Type 返回存储在key的值的类型的字符串表示，可以返回的不同类型有：string、list、set、zset、hash
+// Type 返回存储在key的值的类型的字符串表示，可以返回的不同类型有：string、list、set、zset、hash、stream，key不存在时返回none
 func Type(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	entity, existed := db.GetEntity(string(args[0]))
+	entity, existed := db.PeekEntity(string(args[0]))
 	if !existed {
 		return reply.NewStatusReply("none")
 	}
-	switch entity.Data.(type) {
-	case []byte:
-		return reply.NewStatusReply("string")
-		// TODO: 其他类型
-	default:
-		return reply.NewUnknownErrReply()
-	}
+	return reply.NewStatusReply(typeName(entity))
 }
 
 // Rename 重命名一个key，如果新key已经存在，则进行覆盖
@@ -72,9 +104,17 @@ func Rename(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Re
 	if !exists {
 		return reply.NewStandardErrReply("no such key")
 	}
-	db.PutEntity(dest, entity)
+	expireAt, hasTTL := db.GetExpireTime(src)
 	db.Remove(src)
+	db.Remove(dest) // 同时清除dest原有的过期时间
+	db.PutEntity(dest, entity)
+	if hasTTL { // 过期时间随key一起转移
+		db.Expire(dest, expireAt)
+	}
 	db.AddAof(utils.ToCmdLine3("rename", args...))
+	db.Notify(database.NotifyGeneric, "rename_from", src)
+	db.Notify(database.NotifyGeneric, "rename_to", dest)
+	db.SignalKeyReady(dest)
 	return reply.NewOkReply()
 }
 
@@ -83,7 +123,7 @@ func RenameNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.
 	src := string(args[0])
 	dest := string(args[1])
 
-	if _, ok := db.GetEntity(dest); ok { // 如果dest已经存在，不做任何操作
+	if _, ok := db.PeekEntity(dest); ok { // 如果dest已经存在，不做任何操作
 		return reply.NewIntReply(0)
 	}
 
@@ -91,9 +131,16 @@ func RenameNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.
 	if !exists {
 		return reply.NewStandardErrReply("no such key")
 	}
-	db.PutEntity(dest, entity)
+	expireAt, hasTTL := db.GetExpireTime(src)
 	db.Remove(src)
+	db.PutEntity(dest, entity)
+	if hasTTL { // 过期时间随key一起转移
+		db.Expire(dest, expireAt)
+	}
 	db.AddAof(utils.ToCmdLine3("renamenx", args...))
+	db.Notify(database.NotifyGeneric, "rename_from", src)
+	db.Notify(database.NotifyGeneric, "rename_to", dest)
+	db.SignalKeyReady(dest)
 	return reply.NewIntReply(1)
 }
 
@@ -101,7 +148,7 @@ func RenameNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.
 func Keys(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0])) // 解析通配符
 	result := make([][]byte, 0)
-	db.GetData().ForEach(func(key string, value interface{}) bool {
+	db.ForEach(func(key string, entity *idatabase.DataEntity, expiration *time.Time) bool {
 		if pattern.IsMatch(key) {
 			result = append(result, []byte(key))
 		}
@@ -109,3 +156,173 @@ func Keys(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Repl
 	})
 	return reply.NewMultiBulkReply(result)
 }
+
+// typeName 返回值的类型名称，与TYPE命令的返回值一致
+func typeName(entity *idatabase.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte:
+		return "string"
+	case *list.QuickList:
+		return "list"
+	case idict.Dict:
+		return "hash"
+	case *set.Set:
+		return "set"
+	case *sortedset.SortedSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
+	default:
+		return "none"
+	}
+}
+
+// scanOptions SCAN系列命令的可选参数
+type scanOptions struct {
+	pattern  *wildcard.Pattern // MATCH，nil表示不过滤
+	count    int               // COUNT，每次遍历的元素个数，只是一个提示，返回的元素可能更多或更少
+	typeName string            // TYPE，只用于SCAN
+	noValues bool              // NOVALUES，只用于HSCAN
+}
+
+// parseScanArgs 解析cursor [MATCH pattern] [COUNT count] [TYPE type] [NOVALUES]
+func parseScanArgs(args [][]byte, allowType bool, allowNoValues bool) (uint64, *scanOptions, resp.Reply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, nil, reply.NewStandardErrReply("ERR invalid cursor")
+	}
+	options := &scanOptions{count: 10}
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "novalues" && allowNoValues {
+			options.noValues = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return 0, nil, reply.NewSyntaxErrReply()
+		}
+		switch {
+		case option == "match":
+			if pattern := string(args[i+1]); pattern != "*" { // 匹配所有时不需要过滤
+				options.pattern = wildcard.CompilePattern(pattern)
+			}
+		case option == "count":
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return 0, nil, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return 0, nil, reply.NewSyntaxErrReply()
+			}
+			options.count = int(min(count, 1<<20))
+		case option == "type" && allowType:
+			options.typeName = strings.ToLower(string(args[i+1]))
+		default:
+			return 0, nil, reply.NewSyntaxErrReply()
+		}
+		i++
+	}
+	return cursor, options, nil
+}
+
+func (options *scanOptions) match(s string) bool {
+	return options.pattern == nil || options.pattern.IsMatch(s)
+}
+
+// makeScanReply 返回[cursor, [element ...]]
+func makeScanReply(cursor uint64, elements [][]byte) resp.Reply {
+	return reply.NewMultiRawReply([]resp.Reply{
+		reply.NewBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		reply.NewMultiBulkReply(elements),
+	})
+}
+
+// Scan 增量遍历数据库中的key，每次返回一部分key和下一次遍历的游标，游标为0时遍历结束。
+// 遍历期间一直存在的key至少会被返回一次，期间新增或删除的key可能返回也可能不返回
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func Scan(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	cursor, options, errReply := parseScanArgs(args, true, false)
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([][]byte, 0)
+	cursor = db.Scan(cursor, options.count, func(key string, entity *idatabase.DataEntity) bool {
+		if options.match(key) && (options.typeName == "" || typeName(entity) == options.typeName) {
+			keys = append(keys, []byte(key))
+		}
+		return true
+	})
+	return makeScanReply(cursor, keys)
+}
+
+// encodingName 返回值的底层编码，对应实际使用的数据结构
+func encodingName(entity *idatabase.DataEntity) string {
+	switch data := entity.Data.(type) {
+	case []byte:
+		if len(data) <= 20 { // 可以表示为64位整数的字符串
+			if n, err := strconv.ParseInt(string(data), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(data) {
+				return "int"
+			}
+		}
+		if len(data) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case *list.QuickList:
+		return "quicklist"
+	case idict.Dict, *set.Set:
+		return "hashtable"
+	case *sortedset.SortedSet:
+		return "skiplist"
+	case *stream.Stream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// Object 查看key的内部信息，不会更新key的访问时间
+// OBJECT ENCODING|REFCOUNT|IDLETIME|FREQ key
+func Object(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "help":
+		return reply.NewMultiBulkReply(utils.ToCmdLine(
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+			"HELP",
+			"    Print this help.",
+		))
+	case "encoding", "refcount", "idletime", "freq":
+	default:
+		return reply.NewStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return reply.NewStandardErrReply("ERR wrong number of arguments for 'object|" + subCommand + "' command")
+	}
+	entity, exists := db.PeekEntity(string(args[1]))
+	if !exists {
+		return reply.NewNullBulkReply()
+	}
+	switch subCommand {
+	case "encoding":
+		return reply.NewBulkReply([]byte(encodingName(entity)))
+	case "refcount": // 值不会在key之间共享
+		return reply.NewIntReply(1)
+	case "idletime":
+		return reply.NewIntReply(int64(entity.IdleTime() / time.Second))
+	default: // freq
+		return reply.NewIntReply(int64(entity.Freq()))
+	}
+}
@@ -7,210 +7,758 @@ import (
 	"goRedis/lib/utils"
 	"goRedis/meta/list"
 	"goRedis/resp/reply"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
-	database.RegisterCommand("lpush", LPush, -3)
-	database.RegisterCommand("rpush", RPush, -3)
-	database.RegisterCommand("lrange", LRange, 4)
-	database.RegisterCommand("lpop", LPop, -2)
-	database.RegisterCommand("rpop", RPop, -2)
-	database.RegisterCommand("llen", LLen, 2)
+	database.RegisterCommand("lpush", LPush, database.WriteFirstKey, -3)
+	database.RegisterCommand("rpush", RPush, database.WriteFirstKey, -3)
+	database.RegisterCommand("lpushx", LPushX, database.WriteFirstKey, -3)
+	database.RegisterCommand("rpushx", RPushX, database.WriteFirstKey, -3)
+	database.RegisterCommand("lrange", LRange, database.ReadFirstKey, 4)
+	database.RegisterCommand("lpop", LPop, database.WriteFirstKey, -2)
+	database.RegisterCommand("rpop", RPop, database.WriteFirstKey, -2)
+	database.RegisterCommand("llen", LLen, database.ReadFirstKey, 2)
+	database.RegisterCommand("lindex", LIndex, database.ReadFirstKey, 3)
+	database.RegisterCommand("lset", LSet, database.WriteFirstKey, 4)
+	database.RegisterCommand("lrem", LRem, database.WriteFirstKey, 4)
+	database.RegisterCommand("linsert", LInsert, database.WriteFirstKey, 5)
+	database.RegisterCommand("ltrim", LTrim, database.WriteFirstKey, 4)
+	database.RegisterCommand("lpos", LPos, database.ReadFirstKey, -3)
+	database.RegisterCommand("rpoplpush", RPopLPush, database.WriteFirstTwoKeys, 3)
+	database.RegisterCommand("lmove", LMove, database.WriteFirstTwoKeys, 5)
+	database.RegisterCommand("lmpop", LMPop, lmpopKeys, -4)
+	database.RegisterCommand("blpop", BLPop, database.WriteKeysExceptLast, -3)
+	database.RegisterCommand("brpop", BRPop, database.WriteKeysExceptLast, -3)
+	database.RegisterCommand("brpoplpush", BRPopLPush, database.WriteFirstTwoKeys, 4)
+	database.RegisterCommand("blmove", BLMove, database.WriteFirstTwoKeys, 6)
+	database.RegisterCommand("blmpop", BLMPop, blmpopKeys, -5)
 }
 
-// LPush 将所有指定的值插入存储在key的列表的头部。如果key不存在，则在执行推送操作之前将其创建为空列表。
-func LPush(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
+// lmpopKeys LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func lmpopKeys(args [][]byte) ([]string, []string) {
+	return keysAfterNumKeys(args, 0), nil
+}
+
+// blmpopKeys BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func blmpopKeys(args [][]byte) ([]string, []string) {
+	return keysAfterNumKeys(args, 1), nil
+}
+
+// getAsList 获取key对应的列表，key不存在时返回nil，类型不匹配时返回错误回复
+func getAsList(db *database.RedisDb, key string) (*list.QuickList, resp.Reply) {
 	entity, exists := db.GetEntity(key)
 	if !exists {
-		data := list.NewQuickList()
-		for i := 1; i < len(args); i++ {
-			data.Insert(0, args[i])
-		}
-		entity = interdb.NewDataEntity(data)
-		db.PutEntity(key, entity)
-		return reply.NewIntReply(int64(data.Len()))
+		return nil, nil
 	}
-
 	data, ok := entity.Data.(*list.QuickList)
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		return nil, reply.NewStandardErrReply("ERR type error")
 	}
-	for i := 1; i < len(args); i++ {
-		data.Insert(0, args[i])
+	return data, nil
+}
+
+// getOrInitList 获取key对应的列表，key不存在时创建一个新的列表
+func getOrInitList(db *database.RedisDb, key string) (*list.QuickList, resp.Reply) {
+	data, errReply := getAsList(db, key)
+	if errReply != nil {
+		return nil, errReply
 	}
-	db.AddAof(utils.ToCmdLine3("lpush", args...))
-	return reply.NewIntReply(int64(data.Len()))
+	if data == nil {
+		data = list.NewQuickList()
+		db.PutEntity(key, interdb.NewDataEntity(data))
+	}
+	return data, nil
+}
+
+// popFromList 从列表头部(left为true)或尾部弹出一个元素，列表为空时删除key
+func popFromList(db *database.RedisDb, key string, data *list.QuickList, left bool) []byte {
+	var val any
+	if left {
+		val = data.Remove(0)
+	} else {
+		val = data.RemoveLast()
+	}
+	if data.Len() == 0 {
+		db.Remove(key)
+	}
+	return val.([]byte)
+}
+
+// listEvent 返回从列表头部(left为true)或尾部操作时的事件名，如lpop、rpush
+func listEvent(left bool, op string) string {
+	if left {
+		return "l" + op
+	}
+	return "r" + op
+}
+
+// notifyListPop 发布弹出元素的通知，列表因此被删除时同时发布del通知
+func notifyListPop(db *database.RedisDb, key string, data *list.QuickList, left bool) {
+	db.Notify(database.NotifyList, listEvent(left, "pop"), key)
+	if data.Len() == 0 {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+// pushToList 将元素插入列表头部(left为true)或尾部
+func pushToList(data *list.QuickList, left bool, values ...[]byte) {
+	for _, value := range values {
+		if left {
+			data.Insert(0, value)
+		} else {
+			data.Add(value)
+		}
+	}
+}
+
+// LPush 将所有指定的值插入存储在key的列表的头部。如果key不存在，则在执行推送操作之前将其创建为空列表。
+func LPush(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return pushGeneric(db, "lpush", args, true, false)
 }
 
 // RPush 将所有指定的值插入存储在key的列表的尾部。如果key不存在，则在执行推送操作之前将其创建为空列表。
 func RPush(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return pushGeneric(db, "rpush", args, false, false)
+}
+
+// LPushX 仅当key存在时将值插入列表的头部
+func LPushX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return pushGeneric(db, "lpushx", args, true, true)
+}
+
+// RPushX 仅当key存在时将值插入列表的尾部
+func RPushX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return pushGeneric(db, "rpushx", args, false, true)
+}
+
+// pushGeneric 向列表插入元素，onlyExists为true时key不存在则不做任何操作
+func pushGeneric(db *database.RedisDb, cmdName string, args [][]byte, left bool, onlyExists bool) resp.Reply {
 	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		data := list.NewQuickList()
-		for i := 1; i < len(args); i++ {
-			data.Add(args[i])
-		}
-		entity = interdb.NewDataEntity(data)
-		db.PutEntity(key, entity)
-		return reply.NewIntReply(int64(data.Len()))
+	var data *list.QuickList
+	var errReply resp.Reply
+	if onlyExists {
+		data, errReply = getAsList(db, key)
+	} else {
+		data, errReply = getOrInitList(db, key)
 	}
-
-	data, ok := entity.Data.(*list.QuickList)
-	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+	if errReply != nil {
+		return errReply
 	}
-	for i := 1; i < len(args); i++ {
-		data.Add(args[i])
+	if data == nil {
+		return reply.NewIntReply(0)
 	}
-	db.AddAof(utils.ToCmdLine3("rpush", args...))
+	pushToList(data, left, args[1:]...)
+	db.AddAof(utils.ToCmdLine3(cmdName, args...))
+	db.Notify(database.NotifyList, listEvent(left, "push"), key)
+	db.SignalKeyReady(key)
 	return reply.NewIntReply(int64(data.Len()))
 }
 
 // LPop 移除并返回存储在key的列表的第一个元素,当提供可选的count参数时，回复将由最多count个元素组成，这取决于列表的长度。
 func LPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		return reply.NewEmptyMultiBulkReply()
-	}
+	return popGeneric(db, "lpop", args, true)
+}
 
-	data, ok := entity.Data.(*list.QuickList)
-	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+// RPop 移除并返回存储在key的列表的最后一个元素,当提供可选的count参数时，回复将由最多count个元素组成，这取决于列表的长度。
+func RPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return popGeneric(db, "rpop", args, false)
+}
+
+// popGeneric 从列表头部或尾部弹出元素，没有count参数时返回单个元素，否则返回数组
+func popGeneric(db *database.RedisDb, cmdName string, args [][]byte, left bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.NewSyntaxErrReply()
 	}
+	key := string(args[0])
 	count := 1
 	if len(args) == 2 {
 		var err error
 		count, err = strconv.Atoi(string(args[1]))
-		if err != nil {
-			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		if err != nil || count < 0 {
+			return reply.NewStandardErrReply("ERR value is out of range, must be positive")
 		}
 	}
-	if count < 0 {
+	data, errReply := getAsList(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewNullBulkReply()
+	}
+	result := make([][]byte, 0, min(count, data.Len()))
+	for i := 0; i < count && data.Len() > 0; i++ {
+		result = append(result, popFromList(db, key, data, left))
+	}
+	if len(result) > 0 {
+		db.AddAof(utils.ToCmdLine3(cmdName, args...))
+		notifyListPop(db, key, data, left)
+	}
+	if len(args) == 1 {
+		return reply.NewBulkReply(result[0])
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// LLen 返回存储在key的列表的长度
+func LLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(int64(data.Len()))
+}
+
+// LRange 返回列表中下标在[start, stop]范围内的元素，负数下标表示从末尾倒数
+func LRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
 		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
 	}
-	result := make([][]byte, 0)
-	for i := 0; i < count; i++ {
-		if data.Len() == 0 {
-			break
-		}
-		result = append(result, data.Remove(0).([]byte))
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
 	}
-	if len(result) == 0 {
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	from, to, ok := convertRankRange(start, stop, int64(data.Len()))
+	if !ok {
 		return reply.NewEmptyMultiBulkReply()
 	}
-	db.AddAof(utils.ToCmdLine3("lpop", args...))
+	items := data.Range(int(from), int(to))
+	result := make([][]byte, len(items))
+	for i, item := range items {
+		result[i] = item.([]byte)
+	}
 	return reply.NewMultiBulkReply(result)
 }
 
-// RPop 移除并返回存储在key的列表的最后一个元素,当提供可选的count参数时，回复将由最多count个元素组成，这取决于列表的长度。
-func RPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
+// LIndex 返回列表中指定下标的元素，负数下标表示从末尾倒数
+func LIndex(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewNullBulkReply()
+	}
+	size := data.Len()
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
 		return reply.NewNullBulkReply()
 	}
+	return reply.NewBulkReply(data.Get(index).([]byte))
+}
 
-	data, ok := entity.Data.(*list.QuickList)
+// LSet 设置列表中指定下标的元素
+func LSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewStandardErrReply("ERR no such key")
+	}
+	size := data.Len()
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return reply.NewStandardErrReply("ERR index out of range")
+	}
+	data.Set(index, args[2])
+	db.AddAof(utils.ToCmdLine3("lset", args...))
+	db.Notify(database.NotifyList, "lset", string(args[0]))
+	return reply.NewOkReply()
+}
+
+// LRem 删除列表中与element相等的元素
+// count > 0 从头到尾删除count个，count < 0 从尾到头删除|count|个，count = 0 删除所有
+func LRem(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	element := args[2]
+	data, errReply := getAsList(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	expected := func(a any) bool {
+		return utils.Equals(a, element)
+	}
+	var removed int
+	if count > 0 {
+		removed = data.RemoveByVal(expected, count)
+	} else if count < 0 {
+		removed = data.ReverseRemoveByVal(expected, -count)
+	} else {
+		removed = data.RemoveAllByVal(expected)
+	}
+	if data.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.AddAof(utils.ToCmdLine3("lrem", args...))
+		db.Notify(database.NotifyList, "lrem", key)
+		if data.Len() == 0 {
+			db.Notify(database.NotifyGeneric, "del", key)
+		}
+	}
+	return reply.NewIntReply(int64(removed))
+}
+
+// LInsert 在列表中pivot元素的前面或后面插入元素，返回插入后列表的长度，找不到pivot时返回-1
+// LINSERT key BEFORE|AFTER pivot element
+func LInsert(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+		before = false
+	default:
+		return reply.NewSyntaxErrReply()
+	}
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewIntReply(0)
+	}
+	pivot := args[2]
+	index := -1
+	data.ForEach(func(i int, v any) bool {
+		if utils.Equals(v, pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.NewIntReply(-1)
+	}
+	if !before {
+		index++
+	}
+	data.Insert(index, args[3])
+	db.AddAof(utils.ToCmdLine3("linsert", args...))
+	db.Notify(database.NotifyList, "linsert", string(args[0]))
+	db.SignalKeyReady(string(args[0]))
+	return reply.NewIntReply(int64(data.Len()))
+}
+
+// LTrim 只保留列表中下标在[start, stop]范围内的元素，范围为空时删除key
+func LTrim(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	data, errReply := getAsList(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewOkReply()
+	}
+	size := int64(data.Len())
+	from, to, ok := convertRankRange(start, stop, size)
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		db.Remove(key)
+	} else {
+		for i := int64(0); i < from; i++ {
+			data.Remove(0)
+		}
+		for i := to; i < size; i++ {
+			data.RemoveLast()
+		}
 	}
-	count := 1
-	if len(args) == 2 {
-		var err error
-		count, err = strconv.Atoi(string(args[1]))
+	db.AddAof(utils.ToCmdLine3("ltrim", args...))
+	db.Notify(database.NotifyList, "ltrim", key)
+	if !ok {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+	return reply.NewOkReply()
+}
+
+// LPos 返回列表中与element相等的元素的下标
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+// RANK为负数时从尾到头查找，COUNT为0时返回所有匹配的下标，MAXLEN限制最多比较的元素个数
+func LPos(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	element := args[1]
+	rank, count, maxLen := 1, -1, 0
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.NewSyntaxErrReply()
+		}
+		value, err := strconv.Atoi(string(args[i+1]))
 		if err != nil {
 			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
 		}
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if value == 0 {
+				return reply.NewStandardErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			if value == math.MinInt {
+				return reply.NewStandardErrReply("ERR value is out of range")
+			}
+			rank = value
+		case "count":
+			if value < 0 {
+				return reply.NewStandardErrReply("ERR COUNT can't be negative")
+			}
+			count = value
+		case "maxlen":
+			if value < 0 {
+				return reply.NewStandardErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = value
+		default:
+			return reply.NewSyntaxErrReply()
+		}
 	}
-	if count < 0 {
-		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	data, errReply := getAsList(db, string(args[0]))
+	if errReply != nil {
+		return errReply
 	}
-	result := make([][]byte, 0)
-	for i := 0; i < count; i++ {
-		if data.Len() == 0 {
+	if data == nil {
+		if count >= 0 {
+			return reply.NewEmptyMultiBulkReply()
+		}
+		return reply.NewNullBulkReply()
+	}
+
+	size := data.Len()
+	skip := rank - 1 // 需要跳过的匹配数量
+	step, index := 1, 0
+	if rank < 0 {
+		skip = -rank - 1
+		step, index = -1, size-1
+	}
+	matches := make([]int, 0)
+	for compared := 0; index >= 0 && index < size; compared++ {
+		if maxLen > 0 && compared >= maxLen {
 			break
 		}
-		result = append(result, data.Remove(data.Len()-1).([]byte))
+		if utils.Equals(data.Get(index), element) {
+			if skip > 0 {
+				skip--
+			} else {
+				matches = append(matches, index)
+				if count < 0 || (count > 0 && len(matches) == count) {
+					break
+				}
+			}
+		}
+		index += step
+	}
+	if count < 0 { // 没有COUNT参数时返回单个下标
+		if len(matches) == 0 {
+			return reply.NewNullBulkReply()
+		}
+		return reply.NewIntReply(int64(matches[0]))
 	}
-	if len(result) == 0 {
+	result := make([]resp.Reply, len(matches))
+	for i, match := range matches {
+		result[i] = reply.NewIntReply(int64(match))
+	}
+	return reply.NewMultiRawReply(result)
+}
+
+// RPopLPush 弹出source列表的最后一个元素并插入destination列表的头部
+func RPopLPush(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return moveGeneric(db, args[0], args[1], false, true)
+}
+
+// LMove 从source列表的一端弹出元素并插入destination列表的一端
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func LMove(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	srcLeft, ok := parseListDirection(args[2])
+	if !ok {
+		return reply.NewSyntaxErrReply()
+	}
+	destLeft, ok := parseListDirection(args[3])
+	if !ok {
+		return reply.NewSyntaxErrReply()
+	}
+	return moveGeneric(db, args[0], args[1], srcLeft, destLeft)
+}
+
+// parseListDirection 解析LEFT或RIGHT，LEFT返回true
+func parseListDirection(arg []byte) (left bool, ok bool) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// formatListDirection 将方向转换为LEFT或RIGHT
+func formatListDirection(left bool) []byte {
+	if left {
+		return []byte("LEFT")
+	}
+	return []byte("RIGHT")
+}
+
+// moveGeneric 将source列表一端的元素移动到destination列表的一端，source不存在时返回nil
+func moveGeneric(db *database.RedisDb, src []byte, dest []byte, srcLeft bool, destLeft bool) resp.Reply {
+	result, ok := tryMove(db, src, dest, srcLeft, destLeft)
+	if !ok {
 		return reply.NewNullBulkReply()
 	}
-	db.AddAof(utils.ToCmdLine3("rpop", args...))
-	return reply.NewMultiBulkReply(result)
+	return result
 }
 
-// LLen 返回存储在key的列表的长度
-func LLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		return reply.NewIntReply(0)
+// tryMove 尝试移动元素，source不存在时ok为false。AOF中统一记录为LMOVE
+func tryMove(db *database.RedisDb, src []byte, dest []byte, srcLeft bool, destLeft bool) (resp.Reply, bool) {
+	srcList, errReply := getAsList(db, string(src))
+	if errReply != nil {
+		return errReply, true
+	}
+	if _, errReply = getAsList(db, string(dest)); errReply != nil {
+		return errReply, true
+	}
+	if srcList == nil {
+		return nil, false
+	}
+	value := popFromList(db, string(src), srcList, srcLeft)
+	destList, _ := getOrInitList(db, string(dest)) // source与destination相同且弹出后为空时需要重新创建
+	pushToList(destList, destLeft, value)
+	db.AddAof(utils.ToCmdLine3("lmove", src, dest, formatListDirection(srcLeft), formatListDirection(destLeft)))
+	if string(src) == string(dest) { // 同一个列表弹出后立即插入，不视为删除
+		db.Notify(database.NotifyList, listEvent(srcLeft, "pop"), string(src))
+	} else {
+		notifyListPop(db, string(src), srcList, srcLeft)
 	}
+	db.Notify(database.NotifyList, listEvent(destLeft, "push"), string(dest))
+	db.SignalKeyReady(string(dest))
+	return reply.NewBulkReply(value), true
+}
 
-	data, ok := entity.Data.(*list.QuickList)
+// LMPop 从第一个非空列表的一端弹出最多count个元素，返回列表名和弹出的元素
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func LMPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	keys, left, count, errReply := parseMPopArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	result, ok := tryMPop(db, keys, left, count)()
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		return reply.NewNullMultiBulkReply()
 	}
-	return reply.NewIntReply(int64(data.Len()))
+	return result
+}
 
+// BLPop LPOP的阻塞版本，所有列表都为空时阻塞直到有元素可以弹出或超时
+// BLPOP key [key ...] timeout
+func BLPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return blockingPopGeneric(db, args, true)
 }
 
-// LRange 遍历范围为[start,stop]
-func LRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		return reply.NewNoReply()
+// BRPop RPOP的阻塞版本，所有列表都为空时阻塞直到有元素可以弹出或超时
+// BRPOP key [key ...] timeout
+func BRPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return blockingPopGeneric(db, args, false)
+}
+
+// BRPopLPush RPOPLPUSH的阻塞版本
+// BRPOPLPUSH source destination timeout
+func BRPopLPush(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	timeout, errReply := parseBlockingTimeout(args[2])
+	if errReply != nil {
+		return errReply
 	}
-	start, err := strconv.Atoi(string(args[1]))
-	if err != nil {
-		return reply.NewStandardErrReply("ERR type error")
+	return blockingMoveGeneric(db, args[0], args[1], false, true, timeout)
+}
+
+// BLMove LMOVE的阻塞版本
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func BLMove(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	srcLeft, ok := parseListDirection(args[2])
+	if !ok {
+		return reply.NewSyntaxErrReply()
 	}
-	stop, err := strconv.Atoi(string(args[2]))
-	if err != nil {
-		return reply.NewStandardErrReply("ERR type error")
+	destLeft, ok := parseListDirection(args[3])
+	if !ok {
+		return reply.NewSyntaxErrReply()
+	}
+	timeout, errReply := parseBlockingTimeout(args[4])
+	if errReply != nil {
+		return errReply
+	}
+	return blockingMoveGeneric(db, args[0], args[1], srcLeft, destLeft, timeout)
+}
+
+// BLMPop LMPOP的阻塞版本
+// BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func BLMPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	timeout, errReply := parseBlockingTimeout(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, left, count, errReply := parseMPopArgs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	try := tryMPop(db, keys, left, count)
+	if result, ok := try(); ok {
+		return result
 	}
+	return db.Block(keys, timeout, try)
+}
 
-	data, ok := entity.Data.(*list.QuickList)
+// parseBlockingTimeout 解析以秒为单位的阻塞超时时间，0表示永久阻塞
+func parseBlockingTimeout(arg []byte) (time.Duration, resp.Reply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, reply.NewStandardErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.NewStandardErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseMPopArgs 解析numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func parseMPopArgs(args [][]byte) (keys []string, left bool, count int, errReply resp.Reply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, reply.NewStandardErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys+2 > len(args) {
+		return nil, false, 0, reply.NewSyntaxErrReply()
+	}
+	keys = make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	left, ok := parseListDirection(args[numKeys+1])
 	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+		return nil, false, 0, reply.NewSyntaxErrReply()
 	}
-	size := data.Len()
-	if start >= size {
-		return reply.NewNullBulkReply()
+	count = 1
+	options := args[numKeys+2:]
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToLower(string(options[0])) != "count" {
+			return nil, false, 0, reply.NewSyntaxErrReply()
+		}
+		count, err = strconv.Atoi(string(options[1]))
+		if err != nil || count <= 0 {
+			return nil, false, 0, reply.NewStandardErrReply("ERR count should be greater than 0")
+		}
 	}
-	start, stop = changeRange(start, stop, size)
-	items := data.Range(start, stop)
-	result := make([][]byte, len(items))
-	for i, item := range items {
-		result[i] = item.([]byte)
+	return keys, left, count, nil
+}
+
+// blockingPopGeneric BLPOP和BRPOP的实现，AOF中记录实际执行的LPOP或RPOP而不是阻塞命令
+func blockingPopGeneric(db *database.RedisDb, args [][]byte, left bool) resp.Reply {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
 	}
-	return reply.NewMultiBulkReply(result)
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = string(args[i])
+	}
+	cmdName := "rpop"
+	if left {
+		cmdName = "lpop"
+	}
+	try := func() (resp.Reply, bool) {
+		for _, key := range keys {
+			data, errReply := getAsList(db, key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if data == nil {
+				continue
+			}
+			value := popFromList(db, key, data, left)
+			db.AddAof(utils.ToCmdLine(cmdName, key))
+			notifyListPop(db, key, data, left)
+			return reply.NewMultiBulkReply([][]byte{[]byte(key), value}), true
+		}
+		return nil, false
+	}
+	if result, ok := try(); ok {
+		return result
+	}
+	return db.Block(keys, timeout, try)
 }
 
-// changeRange 将传入的下标转换为合法范围
-func changeRange(start int, stop int, size int) (int, int) {
-	if start < -1*size {
-		start = 0
-	} else if start < 0 {
-		start = size + start
+// blockingMoveGeneric BRPOPLPUSH和BLMOVE的实现，source为空时阻塞在source上
+func blockingMoveGeneric(db *database.RedisDb, src []byte, dest []byte, srcLeft bool, destLeft bool, timeout time.Duration) resp.Reply {
+	try := func() (resp.Reply, bool) {
+		return tryMove(db, src, dest, srcLeft, destLeft)
 	}
+	if result, ok := try(); ok {
+		return result
+	}
+	return db.Block([]string{string(src)}, timeout, try)
+}
 
-	if stop < -1*size {
-		stop = 0
-	} else if stop < 0 {
-		stop = size + stop + 1
-	} else if stop < size {
-		stop = stop + 1
-	} else {
-		stop = size
+// tryMPop 返回从第一个非空列表弹出元素的TryFunc，AOF中记录为带count的LPOP或RPOP
+func tryMPop(db *database.RedisDb, keys []string, left bool, count int) database.TryFunc {
+	cmdName := "rpop"
+	if left {
+		cmdName = "lpop"
 	}
-	if stop < start {
-		stop = start
+	return func() (resp.Reply, bool) {
+		for _, key := range keys {
+			data, errReply := getAsList(db, key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if data == nil {
+				continue
+			}
+			values := make([][]byte, 0, min(count, data.Len()))
+			for i := 0; i < count && data.Len() > 0; i++ {
+				values = append(values, popFromList(db, key, data, left))
+			}
+			db.AddAof(utils.ToCmdLine(cmdName, key, strconv.Itoa(len(values))))
+			notifyListPop(db, key, data, left)
+			return reply.NewMultiRawReply([]resp.Reply{
+				reply.NewBulkReply([]byte(key)),
+				reply.NewMultiBulkReply(values),
+			}), true
+		}
+		return nil, false
 	}
-	return start, stop
 }
@@ -7,8 +7,8 @@ import (
 )
 
 func init() {
-	database.RegisterCommand("ping", Ping, -1)
-	database.RegisterCommand("echo", Echo, 2)
+	database.RegisterCommand("ping", Ping, nil, -1)
+	database.RegisterCommand("echo", Echo, nil, 2)
 }
 
 // Ping 传入的args不包括命令名，只传入参数
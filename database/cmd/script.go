@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strings"
+)
+
+func init() {
+	database.RegisterCommand("eval", Eval, evalKeys, -3)
+	database.RegisterCommand("evalsha", EvalSha, evalKeys, -3)
+	database.RegisterCommand("script", Script, nil, -2)
+}
+
+// evalKeys EVAL script numkeys [key ...] [arg ...]，脚本可能修改所有声明的key
+func evalKeys(args [][]byte) ([]string, []string) {
+	keys, _, errReply := database.ScriptCmdKeys(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return database.ToKeys(keys), nil
+}
+
+// Eval EVAL script numkeys [key [key ...]] [arg [arg ...]]
+func Eval(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	keys, argv, errReply := database.ScriptCmdKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	return db.Eval(client, args[0], keys, argv)
+}
+
+// EvalSha EVALSHA sha1 numkeys [key [key ...]] [arg [arg ...]]
+func EvalSha(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	keys, argv, errReply := database.ScriptCmdKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	return db.EvalSha(client, string(args[0]), keys, argv)
+}
+
+// Script SCRIPT LOAD|EXISTS|FLUSH|KILL
+func Script(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return reply.NewArgNumErrReply("script|load")
+		}
+		sha, errReply := database.LoadScript(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		return reply.NewBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return reply.NewArgNumErrReply("script|exists")
+		}
+		result := make([]resp.Reply, len(args)-1)
+		for i, sha := range args[1:] {
+			if database.ScriptExists(string(sha)) {
+				result[i] = reply.NewIntReply(1)
+			} else {
+				result[i] = reply.NewIntReply(0)
+			}
+		}
+		return reply.NewMultiRawReply(result)
+	case "flush":
+		if len(args) > 2 {
+			return reply.NewArgNumErrReply("script|flush")
+		}
+		if len(args) == 2 { // ASYNC和SYNC效果相同
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return reply.NewStandardErrReply("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+			}
+		}
+		database.FlushScripts()
+		return reply.NewOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply("script|kill")
+		}
+		return database.KillScript()
+	default:
+		return reply.NewStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SCRIPT HELP.")
+	}
+}
@@ -7,72 +7,415 @@ import (
 	"goRedis/lib/utils"
 	"goRedis/meta/set"
 	"goRedis/resp/reply"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 func init() {
-	database.RegisterCommand("sadd", SAdd, -3)
-	database.RegisterCommand("srem", SRem, -3)
-	database.RegisterCommand("sismember", SIsMember, 3)
+	database.RegisterCommand("sadd", SAdd, database.WriteFirstKey, -3)
+	database.RegisterCommand("srem", SRem, database.WriteFirstKey, -3)
+	database.RegisterCommand("sismember", SIsMember, database.ReadFirstKey, 3)
+	database.RegisterCommand("smismember", SMIsMember, database.ReadFirstKey, -3)
+	database.RegisterCommand("smembers", SMembers, database.ReadFirstKey, 2)
+	database.RegisterCommand("scard", SCard, database.ReadFirstKey, 2)
+	database.RegisterCommand("spop", SPop, database.WriteFirstKey, -2)
+	database.RegisterCommand("srandmember", SRandMember, database.ReadFirstKey, -2)
+	database.RegisterCommand("smove", SMove, database.WriteFirstTwoKeys, 4)
+	database.RegisterCommand("sunion", SUnion, database.ReadAllKeys, -2)
+	database.RegisterCommand("sinter", SInter, database.ReadAllKeys, -2)
+	database.RegisterCommand("sdiff", SDiff, database.ReadAllKeys, -2)
+	database.RegisterCommand("sunionstore", SUnionStore, database.WriteFirstKeyReadRest, -3)
+	database.RegisterCommand("sinterstore", SInterStore, database.WriteFirstKeyReadRest, -3)
+	database.RegisterCommand("sdiffstore", SDiffStore, database.WriteFirstKeyReadRest, -3)
+	database.RegisterCommand("sintercard", SInterCard, sinterCardKeys, -3)
+	database.RegisterCommand("sscan", SScan, database.ReadFirstKey, -3)
 }
 
-// SAdd 向集合添加一个或多个成员
-func SAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
+// sinterCardKeys SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sinterCardKeys(args [][]byte) ([]string, []string) {
+	return nil, keysAfterNumKeys(args, 0)
+}
+
+// getAsSet 获取key对应的集合，key不存在时返回nil，类型不匹配时返回错误回复
+func getAsSet(db *database.RedisDb, key string) (*set.Set, resp.Reply) {
 	entity, exists := db.GetEntity(key)
 	if !exists {
-		entity = database2.NewDataEntity(set.NewSet())
-		db.PutEntity(key, entity)
+		return nil, nil
 	}
-	result := 0
-	for i, arg := range args {
-		if i == 0 {
-			continue
+	data, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, reply.NewStandardErrReply("ERR type error")
+	}
+	return data, nil
+}
+
+// getAsSets 获取多个key对应的集合，不存在的key视为空集合
+func getAsSets(db *database.RedisDb, keys [][]byte) ([]*set.Set, resp.Reply) {
+	sets := make([]*set.Set, len(keys))
+	for i, key := range keys {
+		data, errReply := getAsSet(db, string(key))
+		if errReply != nil {
+			return nil, errReply
 		}
-		data, ok := entity.Data.(*set.Set)
-		if !ok {
-			return reply.NewStandardErrReply("ERR type error")
+		if data == nil {
+			data = set.NewSet()
 		}
-		result += data.Add(string(arg))
+		sets[i] = data
+	}
+	return sets, nil
+}
+
+// SAdd 向集合添加一个或多个成员
+func SAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	data, errReply := getAsSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		data = set.NewSet()
+		db.PutEntity(key, database2.NewDataEntity(data))
+	}
+	result := 0
+	for _, member := range args[1:] {
+		result += data.Add(string(member))
+	}
+	if result > 0 {
+		db.AddAof(utils.ToCmdLine3("sadd", args...))
+		db.Notify(database.NotifySet, "sadd", key)
 	}
-	db.AddAof(utils.ToCmdLine3("sadd", args...))
 	return reply.NewIntReply(int64(result))
 }
 
-// SRem 移除集合中一个或多个成员
+// SRem 移除集合中一个或多个成员，集合为空时删除key
 func SRem(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
 	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
+	data, errReply := getAsSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
 		return reply.NewIntReply(0)
 	}
 	result := 0
-	for i, arg := range args {
-		if i == 0 {
-			continue
-		}
-		data, ok := entity.Data.(*set.Set)
-		if !ok {
-			return reply.NewStandardErrReply("ERR type error")
+	for _, member := range args[1:] {
+		result += data.Remove(string(member))
+	}
+	if data.Len() == 0 {
+		db.Remove(key)
+	}
+	if result > 0 {
+		db.AddAof(utils.ToCmdLine3("srem", args...))
+		db.Notify(database.NotifySet, "srem", key)
+		if data.Len() == 0 {
+			db.Notify(database.NotifyGeneric, "del", key)
 		}
-		result += data.Remove(string(arg))
 	}
-	db.AddAof(utils.ToCmdLine3("srem", args...))
 	return reply.NewIntReply(int64(result))
 }
 
 // SIsMember 判断成员元素是否是集合的成员
 func SIsMember(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	entity, exists := db.GetEntity(key)
-	if !exists {
-		return reply.NewIntReply(0)
-	}
-	data, ok := entity.Data.(*set.Set)
-	if !ok {
-		return reply.NewStandardErrReply("ERR type error")
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
 	}
 	if data.Has(string(args[1])) {
 		return reply.NewIntReply(1)
 	}
 	return reply.NewIntReply(0)
 }
+
+// SMIsMember 判断多个元素是否是集合的成员，返回由1和0组成的数组
+func SMIsMember(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if data.Has(string(member)) {
+			result[i] = reply.NewIntReply(1)
+		} else {
+			result[i] = reply.NewIntReply(0)
+		}
+	}
+	return reply.NewMultiRawReply(result)
+}
+
+// SMembers 返回集合中的所有成员
+func SMembers(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	return membersToReply(data.ToSlice())
+}
+
+// SCard 返回集合的成员数量
+func SCard(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.NewIntReply(int64(data.Len()))
+}
+
+// SPop 随机移除并返回集合中的一个或多个成员，AOF中记录为SREM被移除的成员
+// SPOP key [count]
+func SPop(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 {
+			return reply.NewStandardErrReply("ERR value is out of range, must be positive")
+		}
+	}
+	data, errReply := getAsSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if data == nil {
+		if len(args) == 2 {
+			return reply.NewEmptyMultiBulkReply()
+		}
+		return reply.NewNullBulkReply()
+	}
+	members := data.RandomDistinctMembers(min(count, data.Len())) // count不小于集合大小时弹出所有成员
+	for _, member := range members {
+		data.Remove(member)
+	}
+	if data.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		db.AddAof(utils.ToCmdLine2("srem", append([]string{key}, members...)...))
+		db.Notify(database.NotifySet, "spop", key)
+		if data.Len() == 0 {
+			db.Notify(database.NotifyGeneric, "del", key)
+		}
+	}
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return reply.NewNullBulkReply()
+		}
+		return reply.NewBulkReply([]byte(members[0]))
+	}
+	return membersToReply(members)
+}
+
+// SRandMember 随机返回集合中的成员，count为正数时返回不重复的成员，为负数时可能返回重复的成员
+// SRANDMEMBER key [count]
+func SRandMember(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.NewSyntaxErrReply()
+	}
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if data == nil {
+			return reply.NewNullBulkReply()
+		}
+		members := data.RandomMembers(1)
+		if len(members) == 0 {
+			return reply.NewNullBulkReply()
+		}
+		return reply.NewBulkReply([]byte(members[0]))
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if count == math.MinInt { // 与Redis相同，取反会溢出
+		return reply.NewStandardErrReply("ERR value is out of range")
+	}
+	if data == nil || count == 0 {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		return membersToReply(data.RandomDistinctMembers(min(count, data.Len())))
+	}
+	return membersToReply(data.RandomMembers(-count))
+}
+
+// SMove 将成员从源集合移动到目标集合
+// SMOVE source destination member
+func SMove(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	src, dest, member := string(args[0]), string(args[1]), string(args[2])
+	srcSet, errReply := getAsSet(db, src)
+	if errReply != nil {
+		return errReply
+	}
+	destSet, errReply := getAsSet(db, dest)
+	if errReply != nil {
+		return errReply
+	}
+	if !srcSet.Has(member) {
+		return reply.NewIntReply(0)
+	}
+	if src == dest { // 源集合与目标集合相同时不做任何修改
+		return reply.NewIntReply(1)
+	}
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	if destSet == nil {
+		destSet = set.NewSet()
+		db.PutEntity(dest, database2.NewDataEntity(destSet))
+	}
+	destSet.Add(member)
+	db.AddAof(utils.ToCmdLine3("smove", args...))
+	db.Notify(database.NotifySet, "srem", src)
+	if srcSet.Len() == 0 {
+		db.Notify(database.NotifyGeneric, "del", src)
+	}
+	db.Notify(database.NotifySet, "sadd", dest)
+	return reply.NewIntReply(1)
+}
+
+// SUnion 返回多个集合的并集
+func SUnion(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebra(db, args, set.Union)
+}
+
+// SInter 返回多个集合的交集
+func SInter(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebra(db, args, set.Intersect)
+}
+
+// SDiff 返回第一个集合与其他集合的差集
+func SDiff(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebra(db, args, set.Diff)
+}
+
+// SUnionStore 将多个集合的并集保存到destination中
+// SUNIONSTORE destination key [key ...]
+func SUnionStore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebraStore(db, args, "sunionstore", set.Union)
+}
+
+// SInterStore 将多个集合的交集保存到destination中
+// SINTERSTORE destination key [key ...]
+func SInterStore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebraStore(db, args, "sinterstore", set.Intersect)
+}
+
+// SDiffStore 将第一个集合与其他集合的差集保存到destination中
+// SDIFFSTORE destination key [key ...]
+func SDiffStore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return setAlgebraStore(db, args, "sdiffstore", set.Diff)
+}
+
+// SInterCard 返回多个集合交集的元素个数，指定LIMIT时数量达到limit即停止计算
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func SInterCard(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return reply.NewStandardErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys <= 0 {
+		return reply.NewStandardErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return reply.NewStandardErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	limit := 0
+	options := args[numKeys+1:]
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToLower(string(options[0])) != "limit" {
+			return reply.NewSyntaxErrReply()
+		}
+		limit, err = strconv.Atoi(string(options[1]))
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return reply.NewStandardErrReply("ERR LIMIT can't be negative")
+		}
+	}
+	sets, errReply := getAsSets(db, args[1:numKeys+1])
+	if errReply != nil {
+		return errReply
+	}
+	return reply.NewIntReply(int64(set.IntersectCount(limit, sets...)))
+}
+
+// setAlgebra 对多个集合进行集合运算并返回结果
+func setAlgebra(db *database.RedisDb, keys [][]byte, operation func(sets ...*set.Set) *set.Set) resp.Reply {
+	sets, errReply := getAsSets(db, keys)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToReply(operation(sets...).ToSlice())
+}
+
+// setAlgebraStore 对多个集合进行集合运算并将结果保存到args[0]中，结果为空时删除目标key。
+// AOF中记录为DEL加上按字典序排列成员的SADD，保证重放结果与运算结果一致，event为键空间通知的事件名
+func setAlgebraStore(db *database.RedisDb, args [][]byte, event string, operation func(sets ...*set.Set) *set.Set) resp.Reply {
+	dest := string(args[0])
+	sets, errReply := getAsSets(db, args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := operation(sets...)
+	removed := db.Remove(dest)
+	db.AddAof(utils.ToCmdLine("del", dest))
+	if result.Len() == 0 {
+		if removed > 0 {
+			db.Notify(database.NotifyGeneric, "del", dest)
+		}
+		return reply.NewIntReply(0)
+	}
+	db.PutEntity(dest, database2.NewDataEntity(result))
+	members := result.ToSlice()
+	sort.Strings(members)
+	db.AddAof(utils.ToCmdLine2("sadd", append([]string{dest}, members...)...))
+	db.Notify(database.NotifySet, event, dest)
+	return reply.NewIntReply(int64(result.Len()))
+}
+
+// membersToReply 将成员列表转换为数组回复
+func membersToReply(members []string) resp.Reply {
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// SScan 增量遍历集合中的成员，语义与SCAN相同
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func SScan(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	cursor, options, errReply := parseScanArgs(args[1:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+	data, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if data == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = data.Scan(cursor, options.count, func(member string) bool {
+		if options.match(member) {
+			result = append(result, []byte(member))
+		}
+		return true
+	})
+	return makeScanReply(cursor, result)
+}
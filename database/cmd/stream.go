@@ -0,0 +1,1479 @@
+package cmd
+
+import (
+	"goRedis/database"
+	interdb "goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/meta/stream"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	database.RegisterCommand("xadd", XAdd, database.WriteFirstKey, -5)
+	database.RegisterCommand("xlen", XLen, database.ReadFirstKey, 2)
+	database.RegisterCommand("xrange", XRange, database.ReadFirstKey, -4)
+	database.RegisterCommand("xrevrange", XRevRange, database.ReadFirstKey, -4)
+	database.RegisterCommand("xdel", XDel, database.WriteFirstKey, -3)
+	database.RegisterCommand("xtrim", XTrim, database.WriteFirstKey, -4)
+	database.RegisterCommand("xsetid", XSetID, database.WriteFirstKey, -3)
+	database.RegisterCommand("xread", XRead, xreadKeys, -4)
+	database.RegisterCommand("xgroup", XGroup, xgroupKeys, -2)
+	database.RegisterCommand("xreadgroup", XReadGroup, xreadGroupKeys, -7)
+	database.RegisterCommand("xack", XAck, database.WriteFirstKey, -4)
+	database.RegisterCommand("xpending", XPending, database.ReadFirstKey, -3)
+	database.RegisterCommand("xclaim", XClaim, database.WriteFirstKey, -6)
+	database.RegisterCommand("xautoclaim", XAutoClaim, database.WriteFirstKey, -6)
+	database.RegisterCommand("xinfo", XInfo, xinfoKeys, -2)
+}
+
+// xreadKeys XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func xreadKeys(args [][]byte) ([]string, []string) {
+	options, errReply := parseStreamReadOptions("xread", args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, options.keys
+}
+
+// xreadGroupKeys XREADGROUP会修改消费者组的状态，所有key都需要加写锁
+func xreadGroupKeys(args [][]byte) ([]string, []string) {
+	options, errReply := parseStreamReadOptions("xreadgroup", args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return options.keys, nil
+}
+
+// xgroupKeys XGROUP subcommand key ...
+func xgroupKeys(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+// xinfoKeys XINFO subcommand key ...
+func xinfoKeys(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+// getAsStream 获取key对应的流，key不存在时返回nil
+func getAsStream(db *database.RedisDb, key string) (*stream.Stream, resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, reply.NewStandardErrReply("ERR type error")
+	}
+	return s, nil
+}
+
+// getStreamGroup 获取key对应的流以及其中的消费者组，任意一个不存在时返回NOGROUP错误
+func getStreamGroup(db *database.RedisDb, key string, groupName string) (*stream.Stream, *stream.Group, resp.Reply) {
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	var group *stream.Group
+	if s != nil {
+		group = s.GetGroup(groupName)
+	}
+	if group == nil {
+		return nil, nil, reply.NewStandardErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'")
+	}
+	return s, group, nil
+}
+
+// parseStreamID 解析完整的ID，只有毫秒部分时序号为0
+func parseStreamID(arg []byte) (stream.ID, resp.Reply) {
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return stream.ID{}, reply.NewStandardErrReply(err.Error())
+	}
+	return id, nil
+}
+
+// parseRangeID 解析范围查询的边界，支持-、+以及表示开区间的(前缀。
+// 只有毫秒部分时，作为起点序号取0，作为终点序号取最大值。开区间无法转换为闭区间时ok为false
+func parseRangeID(arg []byte, isStart bool) (id stream.ID, ok bool, errReply resp.Reply) {
+	s := string(arg)
+	switch s {
+	case "-":
+		return stream.MinID, true, nil
+	case "+":
+		return stream.MaxID, true, nil
+	}
+	exclude := strings.HasPrefix(s, "(")
+	if exclude {
+		s = s[1:]
+	}
+	defaultSeq := uint64(0)
+	if !isStart {
+		defaultSeq = stream.MaxID.Seq
+	}
+	id, err := stream.ParseID(s, defaultSeq)
+	if err != nil {
+		return id, false, reply.NewStandardErrReply(err.Error())
+	}
+	if exclude {
+		if isStart {
+			id, ok = id.Next()
+		} else {
+			id, ok = id.Prev()
+		}
+		if !ok {
+			return id, false, nil
+		}
+	}
+	return id, true, nil
+}
+
+// parseBlockTimeout 解析以毫秒为单位的BLOCK超时时间，0表示永久阻塞
+func parseBlockTimeout(arg []byte) (time.Duration, resp.Reply) {
+	ms, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.NewStandardErrReply("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return 0, reply.NewStandardErrReply("ERR timeout is negative")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func nowMs() uint64 {
+	return uint64(time.Now().UnixMilli())
+}
+
+// entryToReply 将消息转换为[id, [field, value, ...]]，消息已被删除时field部分为nil
+func entryToReply(id stream.ID, entry *stream.Entry) resp.Reply {
+	if entry == nil {
+		return reply.NewMultiRawReply([]resp.Reply{
+			reply.NewBulkReply([]byte(id.String())),
+			reply.NewNullMultiBulkReply(),
+		})
+	}
+	return reply.NewMultiRawReply([]resp.Reply{
+		reply.NewBulkReply([]byte(id.String())),
+		reply.NewMultiBulkReply(entry.Fields),
+	})
+}
+
+func entriesToReply(entries []*stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryToReply(entry.ID, entry)
+	}
+	return reply.NewMultiRawReply(replies)
+}
+
+// streamTrimOptions MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrimOptions struct {
+	byMinID bool
+	maxLen  int64
+	minID   stream.ID
+	approx  bool
+	limit   int64
+}
+
+// parseStreamTrimOptions 从args[i]开始解析裁剪参数，返回解析结束的位置。args[i]不是MAXLEN或MINID时返回nil
+func parseStreamTrimOptions(args [][]byte, i int) (*streamTrimOptions, int, resp.Reply) {
+	strategy := strings.ToLower(string(args[i]))
+	if strategy != "maxlen" && strategy != "minid" {
+		return nil, i, nil
+	}
+	options := &streamTrimOptions{byMinID: strategy == "minid"}
+	i++
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		options.approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, i, reply.NewSyntaxErrReply()
+	}
+	if options.byMinID {
+		id, errReply := parseStreamID(args[i])
+		if errReply != nil {
+			return nil, i, errReply
+		}
+		options.minID = id
+	} else {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return nil, i, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, i, reply.NewStandardErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		options.maxLen = maxLen
+	}
+	i++
+	if i+1 < len(args) && strings.ToLower(string(args[i])) == "limit" {
+		if !options.approx {
+			return nil, i, reply.NewStandardErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || limit < 0 {
+			return nil, i, reply.NewStandardErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		options.limit = limit
+		i += 2
+	}
+	return options, i, nil
+}
+
+// trimStream 裁剪流，返回删除的消息数。删除了消息时，AOF中记录为精确的MAXLEN裁剪，保证重放结果一致
+func trimStream(db *database.RedisDb, key string, s *stream.Stream, options *streamTrimOptions) int64 {
+	var removed int64
+	if options.byMinID {
+		removed = s.TrimByMinID(options.minID, options.approx, options.limit)
+	} else {
+		removed = s.TrimByLen(options.maxLen, options.approx, options.limit)
+	}
+	if removed > 0 {
+		db.AddAof(utils.ToCmdLine("xtrim", key, "maxlen", "=", strconv.FormatInt(s.Len(), 10)))
+		db.Notify(database.NotifyStream, "xtrim", key)
+	}
+	return removed
+}
+
+// XAdd 向流中添加消息，返回消息ID，AOF中记录实际生成的ID
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func XAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trimOptions *streamTrimOptions
+	i := 1
+	for ; i < len(args); i++ {
+		if strings.ToLower(string(args[i])) == "nomkstream" {
+			noMkStream = true
+			continue
+		}
+		options, next, errReply := parseStreamTrimOptions(args, i)
+		if errReply != nil {
+			return errReply
+		}
+		if options == nil {
+			break
+		}
+		trimOptions = options
+		i = next - 1
+	}
+	if i >= len(args) {
+		return reply.NewSyntaxErrReply()
+	}
+	rawID := string(args[i])
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return reply.NewArgNumErrReply("xadd")
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil && noMkStream {
+		return reply.NewNullBulkReply()
+	}
+	var lastID stream.ID
+	if s != nil {
+		lastID = s.LastID()
+	} else {
+		s = stream.NewStream()
+	}
+
+	var id stream.ID
+	var ok bool
+	switch {
+	case rawID == "*":
+		if id, ok = s.NextID(nowMs()); !ok {
+			return reply.NewStandardErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+	case strings.HasSuffix(rawID, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(rawID, "-*"), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply(stream.ErrInvalidID.Error())
+		}
+		if id, ok = s.NextSeqID(ms); !ok {
+			return reply.NewStandardErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	default:
+		var errReply resp.Reply
+		if id, errReply = parseStreamID([]byte(rawID)); errReply != nil {
+			return errReply
+		}
+		if id.IsZero() {
+			return reply.NewStandardErrReply("ERR The ID specified in XADD must be greater than 0-0")
+		}
+		if !lastID.Less(id) {
+			return reply.NewStandardErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+
+	if _, exists := db.PeekEntity(key); !exists {
+		db.PutEntity(key, interdb.NewDataEntity(s))
+	}
+	s.Add(id, fields)
+	idBytes := []byte(id.String())
+	db.AddAof(utils.ToCmdLine3("xadd", append([][]byte{args[0], idBytes}, fields...)...))
+	db.Notify(database.NotifyStream, "xadd", key)
+	if trimOptions != nil {
+		trimStream(db, key, s, trimOptions)
+	}
+	db.SignalKeyReady(key)
+	return reply.NewBulkReply(idBytes)
+}
+
+// XLen 返回流中的消息数
+func XLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	s, errReply := getAsStream(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(s.Len())
+}
+
+// XRange 返回ID在[start, end]范围内的消息
+// XRANGE key start end [COUNT count]
+func XRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return xrangeGeneric(db, args[0], args[1], args[2], args[3:], false)
+}
+
+// XRevRange 与XRANGE相同，但是按ID递减的顺序返回
+// XREVRANGE key end start [COUNT count]
+func XRevRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return xrangeGeneric(db, args[0], args[2], args[1], args[3:], true)
+}
+
+func xrangeGeneric(db *database.RedisDb, key []byte, rawStart []byte, rawEnd []byte, options [][]byte, reverse bool) resp.Reply {
+	count := -1
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToLower(string(options[0])) != "count" {
+			return reply.NewSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			n = 0
+		}
+		count = int(n)
+	}
+	start, startOk, errReply := parseRangeID(rawStart, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, endOk, errReply := parseRangeID(rawEnd, false)
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := getAsStream(db, string(key))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || !startOk || !endOk || count == 0 {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	if count < 0 {
+		count = 0
+	}
+	return entriesToReply(s.Range(start, end, count, reverse))
+}
+
+// XDel 删除指定ID的消息，返回实际删除的消息数
+// XDEL key id [id ...]
+func XDel(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	s, errReply := getAsStream(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.AddAof(utils.ToCmdLine3("xdel", args...))
+		db.Notify(database.NotifyStream, "xdel", string(args[0]))
+	}
+	return reply.NewIntReply(int64(deleted))
+}
+
+// XTrim 裁剪流，返回删除的消息数
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func XTrim(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	options, next, errReply := parseStreamTrimOptions(args, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if options == nil || next != len(args) {
+		return reply.NewSyntaxErrReply()
+	}
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(trimStream(db, key, s, options))
+}
+
+// XSetID 设置流的最后生成的ID以及元信息，用于AOF重写时恢复已被删除的消息留下的状态
+// XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+func XSetID(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	lastID, errReply := parseStreamID(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	entriesAdded := int64(-1)
+	var maxDeletedID *stream.ID
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.NewSyntaxErrReply()
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "entriesadded":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n < 0 {
+				return reply.NewStandardErrReply("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case "maxdeletedid":
+			id, errReply := parseStreamID(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			maxDeletedID = &id
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	if maxDeletedID != nil && lastID.Less(*maxDeletedID) {
+		return reply.NewStandardErrReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+	}
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewStandardErrReply("ERR no such key")
+	}
+	if entriesAdded >= 0 && entriesAdded < s.Len() {
+		return reply.NewStandardErrReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	if last := s.Last(); last != nil && lastID.Less(last.ID) {
+		return reply.NewStandardErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	s.SetLastID(lastID)
+	if entriesAdded >= 0 {
+		s.SetEntriesAdded(entriesAdded)
+	}
+	if maxDeletedID != nil {
+		s.SetMaxDeletedID(*maxDeletedID)
+	}
+	db.AddAof(utils.ToCmdLine3("xsetid", args...))
+	db.Notify(database.NotifyStream, "xsetid", key)
+	return reply.NewOkReply()
+}
+
+// streamReadOptions XREAD和XREADGROUP的公共参数
+type streamReadOptions struct {
+	count    int // 0表示不限制
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	rawIDs   [][]byte
+	group    string
+	consumer string
+}
+
+// parseStreamReadOptions 解析[COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamReadOptions(cmdName string, args [][]byte, isGroup bool) (*streamReadOptions, resp.Reply) {
+	options := &streamReadOptions{}
+	i := 0
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "count":
+			if i+1 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 0 {
+				count = 0
+			}
+			options.count = int(count)
+			i++
+		case "block":
+			if i+1 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			timeout, errReply := parseBlockTimeout(args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.block = true
+			options.timeout = timeout
+			i++
+		case "noack":
+			if !isGroup {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.noAck = true
+		case "group":
+			if !isGroup || i+2 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.group = string(args[i+1])
+			options.consumer = string(args[i+2])
+			i += 2
+		case "streams":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, reply.NewStandardErrReply("ERR Unbalanced '" + cmdName +
+					"' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			n := len(rest) / 2
+			options.keys = make([]string, n)
+			for j := 0; j < n; j++ {
+				options.keys[j] = string(rest[j])
+			}
+			options.rawIDs = rest[n:]
+			return options, nil
+		default:
+			return nil, reply.NewSyntaxErrReply()
+		}
+	}
+	return nil, reply.NewSyntaxErrReply()
+}
+
+// streamReadResult 一个流的读取结果
+type streamReadResult struct {
+	key     string
+	entries resp.Reply
+}
+
+func streamReadResultsToReply(results []streamReadResult) resp.Reply {
+	replies := make([]resp.Reply, len(results))
+	for i, result := range results {
+		replies[i] = reply.NewMultiRawReply([]resp.Reply{
+			reply.NewBulkReply([]byte(result.key)),
+			result.entries,
+		})
+	}
+	return reply.NewMultiRawReply(replies)
+}
+
+// XRead 读取多个流中ID大于指定ID的消息，指定BLOCK时如果没有新消息则阻塞等待
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func XRead(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options, errReply := parseStreamReadOptions("xread", args, false)
+	if errReply != nil {
+		return errReply
+	}
+	// $表示调用时流的最后一个ID，需要在阻塞之前确定
+	ids := make([]stream.ID, len(options.keys))
+	for i, rawID := range options.rawIDs {
+		switch string(rawID) {
+		case "$":
+			s, errReply := getAsStream(db, options.keys[i])
+			if errReply != nil {
+				return errReply
+			}
+			if s != nil {
+				ids[i] = s.LastID()
+			}
+		case ">":
+			return reply.NewStandardErrReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, errReply := parseStreamID(rawID)
+			if errReply != nil {
+				return errReply
+			}
+			ids[i] = id
+		}
+	}
+	try := func() (resp.Reply, bool) {
+		var results []streamReadResult
+		for i, key := range options.keys {
+			s, errReply := getAsStream(db, key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if s == nil {
+				continue
+			}
+			start, ok := ids[i].Next()
+			if !ok {
+				continue
+			}
+			entries := s.Range(start, stream.MaxID, options.count, false)
+			if len(entries) > 0 {
+				results = append(results, streamReadResult{key: key, entries: entriesToReply(entries)})
+			}
+		}
+		if len(results) == 0 {
+			return nil, false
+		}
+		return streamReadResultsToReply(results), true
+	}
+	if result, ok := try(); ok {
+		return result
+	}
+	if !options.block {
+		return reply.NewNullMultiBulkReply()
+	}
+	return db.Block(options.keys, options.timeout, try)
+}
+
+// XReadGroup 以消费者组中某个消费者的身份读取消息。ID为>时读取从未投递给组内消费者的新消息并加入待确认列表，
+// 否则读取该消费者ID大于指定ID的待确认消息。AOF中将投递记录为XCLAIM和XGROUP SETID，保证消费者组的状态可以恢复
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func XReadGroup(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options, errReply := parseStreamReadOptions("xreadgroup", args, true)
+	if errReply != nil {
+		return errReply
+	}
+	if options.group == "" {
+		return reply.NewSyntaxErrReply()
+	}
+	ids := make([]stream.ID, len(options.keys))
+	onlyNew := true // 只读取新消息时才会阻塞
+	for i, rawID := range options.rawIDs {
+		if string(rawID) == ">" {
+			continue
+		}
+		onlyNew = false
+		id, errReply := parseStreamID(rawID)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	for _, key := range options.keys {
+		if _, _, errReply := getStreamGroup(db, key, options.group); errReply != nil {
+			return reply.NewStandardErrReply("NOGROUP No such key '" + key + "' or consumer group '" +
+				options.group + "' in XREADGROUP with GROUP option")
+		}
+	}
+	try := func() (resp.Reply, bool) {
+		var results []streamReadResult
+		for i, key := range options.keys {
+			s, group, errReply := getStreamGroup(db, key, options.group)
+			if errReply != nil {
+				return errReply, true
+			}
+			consumer := getOrCreateStreamConsumer(db, key, group, options.consumer)
+			if string(options.rawIDs[i]) == ">" {
+				entries := readNewStreamEntries(db, key, s, group, consumer, options)
+				if len(entries) > 0 {
+					results = append(results, streamReadResult{key: key, entries: entriesToReply(entries)})
+				}
+				continue
+			}
+			results = append(results, streamReadResult{
+				key:     key,
+				entries: readPendingStreamEntries(db, key, s, group, consumer, ids[i], options.count),
+			})
+		}
+		if len(results) == 0 {
+			return nil, false
+		}
+		return streamReadResultsToReply(results), true
+	}
+	if result, ok := try(); ok {
+		return result
+	}
+	if !options.block || !onlyNew {
+		return reply.NewNullMultiBulkReply()
+	}
+	return db.Block(options.keys, options.timeout, try)
+}
+
+// getOrCreateStreamConsumer 获取消费者，不存在时创建，并更新最后一次尝试读取的时间
+func getOrCreateStreamConsumer(db *database.RedisDb, key string, group *stream.Group, name string) *stream.Consumer {
+	now := time.Now()
+	consumer, created := group.CreateConsumer(name, now)
+	if created {
+		db.AddAof(utils.ToCmdLine("xgroup", "createconsumer", key, group.Name, name))
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+	return consumer
+}
+
+// readNewStreamEntries 读取从未投递给组内消费者的新消息，更新组的最后投递ID，不是NOACK时加入待确认列表
+func readNewStreamEntries(db *database.RedisDb, key string, s *stream.Stream, group *stream.Group,
+	consumer *stream.Consumer, options *streamReadOptions) []*stream.Entry {
+	start, ok := group.LastID.Next()
+	if !ok {
+		return nil
+	}
+	entries := s.Range(start, stream.MaxID, options.count, false)
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		s.MarkDelivered(group, entry.ID)
+		if options.noAck {
+			continue
+		}
+		pending := group.AddPending(entry.ID, consumer)
+		pending.DeliveryTime = now
+		pending.DeliveryCount = 1
+		db.AddAof(makeXClaimCmd(key, group.Name, consumer.Name, pending))
+	}
+	consumer.ActiveTime = now
+	db.AddAof(makeXGroupSetIDCmd(key, group))
+	return entries
+}
+
+// readPendingStreamEntries 读取消费者ID大于id的待确认消息，并增加它们的投递次数。已经被删除的消息只返回ID
+func readPendingStreamEntries(db *database.RedisDb, key string, s *stream.Stream, group *stream.Group,
+	consumer *stream.Consumer, id stream.ID, count int) resp.Reply {
+	now := time.Now()
+	replies := make([]resp.Reply, 0)
+	for _, pendingID := range consumer.PendingIDs() {
+		if !id.Less(pendingID) {
+			continue
+		}
+		if count > 0 && len(replies) >= count {
+			break
+		}
+		pending := group.GetPending(pendingID)
+		pending.DeliveryTime = now
+		pending.DeliveryCount++
+		db.AddAof(makeXClaimCmd(key, group.Name, consumer.Name, pending))
+		replies = append(replies, entryToReply(pendingID, s.Get(pendingID)))
+	}
+	return reply.NewMultiRawReply(replies)
+}
+
+// makeXClaimCmd 生成将待确认消息的状态原样恢复的XCLAIM命令
+func makeXClaimCmd(key string, group string, consumer string, pending *stream.PendingEntry) [][]byte {
+	return utils.ToCmdLine("xclaim", key, group, consumer, "0", pending.ID.String(),
+		"time", strconv.FormatInt(pending.DeliveryTime.UnixMilli(), 10),
+		"retrycount", strconv.FormatInt(pending.DeliveryCount, 10), "force", "justid")
+}
+
+// makeXGroupSetIDCmd 生成恢复消费者组最后投递ID和已读消息数的XGROUP SETID命令
+func makeXGroupSetIDCmd(key string, group *stream.Group) [][]byte {
+	return utils.ToCmdLine("xgroup", "setid", key, group.Name, group.LastID.String(),
+		"entriesread", strconv.FormatInt(group.EntriesRead, 10))
+}
+
+// XGroup 管理消费者组
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func XGroup(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	if subCommand == "help" {
+		return reply.NewMultiBulkReply(utils.ToCmdLine(
+			"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CREATE <key> <groupname> <id|$> [MKSTREAM] [ENTRIESREAD entries_read]",
+			"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+			"DESTROY <key> <groupname>",
+			"CREATECONSUMER <key> <groupname> <consumer>",
+			"DELCONSUMER <key> <groupname> <consumer>",
+			"HELP",
+		))
+	}
+	argCount := map[string]int{"create": 4, "setid": 4, "destroy": 3, "createconsumer": 4, "delconsumer": 4}
+	minArgs, ok := argCount[subCommand]
+	if !ok {
+		return reply.NewStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if len(args) < minArgs || (subCommand != "create" && subCommand != "setid" && len(args) != minArgs) {
+		return reply.NewStandardErrReply("ERR wrong number of arguments for 'xgroup|" + subCommand + "' command")
+	}
+	key := string(args[1])
+	groupName := string(args[2])
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	mkStream := false
+	entriesRead := int64(-1)
+	entriesReadGiven := false
+	if subCommand == "create" || subCommand == "setid" {
+		for i := 4; i < len(args); i++ {
+			switch strings.ToLower(string(args[i])) {
+			case "mkstream":
+				if subCommand != "create" {
+					return reply.NewSyntaxErrReply()
+				}
+				mkStream = true
+			case "entriesread":
+				if i+1 >= len(args) {
+					return reply.NewSyntaxErrReply()
+				}
+				n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+				if err != nil || n < -1 {
+					return reply.NewStandardErrReply("ERR value for ENTRIESREAD must be positive or -1")
+				}
+				entriesRead = n
+				entriesReadGiven = true
+				i++
+			default:
+				return reply.NewSyntaxErrReply()
+			}
+		}
+	}
+	if s == nil {
+		if subCommand == "create" && mkStream {
+			s = stream.NewStream()
+			db.PutEntity(key, interdb.NewDataEntity(s))
+		} else {
+			return reply.NewStandardErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+				"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+	}
+
+	switch subCommand {
+	case "create", "setid":
+		var id stream.ID
+		if string(args[3]) == "$" {
+			id = s.LastID()
+			if !entriesReadGiven {
+				entriesRead = s.EntriesAdded()
+			}
+		} else {
+			id, errReply = parseStreamID(args[3])
+			if errReply != nil {
+				return errReply
+			}
+		}
+		if subCommand == "create" {
+			group := s.CreateGroup(groupName, id, entriesRead)
+			if group == nil {
+				return reply.NewStandardErrReply("BUSYGROUP Consumer Group name already exists")
+			}
+			db.AddAof(utils.ToCmdLine("xgroup", "create", key, groupName, id.String(), "mkstream",
+				"entriesread", strconv.FormatInt(entriesRead, 10)))
+			db.Notify(database.NotifyStream, "xgroup-create", key)
+			return reply.NewOkReply()
+		}
+		group := s.GetGroup(groupName)
+		if group == nil {
+			return reply.NewStandardErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+		}
+		group.LastID = id
+		group.EntriesRead = entriesRead
+		db.AddAof(makeXGroupSetIDCmd(key, group))
+		db.Notify(database.NotifyStream, "xgroup-setid", key)
+		return reply.NewOkReply()
+	case "destroy":
+		if !s.DestroyGroup(groupName) {
+			return reply.NewIntReply(0)
+		}
+		db.AddAof(utils.ToCmdLine3("xgroup", args...))
+		db.Notify(database.NotifyStream, "xgroup-destroy", key)
+		return reply.NewIntReply(1)
+	}
+
+	group := s.GetGroup(groupName)
+	if group == nil {
+		return reply.NewStandardErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	consumerName := string(args[3])
+	if subCommand == "createconsumer" {
+		if _, created := group.CreateConsumer(consumerName, time.Now()); !created {
+			return reply.NewIntReply(0)
+		}
+		db.AddAof(utils.ToCmdLine3("xgroup", args...))
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+		return reply.NewIntReply(1)
+	}
+	pending := group.DeleteConsumer(consumerName) // delconsumer
+	if pending < 0 {
+		return reply.NewIntReply(0)
+	}
+	db.AddAof(utils.ToCmdLine3("xgroup", args...))
+	db.Notify(database.NotifyStream, "xgroup-delconsumer", key)
+	return reply.NewIntReply(int64(pending))
+}
+
+// XAck 确认消息，将其从消费者组的待确认列表中移除，返回确认成功的消息数
+// XACK key group id [id ...]
+func XAck(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	s, errReply := getAsStream(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewIntReply(0)
+	}
+	group := s.GetGroup(string(args[1]))
+	if group == nil {
+		return reply.NewIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.AddAof(utils.ToCmdLine3("xack", args...))
+	}
+	return reply.NewIntReply(int64(acked))
+}
+
+// XPending 查看消费者组的待确认消息，不指定范围时返回汇总信息
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func XPending(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	options := args[2:]
+	var minIdle time.Duration
+	if len(options) > 0 && strings.ToLower(string(options[0])) == "idle" {
+		if len(options) < 2 {
+			return reply.NewSyntaxErrReply()
+		}
+		ms, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = time.Duration(ms) * time.Millisecond
+		options = options[2:]
+		if len(options) == 0 {
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	if len(options) != 0 && len(options) != 3 && len(options) != 4 {
+		return reply.NewSyntaxErrReply()
+	}
+	var start, end stream.ID
+	var count int64
+	rangeOk := true
+	if len(options) > 0 {
+		var startOk, endOk bool
+		var errReply resp.Reply
+		if start, startOk, errReply = parseRangeID(options[0], true); errReply != nil {
+			return errReply
+		}
+		if end, endOk, errReply = parseRangeID(options[1], false); errReply != nil {
+			return errReply
+		}
+		var err error
+		if count, err = strconv.ParseInt(string(options[2]), 10, 64); err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		rangeOk = startOk && endOk
+	}
+	_, group, errReply := getStreamGroup(db, key, string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(options) == 0 { // 汇总信息
+		if group.PendingCount() == 0 {
+			return reply.NewMultiRawReply([]resp.Reply{
+				reply.NewIntReply(0), reply.NewNullBulkReply(), reply.NewNullBulkReply(), reply.NewNullMultiBulkReply(),
+			})
+		}
+		var first, last stream.ID
+		n := 0
+		group.PendingRange(stream.MinID, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			if n == 0 {
+				first = pending.ID
+			}
+			last = pending.ID
+			n++
+			return true
+		})
+		consumers := make([]resp.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			if consumer.PendingCount() == 0 {
+				continue
+			}
+			consumers = append(consumers, reply.NewMultiBulkReply([][]byte{
+				[]byte(consumer.Name), []byte(strconv.Itoa(consumer.PendingCount())),
+			}))
+		}
+		return reply.NewMultiRawReply([]resp.Reply{
+			reply.NewIntReply(int64(group.PendingCount())),
+			reply.NewBulkReply([]byte(first.String())),
+			reply.NewBulkReply([]byte(last.String())),
+			reply.NewMultiRawReply(consumers),
+		})
+	}
+
+	result := make([]resp.Reply, 0)
+	if !rangeOk || count <= 0 {
+		return reply.NewMultiRawReply(result)
+	}
+	var consumerName string
+	if len(options) == 4 {
+		consumerName = string(options[3])
+	}
+	now := time.Now()
+	group.PendingRange(start, end, func(pending *stream.PendingEntry) bool {
+		if consumerName != "" && pending.Consumer.Name != consumerName {
+			return true
+		}
+		idle := now.Sub(pending.DeliveryTime)
+		if idle < minIdle {
+			return true
+		}
+		result = append(result, reply.NewMultiRawReply([]resp.Reply{
+			reply.NewBulkReply([]byte(pending.ID.String())),
+			reply.NewBulkReply([]byte(pending.Consumer.Name)),
+			reply.NewIntReply(idle.Milliseconds()),
+			reply.NewIntReply(pending.DeliveryCount),
+		}))
+		return int64(len(result)) < count
+	})
+	return reply.NewMultiRawReply(result)
+}
+
+// xclaimOptions XCLAIM的可选参数
+type xclaimOptions struct {
+	deliveryTime time.Time
+	retryCount   int64
+	hasRetry     bool
+	force        bool
+	justID       bool
+	lastID       *stream.ID
+}
+
+// claimPending 将待确认消息转移给consumer，消息已经被删除时将其从待确认列表中移除并返回false
+func claimPending(db *database.RedisDb, key string, s *stream.Stream, group *stream.Group, consumer *stream.Consumer,
+	id stream.ID, options *xclaimOptions) (*stream.Entry, bool) {
+	entry := s.Get(id)
+	if entry == nil {
+		if group.Ack(id) {
+			db.AddAof(utils.ToCmdLine("xack", key, group.Name, id.String()))
+		}
+		return nil, false
+	}
+	pending := group.AddPending(id, consumer)
+	pending.DeliveryTime = options.deliveryTime
+	if options.hasRetry {
+		pending.DeliveryCount = options.retryCount
+	} else if !options.justID {
+		pending.DeliveryCount++
+	}
+	consumer.ActiveTime = time.Now()
+	db.AddAof(makeXClaimCmd(key, group.Name, consumer.Name, pending))
+	return entry, true
+}
+
+// XClaim 将空闲时间不小于min-idle-time的待确认消息转移给consumer
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func XClaim(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	i := 4
+	var ids []stream.ID
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return reply.NewStandardErrReply(stream.ErrInvalidID.Error())
+	}
+	now := time.Now()
+	options := &xclaimOptions{deliveryTime: now}
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "force":
+			options.force = true
+		case "justid":
+			options.justID = true
+		case "idle", "time", "retrycount":
+			if i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return reply.NewStandardErrReply("ERR Invalid " + strings.ToUpper(option) + " option argument for XCLAIM")
+			}
+			switch option {
+			case "idle":
+				options.deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+			case "time":
+				options.deliveryTime = time.UnixMilli(n)
+			default:
+				options.retryCount = n
+				options.hasRetry = true
+			}
+			i++
+		case "lastid":
+			if i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			id, errReply := parseStreamID(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			options.lastID = &id
+			i++
+		default:
+			return reply.NewStandardErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	s, group, errReply := getStreamGroup(db, key, string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if options.lastID != nil && group.LastID.Less(*options.lastID) {
+		group.LastID = *options.lastID
+		db.AddAof(makeXGroupSetIDCmd(key, group))
+	}
+	consumer, created := group.CreateConsumer(string(args[2]), now)
+	if created {
+		db.AddAof(utils.ToCmdLine("xgroup", "createconsumer", key, group.Name, consumer.Name))
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+	result := make([]resp.Reply, 0, len(ids))
+	for _, id := range ids {
+		pending := group.GetPending(id)
+		if pending == nil {
+			if !options.force || s.Get(id) == nil {
+				continue
+			}
+		} else if minIdle > 0 && now.Sub(pending.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+		entry, ok := claimPending(db, key, s, group, consumer, id, options)
+		if !ok {
+			continue
+		}
+		if options.justID {
+			result = append(result, reply.NewBulkReply([]byte(id.String())))
+		} else {
+			result = append(result, entryToReply(id, entry))
+		}
+	}
+	return reply.NewMultiRawReply(result)
+}
+
+// XAutoClaim 从start开始扫描待确认列表，将空闲时间不小于min-idle-time的消息转移给consumer。
+// 返回下一次扫描的起点、认领的消息以及已经被删除的消息ID
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func XAutoClaim(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, ok, errReply := parseRangeID(args[4], true)
+	if errReply != nil {
+		return errReply
+	}
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "count":
+			if i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n < 1 || n > 1<<20 {
+				return reply.NewStandardErrReply("ERR COUNT must be > 0")
+			}
+			count = int(n)
+			i++
+		case "justid":
+			justID = true
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	s, group, errReply := getStreamGroup(db, key, string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now()
+	consumer, created := group.CreateConsumer(string(args[2]), now)
+	if created {
+		db.AddAof(utils.ToCmdLine("xgroup", "createconsumer", key, group.Name, consumer.Name))
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+
+	// 先收集需要处理的消息，遍历待确认列表时不能修改它
+	var candidates []stream.ID
+	next := stream.MinID
+	attempts := count * 10
+	if ok {
+		group.PendingRange(start, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			if len(candidates) >= count || attempts == 0 {
+				next = pending.ID
+				return false
+			}
+			attempts--
+			if now.Sub(pending.DeliveryTime).Milliseconds() >= minIdle {
+				candidates = append(candidates, pending.ID)
+			}
+			return true
+		})
+	}
+	options := &xclaimOptions{deliveryTime: now, justID: justID}
+	claimed := make([]resp.Reply, 0, len(candidates))
+	deleted := make([][]byte, 0)
+	for _, id := range candidates {
+		entry, ok := claimPending(db, key, s, group, consumer, id, options)
+		if !ok {
+			deleted = append(deleted, []byte(id.String()))
+			continue
+		}
+		if justID {
+			claimed = append(claimed, reply.NewBulkReply([]byte(id.String())))
+		} else {
+			claimed = append(claimed, entryToReply(id, entry))
+		}
+	}
+	return reply.NewMultiRawReply([]resp.Reply{
+		reply.NewBulkReply([]byte(next.String())),
+		reply.NewMultiRawReply(claimed),
+		reply.NewMultiBulkReply(deleted),
+	})
+}
+
+// XInfo 查看流、消费者组以及消费者的信息
+// XINFO STREAM key [FULL [COUNT count]]
+// XINFO GROUPS key
+// XINFO CONSUMERS key group
+func XInfo(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "help":
+		return reply.NewMultiBulkReply(utils.ToCmdLine(
+			"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CONSUMERS <key> <groupname>",
+			"GROUPS <key>",
+			"STREAM <key> [FULL [COUNT <count>]]",
+			"HELP",
+		))
+	case "stream", "groups", "consumers":
+	default:
+		return reply.NewStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+	if len(args) < 2 || (subCommand == "groups" && len(args) != 2) || (subCommand == "consumers" && len(args) != 3) {
+		return reply.NewStandardErrReply("ERR wrong number of arguments for 'xinfo|" + subCommand + "' command")
+	}
+	key := string(args[1])
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.NewStandardErrReply("ERR no such key")
+	}
+	now := time.Now()
+	switch subCommand {
+	case "groups":
+		groups := make([]resp.Reply, 0)
+		for _, group := range s.Groups() {
+			groups = append(groups, newInfoReply(
+				"name", reply.NewBulkReply([]byte(group.Name)),
+				"consumers", reply.NewIntReply(int64(len(group.Consumers()))),
+				"pending", reply.NewIntReply(int64(group.PendingCount())),
+				"last-delivered-id", reply.NewBulkReply([]byte(group.LastID.String())),
+				"entries-read", entriesReadToReply(group.EntriesRead),
+				"lag", lagToReply(s, group),
+			))
+		}
+		return reply.NewMultiRawReply(groups)
+	case "consumers":
+		group := s.GetGroup(string(args[2]))
+		if group == nil {
+			return reply.NewStandardErrReply("NOGROUP No such consumer group '" + string(args[2]) + "' for key name '" + key + "'")
+		}
+		consumers := make([]resp.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			inactive := int64(-1)
+			if !consumer.ActiveTime.IsZero() {
+				inactive = now.Sub(consumer.ActiveTime).Milliseconds()
+			}
+			consumers = append(consumers, newInfoReply(
+				"name", reply.NewBulkReply([]byte(consumer.Name)),
+				"pending", reply.NewIntReply(int64(consumer.PendingCount())),
+				"idle", reply.NewIntReply(now.Sub(consumer.SeenTime).Milliseconds()),
+				"inactive", reply.NewIntReply(inactive),
+			))
+		}
+		return reply.NewMultiRawReply(consumers)
+	}
+
+	full := false
+	count := int64(10)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "full":
+			full = true
+		case "count":
+			if !full || i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+			}
+			count = n
+			i++
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	fields := []interface{}{
+		"length", reply.NewIntReply(s.Len()),
+		"radix-tree-keys", reply.NewIntReply(int64(s.BlockCount())),
+		"radix-tree-nodes", reply.NewIntReply(int64(s.BlockCount() + 1)),
+		"last-generated-id", reply.NewBulkReply([]byte(s.LastID().String())),
+		"max-deleted-entry-id", reply.NewBulkReply([]byte(s.MaxDeletedID().String())),
+		"entries-added", reply.NewIntReply(s.EntriesAdded()),
+		"recorded-first-entry-id", reply.NewBulkReply([]byte(s.FirstID().String())),
+	}
+	if !full {
+		fields = append(fields, "groups", reply.NewIntReply(int64(len(s.Groups()))),
+			"first-entry", optionalEntryToReply(s.First()),
+			"last-entry", optionalEntryToReply(s.Last()))
+		return newInfoReply(fields...)
+	}
+	if count <= 0 {
+		count = 0
+	}
+	fields = append(fields, "entries", entriesToReply(s.Range(stream.MinID, stream.MaxID, int(count), false)))
+	groups := make([]resp.Reply, 0)
+	for _, group := range s.Groups() {
+		pel := make([]resp.Reply, 0)
+		group.PendingRange(stream.MinID, stream.MaxID, func(pending *stream.PendingEntry) bool {
+			if count > 0 && int64(len(pel)) >= count {
+				return false
+			}
+			pel = append(pel, reply.NewMultiRawReply([]resp.Reply{
+				reply.NewBulkReply([]byte(pending.ID.String())),
+				reply.NewBulkReply([]byte(pending.Consumer.Name)),
+				reply.NewIntReply(pending.DeliveryTime.UnixMilli()),
+				reply.NewIntReply(pending.DeliveryCount),
+			}))
+			return true
+		})
+		consumers := make([]resp.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			consumerPel := make([]resp.Reply, 0)
+			for _, id := range consumer.PendingIDs() {
+				if count > 0 && int64(len(consumerPel)) >= count {
+					break
+				}
+				pending := group.GetPending(id)
+				consumerPel = append(consumerPel, reply.NewMultiRawReply([]resp.Reply{
+					reply.NewBulkReply([]byte(id.String())),
+					reply.NewIntReply(pending.DeliveryTime.UnixMilli()),
+					reply.NewIntReply(pending.DeliveryCount),
+				}))
+			}
+			activeTime := int64(-1)
+			if !consumer.ActiveTime.IsZero() {
+				activeTime = consumer.ActiveTime.UnixMilli()
+			}
+			consumers = append(consumers, newInfoReply(
+				"name", reply.NewBulkReply([]byte(consumer.Name)),
+				"seen-time", reply.NewIntReply(consumer.SeenTime.UnixMilli()),
+				"active-time", reply.NewIntReply(activeTime),
+				"pel-count", reply.NewIntReply(int64(consumer.PendingCount())),
+				"pending", reply.NewMultiRawReply(consumerPel),
+			))
+		}
+		groups = append(groups, newInfoReply(
+			"name", reply.NewBulkReply([]byte(group.Name)),
+			"last-delivered-id", reply.NewBulkReply([]byte(group.LastID.String())),
+			"entries-read", entriesReadToReply(group.EntriesRead),
+			"lag", lagToReply(s, group),
+			"pel-count", reply.NewIntReply(int64(group.PendingCount())),
+			"pending", reply.NewMultiRawReply(pel),
+			"consumers", reply.NewMultiRawReply(consumers),
+		))
+	}
+	fields = append(fields, "groups", reply.NewMultiRawReply(groups))
+	return newInfoReply(fields...)
+}
+
+// newInfoReply 将name value name value ...转换为数组回复，name为字符串，value为回复
+func newInfoReply(fields ...interface{}) resp.Reply {
+	replies := make([]resp.Reply, len(fields))
+	for i, field := range fields {
+		if name, ok := field.(string); ok && i%2 == 0 {
+			replies[i] = reply.NewBulkReply([]byte(name))
+			continue
+		}
+		replies[i] = field.(resp.Reply)
+	}
+	return reply.NewMultiRawReply(replies)
+}
+
+func optionalEntryToReply(entry *stream.Entry) resp.Reply {
+	if entry == nil {
+		return reply.NewNullBulkReply()
+	}
+	return entryToReply(entry.ID, entry)
+}
+
+func entriesReadToReply(entriesRead int64) resp.Reply {
+	if entriesRead < 0 {
+		return reply.NewNullBulkReply()
+	}
+	return reply.NewIntReply(entriesRead)
+}
+
+func lagToReply(s *stream.Stream, group *stream.Group) resp.Reply {
+	lag, ok := s.Lag(group)
+	if !ok {
+		return reply.NewNullBulkReply()
+	}
+	return reply.NewIntReply(lag)
+}
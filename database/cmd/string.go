@@ -6,14 +6,57 @@ import (
 	"goRedis/interface/resp"
 	"goRedis/lib/utils"
 	"goRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const maxStringSize = 512 * 1024 * 1024 // 字符串的最大长度512MB
+
 func init() {
-	database.RegisterCommand("get", Get, 2)
-	database.RegisterCommand("set", Set, -3)
-	database.RegisterCommand("setnx", SetNX, 3)
-	database.RegisterCommand("getset", GetSet, 3)
-	database.RegisterCommand("strlen", StrLen, 2)
+	database.RegisterCommand("get", Get, database.ReadFirstKey, 2)
+	database.RegisterCommand("set", Set, database.WriteFirstKey, -3)
+	database.RegisterCommand("setnx", SetNX, database.WriteFirstKey, 3)
+	database.RegisterCommand("getset", GetSet, database.WriteFirstKey, 3)
+	database.RegisterCommand("setex", SetEX, database.WriteFirstKey, 4)
+	database.RegisterCommand("psetex", PSetEX, database.WriteFirstKey, 4)
+	database.RegisterCommand("getex", GetEx, database.WriteFirstKey, -2)
+	database.RegisterCommand("getdel", GetDel, database.WriteFirstKey, 2)
+	database.RegisterCommand("strlen", StrLen, database.ReadFirstKey, 2)
+	database.RegisterCommand("incr", Incr, database.WriteFirstKey, 2)
+	database.RegisterCommand("decr", Decr, database.WriteFirstKey, 2)
+	database.RegisterCommand("incrby", IncrBy, database.WriteFirstKey, 3)
+	database.RegisterCommand("decrby", DecrBy, database.WriteFirstKey, 3)
+	database.RegisterCommand("incrbyfloat", IncrByFloat, database.WriteFirstKey, 3)
+	database.RegisterCommand("append", Append, database.WriteFirstKey, 3)
+	database.RegisterCommand("getrange", GetRange, database.ReadFirstKey, 4)
+	database.RegisterCommand("setrange", SetRange, database.WriteFirstKey, 4)
+	database.RegisterCommand("mget", MGet, database.ReadAllKeys, -2)
+	database.RegisterCommand("mset", MSet, msetKeys, -3)
+	database.RegisterCommand("msetnx", MSetNX, msetKeys, -3)
+}
+
+// msetKeys MSET key value [key value ...]
+func msetKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// getAsString 获取key对应的字符串，key不存在时返回nil
+func getAsString(db *database.RedisDb, key string) ([]byte, resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	value, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, reply.NewStandardErrReply("ERR type error")
+	}
+	return value, nil
 }
 
 // Get 获取key的值，如果key不存在则返回nil，如果key的值不是字符串则返回错误，字符串以[]byte形式存储
@@ -30,13 +73,153 @@ func Get(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply
 	return reply.NewBulkReply(value)
 }
 
-// Set 设置key的值为value TODO: 暂时只支持'set key value'，其他可选参数后续支持
+// setOptions SET命令的可选参数
+type setOptions struct {
+	nx       bool      // 仅当key不存在时设置
+	xx       bool      // 仅当key存在时设置
+	get      bool      // 返回key的旧值
+	keepTTL  bool      // 保留key原有的过期时间
+	expireAt time.Time // 过期时间点，零值表示不设置过期时间
+}
+
+// parseSetOptions 解析SET命令的[NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
+func parseSetOptions(cmdName string, args [][]byte) (*setOptions, resp.Reply) {
+	options := &setOptions{}
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "nx":
+			if options.xx {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.nx = true
+		case "xx":
+			if options.nx {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.xx = true
+		case "get":
+			options.get = true
+		case "keepttl":
+			if hasExpire {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			options.keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if hasExpire || options.keepTTL || i+1 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			expireAt, errReply := parseExpireAt(cmdName, option, args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.expireAt = expireAt
+			hasExpire = true
+			i++
+		default:
+			return nil, reply.NewSyntaxErrReply()
+		}
+	}
+	return options, nil
+}
+
+// parseExpireAt 将EX/PX/EXAT/PXAT参数转换为过期时间点，参数必须为正整数
+func parseExpireAt(cmdName string, unit string, arg []byte) (time.Time, resp.Reply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	invalid := reply.NewStandardErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+	switch unit {
+	case "ex", "exat":
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
+		}
+		n *= 1000
+	}
+	switch unit {
+	case "ex", "px":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, invalid
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	default:
+		return time.UnixMilli(n), nil
+	}
+}
+
+// Set 设置key的值为value，AOF中将相对过期时间记录为绝对时间的PEXPIREAT
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
 func Set(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
-	key := string(args[0])
-	value := args[1]
+	options, errReply := parseSetOptions("set", args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(db, args[0], args[1], options)
+}
+
+func setGeneric(db *database.RedisDb, rawKey []byte, value []byte, options *setOptions) resp.Reply {
+	key := string(rawKey)
+	var old []byte
+	if options.get { // 旧值不是字符串时不做修改
+		var errReply resp.Reply
+		if old, errReply = getAsString(db, key); errReply != nil {
+			return errReply
+		}
+	}
+	_, exists := db.PeekEntity(key)
+	if (options.nx && exists) || (options.xx && !exists) {
+		if old != nil {
+			return reply.NewBulkReply(old)
+		}
+		return reply.NewNullBulkReply()
+	}
 	db.PutEntity(key, interdb.NewDataEntity(value))
-	db.AddAof(utils.ToCmdLine3("set", args...))
-	return reply.NewOkReply()
+	if options.keepTTL {
+		db.AddAof(utils.ToCmdLine3("set", rawKey, value, []byte("keepttl")))
+	} else {
+		db.Persist(key) // SET会清除key原有的过期时间
+		db.AddAof(utils.ToCmdLine3("set", rawKey, value))
+		if !options.expireAt.IsZero() {
+			db.Expire(key, options.expireAt)
+			db.AddAof(makePExpireAtCmd(key, options.expireAt))
+		}
+	}
+	db.Notify(database.NotifyString, "set", key)
+	if !options.expireAt.IsZero() {
+		db.Notify(database.NotifyGeneric, "expire", key)
+	}
+	if !options.get {
+		return reply.NewOkReply()
+	}
+	if old == nil {
+		return reply.NewNullBulkReply()
+	}
+	return reply.NewBulkReply(old)
+}
+
+// SetEX 设置key的值为value，并以秒为单位设置过期时间
+// SETEX key seconds value
+func SetEX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	expireAt, errReply := parseExpireAt("setex", "ex", args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(db, args[0], args[2], &setOptions{expireAt: expireAt})
+}
+
+// PSetEX 设置key的值为value，并以毫秒为单位设置过期时间
+// PSETEX key milliseconds value
+func PSetEX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	expireAt, errReply := parseExpireAt("psetex", "px", args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(db, args[0], args[2], &setOptions{expireAt: expireAt})
 }
 
 // SetNX 设置key的值为value，如果key已经存在则不做任何操作
@@ -44,7 +227,10 @@ func SetNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Rep
 	key := string(args[0])
 	value := args[1]
 	result := db.PutIfAbsent(key, interdb.NewDataEntity(value))
-	db.AddAof(utils.ToCmdLine3("setnx", args...))
+	if result > 0 { // key已经存在时没有修改数据，不写入AOF，也不使WATCH失效
+		db.AddAof(utils.ToCmdLine3("setnx", args...))
+		db.Notify(database.NotifyString, "set", key)
+	}
 	return reply.NewIntReply(int64(result))
 }
 
@@ -52,17 +238,87 @@ func SetNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Rep
 func GetSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity, exists := db.GetEntity(key)
+	old, errReply := getAsString(db, key) // 旧值不是字符串时不做修改
+	if errReply != nil {
+		return errReply
+	}
 	db.PutEntity(key, interdb.NewDataEntity(value))
-	if !exists {
+	db.Persist(key)
+	db.AddAof(utils.ToCmdLine3("set", args...))
+	db.Notify(database.NotifyString, "set", key)
+	if old == nil {
 		return reply.NewNullBulkReply()
 	}
-	v, ok := entity.Data.([]byte)
-	if !ok { // 类型错误
-		return reply.NewStandardErrReply("type error")
+	return reply.NewBulkReply(old)
+}
+
+// GetEx 返回key的值，并修改key的过期时间
+// GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+func GetEx(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var expireAt time.Time
+	persist := false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "persist":
+			if !expireAt.IsZero() || persist {
+				return reply.NewSyntaxErrReply()
+			}
+			persist = true
+		case "ex", "px", "exat", "pxat":
+			if !expireAt.IsZero() || persist || i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			var errReply resp.Reply
+			if expireAt, errReply = parseExpireAt("getex", option, args[i+1]); errReply != nil {
+				return errReply
+			}
+			i++
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.NewNullBulkReply()
+	}
+	if persist {
+		if db.Persist(key) > 0 {
+			db.AddAof(utils.ToCmdLine("persist", key))
+			db.Notify(database.NotifyGeneric, "persist", key)
+		}
+	} else if !expireAt.IsZero() {
+		if !expireAt.After(time.Now()) { // 过期时间已经过去，直接删除key
+			db.Remove(key)
+			db.AddAof(utils.ToCmdLine("del", key))
+			db.Notify(database.NotifyGeneric, "del", key)
+		} else {
+			db.Expire(key, expireAt)
+			db.AddAof(makePExpireAtCmd(key, expireAt))
+			db.Notify(database.NotifyGeneric, "expire", key)
+		}
 	}
-	db.AddAof(utils.ToCmdLine3("getset", args...))
-	return reply.NewBulkReply(v)
+	return reply.NewBulkReply(value)
+}
+
+// GetDel 返回key的值并删除key
+func GetDel(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.NewNullBulkReply()
+	}
+	db.Remove(key)
+	db.AddAof(utils.ToCmdLine("del", key))
+	db.Notify(database.NotifyGeneric, "del", key)
+	return reply.NewBulkReply(value)
 }
 
 // StrLen 返回key的字符串值的长度
@@ -78,3 +334,230 @@ func StrLen(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Re
 	}
 	return reply.NewIntReply(int64(len(value)))
 }
+
+// Incr 将key的整数值加1，key不存在时视为0
+func Incr(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return incrGeneric(db, "incr", args, 1)
+}
+
+// Decr 将key的整数值减1，key不存在时视为0
+func Decr(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return incrGeneric(db, "decr", args, -1)
+}
+
+// IncrBy 将key的整数值加上increment
+func IncrBy(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	return incrGeneric(db, "incrby", args, delta)
+}
+
+// DecrBy 将key的整数值减去decrement
+func DecrBy(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 { // 取反后溢出
+		return reply.NewStandardErrReply("ERR decrement would overflow")
+	}
+	return incrGeneric(db, "decrby", args, -delta)
+}
+
+// incrGeneric 将key的整数值加上delta，保留key原有的过期时间
+func incrGeneric(db *database.RedisDb, cmdName string, args [][]byte, delta int64) resp.Reply {
+	key := string(args[0])
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if value != nil {
+		var err error
+		current, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return reply.NewStandardErrReply("ERR increment or decrement would overflow")
+	}
+	current += delta
+	db.PutEntity(key, interdb.NewDataEntity([]byte(strconv.FormatInt(current, 10))))
+	db.AddAof(utils.ToCmdLine3(cmdName, args...))
+	db.Notify(database.NotifyString, "incrby", key)
+	return reply.NewIntReply(current)
+}
+
+// IncrByFloat 将key的值加上浮点数increment，返回计算结果
+// 为了避免浮点运算在不同平台上的差异，AOF中记录为SET计算结果
+func IncrByFloat(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, ok := utils.ParseFloat(string(args[1]))
+	if !ok || math.IsInf(delta, 0) {
+		return reply.NewStandardErrReply("ERR value is not a valid float")
+	}
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if value != nil {
+		current, ok = utils.ParseFloat(string(value))
+		if !ok || math.IsInf(current, 0) {
+			return reply.NewStandardErrReply("ERR value is not a valid float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return reply.NewStandardErrReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(utils.FormatFloat(current))
+	db.PutEntity(key, interdb.NewDataEntity(result))
+	db.AddAof(utils.ToCmdLine3("set", args[0], result))
+	if expireAt, ok := db.GetExpireTime(key); ok { // SET会清除过期时间，需要重新设置
+		db.AddAof(makePExpireAtCmd(key, expireAt))
+	}
+	db.Notify(database.NotifyString, "incrbyfloat", key)
+	return reply.NewBulkReply(result)
+}
+
+// Append 将value追加到key的值末尾，key不存在时相当于SET，返回追加后的长度
+func Append(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(value)+len(args[1]) > maxStringSize {
+		return reply.NewStandardErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	result := make([]byte, 0, len(value)+len(args[1])) // 不能直接append，避免与其他切片共享底层数组
+	result = append(result, value...)
+	result = append(result, args[1]...)
+	db.PutEntity(key, interdb.NewDataEntity(result))
+	db.AddAof(utils.ToCmdLine3("append", args...))
+	db.Notify(database.NotifyString, "append", key)
+	return reply.NewIntReply(int64(len(result)))
+}
+
+// GetRange 返回key的值在[start, end]范围内的子串，支持负数下标
+func GetRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return reply.NewBulkReply([]byte{})
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return reply.NewBulkReply([]byte{})
+	}
+	return reply.NewBulkReply(value[start : end+1])
+}
+
+// SetRange 从offset开始用value覆盖key的值，长度不足时用0字节填充，返回修改后的长度
+func SetRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return reply.NewStandardErrReply("ERR offset is out of range")
+	}
+	value, errReply := getAsString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	patch := args[2]
+	if len(patch) == 0 { // 不做修改，key不存在时也不创建
+		return reply.NewIntReply(int64(len(value)))
+	}
+	if offset > maxStringSize-int64(len(patch)) { // 不能写成offset+len，offset接近MaxInt64时会溢出
+		return reply.NewStandardErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	size := len(value)
+	if end := int(offset) + len(patch); end > size {
+		size = end
+	}
+	result := make([]byte, size)
+	copy(result, value)
+	copy(result[offset:], patch)
+	db.PutEntity(key, interdb.NewDataEntity(result))
+	db.AddAof(utils.ToCmdLine3("setrange", args...))
+	db.Notify(database.NotifyString, "setrange", key)
+	return reply.NewIntReply(int64(len(result)))
+}
+
+// MGet 返回所有key的值，key不存在或者不是字符串时对应位置返回nil
+func MGet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		value, _ := getAsString(db, string(arg))
+		result[i] = value
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// MSet 同时设置多个key的值
+// MSET key value [key value ...]
+func MSet(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.NewArgNumErrReply("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		db.PutEntity(key, interdb.NewDataEntity(args[i+1]))
+		db.Persist(key)
+		db.Notify(database.NotifyString, "set", key)
+	}
+	db.AddAof(utils.ToCmdLine3("mset", args...))
+	return reply.NewOkReply()
+}
+
+// MSetNX 只有在所有key都不存在时才同时设置多个key的值，成功返回1，否则返回0
+// MSETNX key value [key value ...]
+func MSetNX(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.NewArgNumErrReply("msetnx")
+	}
+	for i := 0; i < len(args); i += 2 { // 先检查所有key，保证要么全部设置要么都不设置
+		if _, exists := db.PeekEntity(string(args[i])); exists {
+			return reply.NewIntReply(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		db.PutEntity(string(args[i]), interdb.NewDataEntity(args[i+1]))
+		db.Notify(database.NotifyString, "set", string(args[i]))
+	}
+	db.AddAof(utils.ToCmdLine3("msetnx", args...))
+	return reply.NewIntReply(1)
+}
@@ -0,0 +1,646 @@
+package cmd
+
+import (
+	"goRedis/database"
+	interdb "goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/meta/sortedset"
+	"goRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	database.RegisterCommand("zadd", ZAdd, database.WriteFirstKey, -4)
+	database.RegisterCommand("zrem", ZRem, database.WriteFirstKey, -3)
+	database.RegisterCommand("zscore", ZScore, database.ReadFirstKey, 3)
+	database.RegisterCommand("zmscore", ZMScore, database.ReadFirstKey, -3)
+	database.RegisterCommand("zincrby", ZIncrBy, database.WriteFirstKey, 4)
+	database.RegisterCommand("zcard", ZCard, database.ReadFirstKey, 2)
+	database.RegisterCommand("zcount", ZCount, database.ReadFirstKey, 4)
+	database.RegisterCommand("zrank", ZRank, database.ReadFirstKey, -3)
+	database.RegisterCommand("zrevrank", ZRevRank, database.ReadFirstKey, -3)
+	database.RegisterCommand("zrange", ZRange, database.ReadFirstKey, -4)
+	database.RegisterCommand("zrevrange", ZRevRange, database.ReadFirstKey, -4)
+	database.RegisterCommand("zrangebyscore", ZRangeByScore, database.ReadFirstKey, -4)
+	database.RegisterCommand("zrevrangebyscore", ZRevRangeByScore, database.ReadFirstKey, -4)
+	database.RegisterCommand("zremrangebyrank", ZRemRangeByRank, database.WriteFirstKey, 4)
+	database.RegisterCommand("zremrangebyscore", ZRemRangeByScore, database.WriteFirstKey, 4)
+	database.RegisterCommand("zscan", ZScan, database.ReadFirstKey, -3)
+}
+
+// getAsSortedSet 获取key对应的有序集合，key不存在时返回nil，类型不匹配时返回错误回复
+func getAsSortedSet(db *database.RedisDb, key string) (*sortedset.SortedSet, resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	zset, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, reply.NewStandardErrReply("ERR type error")
+	}
+	return zset, nil
+}
+
+// ZAdd 向有序集合添加成员或更新成员的分数
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func ZAdd(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+parseOptions:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+			ch = true
+		case "incr":
+			incr = true
+		default:
+			break parseOptions
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.NewSyntaxErrReply()
+	}
+	if nx && xx {
+		return reply.NewStandardErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return reply.NewStandardErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return reply.NewStandardErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	elements := make([]*sortedset.Element, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := utils.ParseFloat(string(pairs[j]))
+		if !ok {
+			return reply.NewStandardErrReply("ERR value is not a valid float")
+		}
+		elements[j/2] = &sortedset.Element{
+			Member: string(pairs[j+1]),
+			Score:  score,
+		}
+	}
+
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if xx { // XX不会创建新的key
+			if incr {
+				return reply.NewNullBulkReply()
+			}
+			return reply.NewIntReply(0)
+		}
+		zset = sortedset.NewSortedSet()
+		db.PutEntity(key, interdb.NewDataEntity(zset))
+	}
+
+	added, updated := 0, 0
+	var incrResult *float64
+	for _, element := range elements {
+		current, exists := zset.Get(element.Member)
+		if !exists {
+			if xx {
+				continue
+			}
+			zset.Add(element.Member, element.Score)
+			added++
+			score := element.Score
+			incrResult = &score
+			continue
+		}
+		if nx {
+			continue
+		}
+		score := element.Score
+		if incr {
+			score += current.Score
+			if math.IsNaN(score) {
+				return reply.NewStandardErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if (gt && score <= current.Score) || (lt && score >= current.Score) {
+			continue
+		}
+		if score != current.Score {
+			zset.Add(element.Member, score)
+			updated++
+		}
+		incrResult = &score
+	}
+	if added+updated > 0 {
+		db.AddAof(utils.ToCmdLine3("zadd", args...))
+		if incr {
+			db.Notify(database.NotifyZSet, "zincr", key)
+		} else {
+			db.Notify(database.NotifyZSet, "zadd", key)
+		}
+	}
+	if incr {
+		if incrResult == nil {
+			return reply.NewNullBulkReply()
+		}
+		return reply.NewBulkReply([]byte(utils.FormatFloat(*incrResult)))
+	}
+	if ch {
+		return reply.NewIntReply(int64(added + updated))
+	}
+	return reply.NewIntReply(int64(added))
+}
+
+// ZRem 删除有序集合中的一个或多个成员，集合为空时删除key
+func ZRem(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewIntReply(0)
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(string(member)) {
+			removed++
+		}
+	}
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.AddAof(utils.ToCmdLine3("zrem", args...))
+		notifyZSetRemove(db, "zrem", key, zset)
+	}
+	return reply.NewIntReply(int64(removed))
+}
+
+// ZScore 返回有序集合中成员的分数
+func ZScore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewNullBulkReply()
+	}
+	element, exists := zset.Get(string(args[1]))
+	if !exists {
+		return reply.NewNullBulkReply()
+	}
+	return reply.NewBulkReply([]byte(utils.FormatFloat(element.Score)))
+}
+
+// ZMScore 返回有序集合中多个成员的分数，不存在的成员对应nil
+func ZMScore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if zset == nil {
+		return reply.NewMultiBulkReply(result)
+	}
+	for i, member := range args[1:] {
+		if element, exists := zset.Get(string(member)); exists {
+			result[i] = []byte(utils.FormatFloat(element.Score))
+		}
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// ZIncrBy 为有序集合中成员的分数加上增量，成员不存在时以增量作为分数添加
+func ZIncrBy(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	increment, ok := utils.ParseFloat(string(args[1]))
+	if !ok {
+		return reply.NewStandardErrReply("ERR value is not a valid float")
+	}
+	member := string(args[2])
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		zset = sortedset.NewSortedSet()
+		db.PutEntity(key, interdb.NewDataEntity(zset))
+	}
+	score := increment
+	if element, exists := zset.Get(member); exists {
+		score += element.Score
+		if math.IsNaN(score) {
+			return reply.NewStandardErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	zset.Add(member, score)
+	db.AddAof(utils.ToCmdLine3("zincrby", args...))
+	db.Notify(database.NotifyZSet, "zincr", key)
+	return reply.NewBulkReply([]byte(utils.FormatFloat(score)))
+}
+
+// ZCard 返回有序集合的成员数量
+func ZCard(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(zset.Len())
+}
+
+// ZCount 返回分数在[min, max]范围内的成员数量
+func ZCount(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewIntReply(0)
+	}
+	return reply.NewIntReply(zset.RangeCount(min, max))
+}
+
+// ZRank 返回成员按分数从小到大的排名，排名从0开始
+// ZRANK key member [WITHSCORE]
+func ZRank(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return zrankGeneric(db, args, false)
+}
+
+// ZRevRank 返回成员按分数从大到小的排名，排名从0开始
+// ZREVRANK key member [WITHSCORE]
+func ZRevRank(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	return zrankGeneric(db, args, true)
+}
+
+func zrankGeneric(db *database.RedisDb, args [][]byte, desc bool) resp.Reply {
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToLower(string(args[2])) != "withscore" {
+			return reply.NewSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return reply.NewSyntaxErrReply()
+	}
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewNullBulkReply()
+	}
+	member := string(args[1])
+	rank, exists := zset.GetRank(member, desc)
+	if !exists {
+		return reply.NewNullBulkReply()
+	}
+	if withScore {
+		element, _ := zset.Get(member)
+		return reply.NewMultiRawReply([]resp.Reply{
+			reply.NewIntReply(rank),
+			reply.NewBulkReply([]byte(utils.FormatFloat(element.Score))),
+		})
+	}
+	return reply.NewIntReply(rank)
+}
+
+// zrangeOptions ZRANGE系列命令的查询参数
+type zrangeOptions struct {
+	byScore    bool
+	byLex      bool
+	rev        bool
+	withScores bool
+	offset     int64 // LIMIT的偏移量
+	count      int64 // LIMIT的数量，小于0表示不限制
+	hasLimit   bool
+}
+
+// ZRange 返回有序集合中指定范围内的成员
+// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func ZRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options := &zrangeOptions{count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "byscore":
+			options.byScore = true
+		case "bylex":
+			options.byLex = true
+		case "rev":
+			options.rev = true
+		case "withscores":
+			options.withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			var errReply resp.Reply
+			options.offset, options.count, errReply = parseLimit(args[i+1], args[i+2])
+			if errReply != nil {
+				return errReply
+			}
+			options.hasLimit = true
+			i += 2
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	if options.byScore && options.byLex {
+		return reply.NewSyntaxErrReply()
+	}
+	if options.hasLimit && !options.byScore && !options.byLex {
+		return reply.NewStandardErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if options.withScores && options.byLex {
+		return reply.NewStandardErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return zrangeGeneric(db, string(args[0]), args[1], args[2], options)
+}
+
+// ZRevRange 按分数从大到小返回排名在[start, stop]范围内的成员
+// ZREVRANGE key start stop [WITHSCORES]
+func ZRevRange(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options := &zrangeOptions{rev: true, count: -1}
+	if len(args) == 4 {
+		if strings.ToLower(string(args[3])) != "withscores" {
+			return reply.NewSyntaxErrReply()
+		}
+		options.withScores = true
+	} else if len(args) > 4 {
+		return reply.NewSyntaxErrReply()
+	}
+	return zrangeGeneric(db, string(args[0]), args[1], args[2], options)
+}
+
+// ZRangeByScore 按分数从小到大返回分数在[min, max]范围内的成员
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func ZRangeByScore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options, errReply := parseRangeByScoreOptions(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), args[1], args[2], options)
+}
+
+// ZRevRangeByScore 按分数从大到小返回分数在[min, max]范围内的成员
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func ZRevRangeByScore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	options, errReply := parseRangeByScoreOptions(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	options.rev = true
+	return zrangeGeneric(db, string(args[0]), args[1], args[2], options)
+}
+
+// parseRangeByScoreOptions 解析ZRANGEBYSCORE系列命令的WITHSCORES和LIMIT选项
+func parseRangeByScoreOptions(args [][]byte) (*zrangeOptions, resp.Reply) {
+	options := &zrangeOptions{byScore: true, count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			options.withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return nil, reply.NewSyntaxErrReply()
+			}
+			var errReply resp.Reply
+			options.offset, options.count, errReply = parseLimit(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			options.hasLimit = true
+			i += 2
+		default:
+			return nil, reply.NewSyntaxErrReply()
+		}
+	}
+	return options, nil
+}
+
+// parseLimit 解析LIMIT offset count
+func parseLimit(rawOffset []byte, rawCount []byte) (int64, int64, resp.Reply) {
+	offset, err := strconv.ParseInt(string(rawOffset), 10, 64)
+	if err != nil {
+		return 0, 0, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	count, err := strconv.ParseInt(string(rawCount), 10, 64)
+	if err != nil {
+		return 0, 0, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	return offset, count, nil
+}
+
+// zrangeGeneric 按排名、分数或字典序查询有序集合，rev为true时start为上界、stop为下界
+func zrangeGeneric(db *database.RedisDb, key string, start []byte, stop []byte, options *zrangeOptions) resp.Reply {
+	var min, max sortedset.Border
+	if options.byScore || options.byLex {
+		lower, upper := start, stop
+		if options.rev {
+			lower, upper = stop, start
+		}
+		var err error
+		if options.byScore {
+			min, err = sortedset.ParseScoreBorder(string(lower))
+			if err == nil {
+				max, err = sortedset.ParseScoreBorder(string(upper))
+			}
+		} else {
+			min, err = sortedset.ParseLexBorder(string(lower))
+			if err == nil {
+				max, err = sortedset.ParseLexBorder(string(upper))
+			}
+		}
+		if err != nil {
+			return reply.NewStandardErrReply(err.Error())
+		}
+	}
+	var startRank, stopRank int64
+	if !options.byScore && !options.byLex {
+		var err error
+		startRank, err = strconv.ParseInt(string(start), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+		stopRank, err = strconv.ParseInt(string(stop), 10, 64)
+		if err != nil {
+			return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+		}
+	}
+
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	var elements []*sortedset.Element
+	if options.byScore || options.byLex {
+		if options.offset < 0 { // 负数偏移量返回空结果
+			return reply.NewEmptyMultiBulkReply()
+		}
+		elements = zset.Range(min, max, options.offset, options.count, options.rev)
+	} else {
+		from, to, ok := convertRankRange(startRank, stopRank, zset.Len())
+		if !ok {
+			return reply.NewEmptyMultiBulkReply()
+		}
+		elements = zset.RangeByRank(from, to, options.rev)
+	}
+	return elementsToReply(elements, options.withScores)
+}
+
+// ZRemRangeByRank 删除排名在[start, stop]范围内的成员
+func ZRemRangeByRank(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewIntReply(0)
+	}
+	from, to, ok := convertRankRange(start, stop, zset.Len())
+	if !ok {
+		return reply.NewIntReply(0)
+	}
+	removed := zset.RemoveByRank(from, to)
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.AddAof(utils.ToCmdLine3("zremrangebyrank", args...))
+		notifyZSetRemove(db, "zremrangebyrank", key, zset)
+	}
+	return reply.NewIntReply(removed)
+}
+
+// ZRemRangeByScore 删除分数在[min, max]范围内的成员
+func ZRemRangeByScore(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	key := string(args[0])
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.NewStandardErrReply(err.Error())
+	}
+	zset, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.NewIntReply(0)
+	}
+	removed := zset.RemoveRange(min, max)
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.AddAof(utils.ToCmdLine3("zremrangebyscore", args...))
+		notifyZSetRemove(db, "zremrangebyscore", key, zset)
+	}
+	return reply.NewIntReply(removed)
+}
+
+// notifyZSetRemove 发布删除成员的通知，有序集合因此被删除时同时发布del通知
+func notifyZSetRemove(db *database.RedisDb, event string, key string, zset *sortedset.SortedSet) {
+	db.Notify(database.NotifyZSet, event, key)
+	if zset.Len() == 0 {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+// convertRankRange 将闭区间排名[start, stop]转换为左闭右开区间，负数表示从末尾倒数，范围为空时ok为false
+func convertRankRange(start int64, stop int64, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	return start, stop + 1, true
+}
+
+// elementsToReply 将有序集合元素转换为回复，withScores为true时成员和分数交替输出
+func elementsToReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	if len(elements) == 0 {
+		return reply.NewEmptyMultiBulkReply()
+	}
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(utils.FormatFloat(element.Score)))
+		}
+	}
+	return reply.NewMultiBulkReply(result)
+}
+
+// ZScan 增量遍历有序集合中的成员和分数，语义与SCAN相同
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func ZScan(client resp.Connection, db *database.RedisDb, args [][]byte) resp.Reply {
+	cursor, options, errReply := parseScanArgs(args[1:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getAsSortedSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if zset == nil {
+		return makeScanReply(0, result)
+	}
+	cursor = zset.Scan(cursor, options.count, func(element *sortedset.Element) {
+		if options.match(element.Member) {
+			result = append(result, []byte(element.Member), []byte(utils.FormatFloat(element.Score)))
+		}
+	})
+	return makeScanReply(cursor, result)
+}
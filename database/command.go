@@ -2,23 +2,107 @@ package database
 
 import (
 	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/resp/reply"
 	"strings"
 )
 
 type ExecFunc func(client resp.Connection, db *RedisDb, args [][]byte) resp.Reply // 命令执行函数，接收数据库和参数，返回RESP协议回复
-var cmdTable = make(map[string]*command)                                          // 命令名 -> command
+
+// KeysFunc 从参数(不包括命令名)中解析出命令会修改的key和只读取的key，执行命令前据此加锁。
+// 参数不合法时可以返回部分key，命令执行时会返回错误
+type KeysFunc func(args [][]byte) (writeKeys []string, readKeys []string)
+
+var cmdTable = make(map[string]*command) // 命令名 -> command
 
 type command struct {
 	name     string   // 命令名
 	execFunc ExecFunc // 命令执行函数
+	keysFunc KeysFunc // 解析命令涉及的key，为nil表示命令不涉及具体的key
 	args     int      // 参数个数
 }
 
-func RegisterCommand(name string, execFunc ExecFunc, args int) {
+func RegisterCommand(name string, execFunc ExecFunc, keysFunc KeysFunc, args int) {
 	name = strings.ToLower(name) // 命令名不区分大小写
 	cmdTable[name] = &command{
 		name:     name,
 		execFunc: execFunc,
+		keysFunc: keysFunc,
 		args:     args,
 	}
 }
+
+// lookupCommand 查找命令并校验参数个数，命令不存在或参数个数不匹配时返回错误回复
+func lookupCommand(cmdLine [][]byte) (*command, resp.ErrorReply) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok { // 未找到命令
+		return nil, reply.NewStandardErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !utils.ValidateArgs(cmdLine, cmd.args) { // 参数个数不匹配
+		return nil, reply.NewArgNumErrReply(cmdName)
+	}
+	return cmd, nil
+}
+
+// CommandKeys 返回命令涉及的所有key，命令不存在或参数个数不匹配时返回错误回复，用于集群按key转发
+func CommandKeys(cmdLine [][]byte) ([]string, resp.Reply) {
+	cmd, errReply := lookupCommand(cmdLine)
+	if errReply != nil {
+		return nil, errReply
+	}
+	writeKeys, readKeys := cmd.keys(cmdLine[1:])
+	return append(writeKeys, readKeys...), nil
+}
+
+// keys 返回命令会修改的key和只读取的key
+func (cmd *command) keys(args [][]byte) (writeKeys []string, readKeys []string) {
+	if cmd.keysFunc == nil {
+		return nil, nil
+	}
+	return cmd.keysFunc(args)
+}
+
+// ToKeys 将参数转换为key列表
+func ToKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys
+}
+
+// WriteFirstKey 第一个参数是会被修改的key
+func WriteFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+// ReadFirstKey 第一个参数是只读取的key
+func ReadFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+// WriteAllKeys 所有参数都是会被修改的key
+func WriteAllKeys(args [][]byte) ([]string, []string) {
+	return ToKeys(args), nil
+}
+
+// ReadAllKeys 所有参数都是只读取的key
+func ReadAllKeys(args [][]byte) ([]string, []string) {
+	return nil, ToKeys(args)
+}
+
+// WriteFirstTwoKeys 前两个参数是会被修改的key，如RENAME、SMOVE、LMOVE
+func WriteFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return ToKeys(args[:2]), nil
+}
+
+// WriteFirstKeyReadRest 第一个参数是写入结果的key，其余参数是只读取的key，如SUNIONSTORE
+func WriteFirstKeyReadRest(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, ToKeys(args[1:])
+}
+
+// WriteKeysExceptLast 除最后一个参数外都是会被修改的key，如BLPOP key [key ...] timeout
+func WriteKeysExceptLast(args [][]byte) ([]string, []string) {
+	return ToKeys(args[:len(args)-1]), nil
+}
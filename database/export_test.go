@@ -0,0 +1,19 @@
+package database
+
+import (
+	"goRedis/config"
+	database2 "goRedis/interface/database"
+)
+
+// NewTestDatabase 创建不加载持久化文件、不启动后台任务的数据库
+func NewTestDatabase() *StandaloneDatabase {
+	if config.Properties.Databases <= 0 {
+		config.Properties.Databases = 16
+	}
+	return newBasicDatabase()
+}
+
+// SetAddAof 替换dbIndex号库写入AOF的函数
+func (db *StandaloneDatabase) SetAddAof(dbIndex int, fn func(...database2.CmdLine) error) {
+	db.dbSet[dbIndex].SetAddAof(fn)
+}
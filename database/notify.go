@@ -0,0 +1,183 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 键空间通知的类别，与notify-keyspace-events配置中的字符一一对应
+const (
+	NotifyKeyspace = 1 << iota // K，发布到__keyspace@<db>__:<key>，消息为事件名
+	NotifyKeyevent             // E，发布到__keyevent@<db>__:<event>，消息为key
+	NotifyGeneric              // g，与类型无关的命令，如DEL、EXPIRE、RENAME
+	NotifyString               // $，字符串命令
+	NotifyList                 // l，列表命令
+	NotifySet                  // s，集合命令
+	NotifyHash                 // h，哈希命令
+	NotifyZSet                 // z，有序集合命令
+	NotifyExpired              // x，key过期被删除
+	NotifyEvicted              // e，key因内存淘汰被删除，目前没有内存淘汰，不会产生该事件
+	NotifyStream               // t，流命令
+	NotifyKeyMiss              // m，访问不存在的key
+	NotifyNew                  // n，新建key
+
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream // A，不包括m和n
+)
+
+var notifyFlagChars = []struct {
+	flag int
+	char byte
+}{
+	{NotifyGeneric, 'g'},
+	{NotifyString, '$'},
+	{NotifyList, 'l'},
+	{NotifySet, 's'},
+	{NotifyHash, 'h'},
+	{NotifyZSet, 'z'},
+	{NotifyExpired, 'x'},
+	{NotifyEvicted, 'e'},
+	{NotifyStream, 't'},
+	{NotifyKeyMiss, 'm'},
+	{NotifyNew, 'n'},
+	{NotifyKeyspace, 'K'},
+	{NotifyKeyevent, 'E'},
+}
+
+var notifyFlags atomic.Int32 // 当前生效的通知类别，为0表示关闭通知
+
+// parseNotifyFlags 解析notify-keyspace-events配置，包含未知字符时返回false
+func parseNotifyFlags(s string) (int, bool) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+		found := false
+		for _, fc := range notifyFlagChars {
+			if fc.char == s[i] {
+				flags |= fc.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return flags, true
+}
+
+// formatNotifyFlags 将通知类别转换为配置字符串，包含全部类型时使用A
+func formatNotifyFlags(flags int) string {
+	var buf strings.Builder
+	if flags&NotifyAll == NotifyAll {
+		buf.WriteByte('A')
+	}
+	for _, fc := range notifyFlagChars {
+		if flags&NotifyAll == NotifyAll && fc.flag&NotifyAll != 0 {
+			continue
+		}
+		if flags&fc.flag != 0 {
+			buf.WriteByte(fc.char)
+		}
+	}
+	return buf.String()
+}
+
+// CheckNotifyKeyspaceEvents 校验通知配置，返回规范化后的配置字符串，不修改当前配置
+func CheckNotifyKeyspaceEvents(s string) (string, bool) {
+	flags, ok := parseNotifyFlags(s)
+	if !ok {
+		return "", false
+	}
+	return formatNotifyFlags(flags), true
+}
+
+// SetNotifyKeyspaceEvents 修改通知配置，返回规范化后的配置字符串。
+// 只指定了类别而没有指定K或E时不会发布任何通知，与redis相同
+func SetNotifyKeyspaceEvents(s string) (string, bool) {
+	flags, ok := parseNotifyFlags(s)
+	if !ok {
+		return "", false
+	}
+	notifyFlags.Store(int32(flags))
+	return formatNotifyFlags(flags), true
+}
+
+// NotifyKeyspaceEvents 返回当前生效的notify-keyspace-events配置
+func NotifyKeyspaceEvents() string {
+	return formatNotifyFlags(int(notifyFlags.Load()))
+}
+
+// Notify 发布键空间通知，class为事件的类别，在修改key的命令中调用
+func (db *RedisDb) Notify(class int, event string, key string) {
+	flags := int(notifyFlags.Load())
+	if flags&class == 0 || db.publish == nil {
+		return
+	}
+	if flags&NotifyKeyspace != 0 {
+		db.publish("__keyspace@"+strconv.Itoa(db.id)+"__:"+key, event)
+	}
+	if flags&NotifyKeyevent != 0 {
+		db.publish("__keyevent@"+strconv.Itoa(db.id)+"__:"+event, key)
+	}
+}
+
+// notification 等待发布的通知
+type notification struct {
+	channel string
+	message string
+}
+
+// notifyQueue 键空间通知的发送队列。Notify在持有key锁时调用，直接写入订阅者的连接会让慢连接阻塞命令，
+// 所以先放入队列，由单独的协程按顺序发布，队列为空时协程退出
+type notifyQueue struct {
+	mu      sync.Mutex
+	pending []notification
+	running bool // 是否有协程正在发布队列中的通知
+	publish func(channel string, message string)
+}
+
+func newNotifyQueue(publish func(channel string, message string)) *notifyQueue {
+	return &notifyQueue{publish: publish}
+}
+
+// push 将通知放入队列，没有协程在发布时启动一个
+func (q *notifyQueue) push(channel string, message string) {
+	q.mu.Lock()
+	q.pending = append(q.pending, notification{channel: channel, message: message})
+	if q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.running = true
+	q.mu.Unlock()
+	go q.drain()
+}
+
+// drain 按入队顺序发布通知，直到队列为空
+func (q *notifyQueue) drain() {
+	for {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		if len(batch) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+		for _, n := range batch {
+			q.publish(n.channel, n.message)
+		}
+	}
+}
+
+// SetPublish 设置发布通知的函数
+func (db *RedisDb) SetPublish(fn func(channel string, message string)) {
+	db.publish = fn
+}
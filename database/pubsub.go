@@ -0,0 +1,48 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+)
+
+// isPubSubCommand 判断是否是发布订阅命令，发布订阅与数据库无关，由StandaloneDatabase直接处理
+func isPubSubCommand(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe", "publish", "pubsub":
+		return true
+	}
+	return false
+}
+
+// execPubSub 执行发布订阅命令
+func (db *StandaloneDatabase) execPubSub(client resp.Connection, cmdName string, args [][]byte) resp.Reply {
+	if client.InMultiState() {
+		return reply.NewStandardErrReply("ERR Command not allowed inside a transaction")
+	}
+	switch cmdName {
+	case "subscribe":
+		if len(args) < 2 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.hub.Subscribe(client, args[1:])
+	case "psubscribe":
+		if len(args) < 2 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.hub.PSubscribe(client, args[1:])
+	case "unsubscribe":
+		return db.hub.Unsubscribe(client, args[1:])
+	case "punsubscribe":
+		return db.hub.PUnsubscribe(client, args[1:])
+	case "publish":
+		if len(args) != 3 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.hub.Publish(args[1:])
+	default: // pubsub
+		if len(args) < 2 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.hub.PubSub(args[1:])
+	}
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"goRedis/aof"
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/lib/logger"
+	"goRedis/rdb"
+	"goRedis/resp/reply"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRDBFilename = "dump.rdb"
+	saveCronInterval   = time.Second     // 检查自动快照和自动重写AOF条件的间隔
+	bgsaveRetryDelay   = 5 * time.Second // 后台快照失败后，至少等待该时间才会再次自动快照
+)
+
+var errBgsaveInProgress = errors.New("ERR Background save already in progress")
+
+// saveParam 自动快照的条件：seconds秒内至少有changes次修改
+type saveParam struct {
+	seconds int64
+	changes int64
+}
+
+var saveParams atomic.Pointer[[]saveParam] // 当前生效的自动快照条件
+
+// parseSaveParams 解析save配置，格式为"seconds changes [seconds changes ...]"，空字符串表示关闭自动快照
+func parseSaveParams(s string) ([]saveParam, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 1 && fields[0] == `""` { // 配置文件中的save ""
+		fields = nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, false
+	}
+	params := make([]saveParam, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds < 1 {
+			return nil, false
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, false
+		}
+		params = append(params, saveParam{seconds: seconds, changes: changes})
+	}
+	return params, true
+}
+
+// formatSaveParams 将自动快照条件转换为配置字符串
+func formatSaveParams(params []saveParam) string {
+	fields := make([]string, 0, 2*len(params))
+	for _, param := range params {
+		fields = append(fields, strconv.FormatInt(param.seconds, 10), strconv.FormatInt(param.changes, 10))
+	}
+	return strings.Join(fields, " ")
+}
+
+// CheckSaveParams 校验save配置，返回规范化后的配置字符串，不修改当前配置
+func CheckSaveParams(s string) (string, bool) {
+	params, ok := parseSaveParams(s)
+	if !ok {
+		return "", false
+	}
+	return formatSaveParams(params), true
+}
+
+// SetSaveParams 修改自动快照条件，返回规范化后的配置字符串
+func SetSaveParams(s string) (string, bool) {
+	params, ok := parseSaveParams(s)
+	if !ok {
+		return "", false
+	}
+	saveParams.Store(&params)
+	return formatSaveParams(params), true
+}
+
+// SaveParams 返回当前生效的save配置
+func SaveParams() string {
+	params := saveParams.Load()
+	if params == nil {
+		return ""
+	}
+	return formatSaveParams(*params)
+}
+
+// rdbFilename 返回快照文件名
+func rdbFilename() string {
+	if config.Properties.RDBFilename == "" {
+		return defaultRDBFilename
+	}
+	return config.Properties.RDBFilename
+}
+
+// isPersistenceCommand 判断是否是快照和AOF重写命令，这些命令涉及所有数据库，由StandaloneDatabase直接处理
+func isPersistenceCommand(cmdName string) bool {
+	switch cmdName {
+	case "save", "bgsave", "lastsave", "bgrewriteaof":
+		return true
+	}
+	return false
+}
+
+// execPersistence 执行快照和AOF重写命令
+func (db *StandaloneDatabase) execPersistence(client resp.Connection, cmdName string, args [][]byte) resp.Reply {
+	if client.InMultiState() {
+		return reply.NewStandardErrReply("ERR Command not allowed inside a transaction")
+	}
+	if len(args) != 1 {
+		return reply.NewArgNumErrReply(cmdName)
+	}
+	switch cmdName {
+	case "save":
+		if db.bgsaving.Load() {
+			return reply.NewStandardErrReply(errBgsaveInProgress.Error())
+		}
+		if err := db.SaveRDB(); err != nil {
+			logger.Error("save rdb failed: " + err.Error())
+			return reply.NewStandardErrReply("ERR " + err.Error())
+		}
+		return reply.NewOkReply()
+	case "bgsave":
+		if err := db.BGSaveRDB(); err != nil {
+			return reply.NewStandardErrReply(err.Error())
+		}
+		return reply.NewStatusReply("Background saving started")
+	case "bgrewriteaof":
+		if db.aofHandler == nil {
+			return reply.NewStandardErrReply("ERR Append only file is disabled")
+		}
+		if err := db.aofHandler.BGRewrite(); err != nil {
+			return reply.NewStandardErrReply(err.Error())
+		}
+		return reply.NewStatusReply("Background append only file rewriting started")
+	default: // lastsave
+		return reply.NewIntReply(db.lastSave.Load())
+	}
+}
+
+// SaveRDB 在当前协程中生成快照。先写入临时文件，写入成功后再替换快照文件，
+// 保证快照文件总是完整的
+func (db *StandaloneDatabase) SaveRDB() error {
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+
+	dirty := db.dirty.Load()
+	filename := rdbFilename()
+	file, err := os.CreateTemp(filepath.Dir(filename), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	err = db.writeRDB(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	db.dirty.Add(-dirty) // 生成快照期间的修改仍然计入下一次快照
+	db.lastSave.Store(time.Now().Unix())
+	logger.Info("DB saved on disk")
+	return nil
+}
+
+// BGSaveRDB 在后台生成快照，已经有快照在生成时返回错误
+func (db *StandaloneDatabase) BGSaveRDB() error {
+	if !db.bgsaving.CompareAndSwap(false, true) {
+		return errBgsaveInProgress
+	}
+	db.lastBgsaveTry.Store(time.Now().UnixMilli())
+	go func() {
+		defer db.bgsaving.Store(false)
+		if err := db.SaveRDB(); err != nil {
+			logger.Error("background save failed: " + err.Error())
+			db.lastBgsaveOK.Store(false)
+			return
+		}
+		db.lastBgsaveOK.Store(true)
+	}()
+	return nil
+}
+
+// writeRDB 将所有数据库写入快照
+func (db *StandaloneDatabase) writeRDB(file *os.File) error {
+	return rdb.Write(file, db)
+}
+
+// loadRDB 启动时从快照恢复数据，快照文件不存在时不做任何操作
+func (db *StandaloneDatabase) loadRDB() error {
+	file, err := os.Open(rdbFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	start := time.Now()
+	if err := rdb.NewDecoder(file).Parse(db.LoadEntity); err != nil {
+		return err
+	}
+	logger.Info("DB loaded from disk in " + time.Since(start).String())
+	return nil
+}
+
+// persistenceInfo 生成INFO persistence的内容
+func (db *StandaloneDatabase) persistenceInfo() string {
+	var sb strings.Builder
+	writeField := func(name string, value any) {
+		sb.WriteString(name + ":" + fmt.Sprint(value) + "\r\n")
+	}
+	sb.WriteString("# Persistence\r\n")
+	writeField("rdb_changes_since_last_save", db.dirty.Load())
+	writeField("rdb_bgsave_in_progress", boolToInt(db.bgsaving.Load()))
+	writeField("rdb_last_save_time", db.lastSave.Load())
+	if db.lastBgsaveOK.Load() {
+		writeField("rdb_last_bgsave_status", "ok")
+	} else {
+		writeField("rdb_last_bgsave_status", "err")
+	}
+	writeField("aof_enabled", boolToInt(db.aofHandler != nil))
+	if db.aofHandler == nil {
+		return sb.String()
+	}
+	current, base := db.aofHandler.Size()
+	lastFsync, pending := db.aofHandler.LastFsync()
+	writeField("aof_rewrite_in_progress", boolToInt(db.aofHandler.IsRewriting()))
+	writeField("aof_current_size", current)
+	writeField("aof_base_size", base)
+	writeField("aof_fsync_policy", aof.FsyncPolicy())
+	writeField("aof_last_fsync_time", lastFsync)
+	writeField("aof_pending_fsync", boolToInt(pending))
+	if db.aofHandler.WriteErr() == nil {
+		writeField("aof_last_write_status", "ok")
+	} else {
+		writeField("aof_last_write_status", "err")
+	}
+	stats := db.aofHandler.QueueStats()
+	writeField("aof_queue_depth", stats.Depth)
+	writeField("aof_queue_capacity", stats.Capacity)
+	writeField("aof_queue_full_waits", stats.FullWaits)
+	writeField("aof_write_batches", stats.Batches)
+	writeField("aof_written_payloads", stats.Payloads)
+	return sb.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// startPersistenceCron 启动后台任务，满足任意一个自动快照条件时在后台生成快照，
+// 满足自动重写条件时在后台重写AOF文件
+func (db *StandaloneDatabase) startPersistenceCron() {
+	ticker := time.NewTicker(saveCronInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if db.shouldAutoSave() {
+					_ = db.BGSaveRDB()
+				}
+				if db.aofHandler != nil && db.aofHandler.NeedRewrite() {
+					logger.Info("starting automatic rewriting of AOF")
+					_ = db.aofHandler.BGRewrite()
+				}
+			case <-db.closeChan:
+				return
+			}
+		}
+	}()
+}
+
+// shouldAutoSave 判断是否满足自动快照条件，上一次后台快照失败后需要等待一段时间再重试
+func (db *StandaloneDatabase) shouldAutoSave() bool {
+	params := saveParams.Load()
+	if params == nil || db.bgsaving.Load() {
+		return false
+	}
+	now := time.Now()
+	if !db.lastBgsaveOK.Load() && now.Sub(time.UnixMilli(db.lastBgsaveTry.Load())) < bgsaveRetryDelay {
+		return false
+	}
+	dirty := db.dirty.Load()
+	elapsed := now.Unix() - db.lastSave.Load()
+	for _, param := range *params {
+		if dirty >= param.changes && elapsed > param.seconds {
+			return true
+		}
+	}
+	return false
+}
@@ -5,48 +5,177 @@ import (
 	interDict "goRedis/interface/meta/dict"
 	"goRedis/interface/resp"
 	"goRedis/lib/logger"
+	"goRedis/lib/sync/lock"
 	"goRedis/lib/utils"
 	"goRedis/meta/dict"
 	"goRedis/resp/reply"
-	"strings"
+	"time"
 )
 
-// RedisDb 缓存数据库内核
+const (
+	expireSampleSize   = 20                    // 主动过期每轮抽样的键数量
+	expireSampleRatio  = 4                     // 一轮抽样中过期键超过 1/expireSampleRatio 时继续抽样
+	expireCycleTimeout = 25 * time.Millisecond // 单次主动过期任务的最长执行时间
+	lockerSize         = 1024                  // key锁的分段数
+)
+
+// RedisDb 缓存数据库内核，由数据库的状态和写入AOF的函数组成。
+// 事务和脚本通过withAof得到共享同一份状态、但将AOF命令交给收集器的RedisDb
 type RedisDb struct {
-	id     int                    // 数据库编号
-	data   interDict.Dict         // 数据库存储的键值对
-	addAof func(database.CmdLine) // 用于添加AOF命令行的函数
+	*dbState
+	addAof  func(...database.CmdLine) error // 用于添加AOF命令行的函数，多条命令会连续写入，返回写入AOF时的错误
+	inMulti bool                            // addAof是事务的收集器，产生的命令已经会作为MULTI...EXEC的一部分写入AOF
+
+	writeKeys []string // 正在执行的命令声明要修改的key，查找这些key不存在时不是读未命中，不发布keymiss通知
+}
+
+// dbState 数据库的状态，同一个数据库的所有RedisDb共享
+type dbState struct {
+	id     int            // 数据库编号
+	data   interDict.Dict // 数据库存储的键值对
+	ttlMap interDict.Dict // 键 -> 过期时间点(time.Time)，只记录设置了过期时间的键
+
+	blocking        *blockingRegistry                    // 阻塞在key上的客户端
+	locker          *lock.Locks                          // key级别的锁，保证涉及多个key的命令的原子性
+	watches         *watchRegistry                       // 被WATCH的key的版本号
+	publish         func(channel string, message string) // 发布键空间通知的函数
+	persistenceInfo func() string                        // 生成INFO persistence的内容
+	aofWriteErr     func() error                         // 返回最近一次写入AOF失败的错误，不为nil时拒绝修改数据的命令
 }
 
 func NewRedisDb() *RedisDb {
 	return &RedisDb{
-		data:   dict.NewSyncDict(),
-		addAof: func(line database.CmdLine) {},
+		dbState: &dbState{
+			data:   dict.NewSyncDict(),
+			ttlMap: dict.NewSyncDict(),
+
+			blocking: newBlockingRegistry(),
+			locker:   lock.Make(lockerSize),
+			watches:  newWatchRegistry(),
+		},
+		addAof: func(lines ...database.CmdLine) error { return nil },
 	}
 }
 
-func (db *RedisDb) Exec(conn resp.Connection, cmdLine database.CmdLine) resp.Reply {
-	cmdName := strings.ToLower(string(cmdLine[0])) // 第一行是命令名，后面的都是参数
-	cmdName = strings.ToLower(cmdName)
-	cmd, ok := cmdTable[cmdName]
-	if !ok { // 未找到命令
-		return reply.NewStandardErrReply("ERR unknown command '" + cmdName + "'")
+// withAof 返回与db共享状态的RedisDb，在它上面执行的命令产生的AOF命令交给sink，
+// 用于收集事务和脚本产生的命令，执行完后作为一个整体写入AOF
+func (db *RedisDb) withAof(sink func(...database.CmdLine) error) *RedisDb {
+	return &RedisDb{dbState: db.dbState, addAof: sink}
+}
+
+// execTracker 记录命令执行期间是否产生了AOF命令，即是否修改了数据，以及写入AOF时的错误
+type execTracker struct {
+	modified bool
+	aofErr   error
+}
+
+// reset 清除上一次执行的记录
+func (t *execTracker) reset() {
+	t.modified = false
+	t.aofErr = nil
+}
+
+// track 返回与db共享状态的RedisDb，在它上面执行的命令产生的AOF命令照常写入db的AOF，并记录到t中
+func (db *RedisDb) track(t *execTracker) *RedisDb {
+	return db.withAof(func(lines ...database.CmdLine) error {
+		t.modified = true
+		err := db.addAof(lines...)
+		if err != nil && t.aofErr == nil {
+			t.aofErr = err
+		}
+		return err
+	})
+}
+
+// checkAofWrite 最近一次写入AOF失败时拒绝修改数据的命令，直到写入恢复正常，避免继续确认无法持久化的修改
+func (db *RedisDb) checkAofWrite() resp.Reply {
+	if db.aofWriteErr == nil {
+		return nil
 	}
-	if !utils.ValidateArgs(cmdLine, cmd.args) { // 参数个数不匹配
-		return reply.NewArgNumErrReply(cmdName)
+	if err := db.aofWriteErr(); err != nil {
+		return newAofErrReply(err)
 	}
+	return nil
+}
 
-	return cmd.execFunc(conn, db, cmdLine[1:])
+// newAofErrReply 写入AOF失败时的回复
+func newAofErrReply(err error) resp.Reply {
+	return reply.NewStandardErrReply("MISCONF Errors writing to the AOF file: " + err.Error())
 }
 
+func (db *RedisDb) Exec(conn resp.Connection, cmdLine database.CmdLine) resp.Reply {
+	cmd, errReply := lookupCommand(cmdLine)
+	if errReply != nil {
+		return errReply
+	}
+	args := cmdLine[1:] // 第一行是命令名，后面的都是参数
+	writeKeys, readKeys := cmd.keys(args)
+	if errReply := db.checkScriptBusy(writeKeys, readKeys); errReply != nil {
+		return errReply
+	}
+	if len(writeKeys) > 0 {
+		if errReply := db.checkAofWrite(); errReply != nil {
+			return errReply
+		}
+	}
+	db.lockKeys(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+	db.expireKeys(writeKeys)
+	// 只有修改了数据的命令会产生AOF命令，据此判断是否需要使WATCH失效
+	tracker := &execTracker{}
+	execDb := db.track(tracker)
+	execDb.writeKeys = writeKeys
+	result := cmd.execFunc(conn, execDb, args)
+	if blocking, ok := result.(*BlockingReply); ok { // 阻塞命令重试时需要重新加锁
+		blocking.writeKeys = writeKeys
+		blocking.readKeys = readKeys
+		blocking.tracker = tracker
+		return result
+	}
+	if tracker.modified {
+		db.touch(writeKeys...)
+	}
+	if tracker.aofErr != nil { // 修改没有写入AOF，不能向客户端确认
+		return newAofErrReply(tracker.aofErr)
+	}
+	return result
+}
+
+// GetEntity 获取key对应的数据并记录一次访问，已过期的key视为不存在。
+// 只读取的key不存在时发布keymiss通知，写命令查找要修改的key不发布
 func (db *RedisDb) GetEntity(key string) (*database.DataEntity, bool) {
+	entity, exists := db.PeekEntity(key)
+	if exists {
+		entity.Touch()
+	} else if !db.isWriteKey(key) {
+		db.Notify(NotifyKeyMiss, "keymiss", key)
+	}
+	return entity, exists
+}
+
+// isWriteKey 判断key是否是正在执行的命令声明要修改的key
+func (db *RedisDb) isWriteKey(key string) bool {
+	for _, k := range db.writeKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// PeekEntity 与GetEntity相同，但不更新key的访问时间和访问频率，用于TYPE、OBJECT等查看元信息的命令。
+// 调用者可能只持有读锁，因此不删除过期的key，删除由执行前的expireKeys或主动过期完成
+func (db *RedisDb) PeekEntity(key string) (*database.DataEntity, bool) {
+	if db.IsExpired(key) {
+		return nil, false
+	}
 	val, exists := db.data.Get(key)
 	if !exists {
 		return nil, false
 	}
 	entity, ok := val.(*database.DataEntity)
 	if !ok {
-		logger.Error("value of key %s is not DataEntity", key)
+		logger.Error("value of key " + key + " is not DataEntity")
 		return nil, false
 	}
 	return entity, true
@@ -57,18 +186,31 @@ func (db *RedisDb) GetData() interDict.Dict {
 }
 
 func (db *RedisDb) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	db.expireIfNeeded(key)
+	result := db.data.Put(key, entity)
+	if result > 0 {
+		db.Notify(NotifyNew, "new", key)
+	}
+	return result
 }
 
 func (db *RedisDb) PutIfExists(key string, entity *database.DataEntity) int {
+	db.expireIfNeeded(key)
 	return db.data.PutIfExist(key, entity)
 }
 
 func (db *RedisDb) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	db.expireIfNeeded(key)
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.Notify(NotifyNew, "new", key)
+	}
+	return result
 }
 
+// Remove 删除key及其过期时间
 func (db *RedisDb) Remove(key string) int {
+	db.ttlMap.Remove(key)
 	return db.data.Remove(key)
 }
 
@@ -76,13 +218,163 @@ func (db *RedisDb) Remove(key string) int {
 func (db *RedisDb) RemoveAll(keys ...string) int {
 	count := 0
 	for _, key := range keys {
+		if db.expireIfNeeded(key) { // 已过期的key不计入删除数量
+			continue
+		}
 		count += db.Remove(key)
 	}
 	return count
 }
 
-func (db *RedisDb) Close() error {
+// Flush 清空数据库中的所有键值对和过期时间
+func (db *RedisDb) Flush() {
 	db.data.Clear()
+	db.ttlMap.Clear()
+	db.watches.touchAll()
+}
+
+// ForEach 遍历所有未过期的键值对，expiration为nil表示该key没有设置过期时间
+func (db *RedisDb) ForEach(consumer func(key string, entity *database.DataEntity, expiration *time.Time) bool) {
+	now := time.Now()
+	db.data.ForEach(func(key string, val any) bool {
+		entity, ok := val.(*database.DataEntity)
+		if !ok {
+			return true
+		}
+		var expiration *time.Time
+		if raw, exists := db.ttlMap.Get(key); exists {
+			expireTime := raw.(time.Time)
+			if expireTime.Before(now) {
+				return true
+			}
+			expiration = &expireTime
+		}
+		return consumer(key, entity, expiration)
+	})
+}
+
+// forEachLocked 逐个对key加读锁后遍历未过期的键值对，遍历期间不会阻塞对其他key的修改。
+// 每个键值对是一致的，但不同key的值不一定来自同一时刻。返回false表示consumer中止了遍历
+func (db *RedisDb) forEachLocked(consumer func(key string, entity *database.DataEntity, expiration *time.Time) bool) bool {
+	for _, key := range db.data.Keys() {
+		db.locker.RLock(key)
+		goNext := db.visitKey(key, consumer)
+		db.locker.RUnlock(key)
+		if !goNext {
+			return false
+		}
+	}
+	return true
+}
+
+// visitKey 在持有key的读锁时访问key，key在遍历期间被删除或已经过期时跳过
+func (db *RedisDb) visitKey(key string, consumer func(key string, entity *database.DataEntity, expiration *time.Time) bool) bool {
+	val, exists := db.data.Get(key) // 只持有读锁，不能惰性删除过期的key
+	if !exists {
+		return true
+	}
+	entity, ok := val.(*database.DataEntity)
+	if !ok {
+		return true
+	}
+	var expiration *time.Time
+	if expireTime, ok := db.GetExpireTime(key); ok {
+		if expireTime.Before(time.Now()) {
+			return true
+		}
+		expiration = &expireTime
+	}
+	return consumer(key, entity, expiration)
+}
+
+// Scan 从cursor开始遍历至少count个键值对，跳过已过期的key，返回下一次遍历的游标，0表示遍历结束
+func (db *RedisDb) Scan(cursor uint64, count int, consumer func(key string, entity *database.DataEntity) bool) uint64 {
+	now := time.Now()
+	return db.data.Scan(cursor, count, func(key string, val any) bool {
+		entity, ok := val.(*database.DataEntity)
+		if !ok {
+			return true
+		}
+		if expireTime, hasTTL := db.GetExpireTime(key); hasTTL && expireTime.Before(now) {
+			return true
+		}
+		return consumer(key, entity)
+	})
+}
+
+// Expire 设置key的过期时间点
+func (db *RedisDb) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
+
+// Persist 移除key的过期时间，返回是否移除成功
+func (db *RedisDb) Persist(key string) int {
+	return db.ttlMap.Remove(key)
+}
+
+// GetExpireTime 获取key的过期时间点，第二个返回值表示key是否设置了过期时间
+func (db *RedisDb) GetExpireTime(key string) (time.Time, bool) {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// IsExpired 判断key是否已经过期
+func (db *RedisDb) IsExpired(key string) bool {
+	expireTime, exists := db.GetExpireTime(key)
+	if !exists {
+		return false
+	}
+	return time.Now().After(expireTime)
+}
+
+// expireIfNeeded 如果key已经过期则将其删除，并向AOF传播DEL命令，返回key是否已过期
+func (db *RedisDb) expireIfNeeded(key string) bool {
+	if !db.IsExpired(key) {
+		return false
+	}
+	db.Remove(key)
+	db.touch(key)
+	db.AddAof(utils.ToCmdLine("del", key))
+	db.Notify(NotifyExpired, "expired", key)
+	return true
+}
+
+// expireKeys 惰性删除已经过期的key，调用者需要持有这些key的写锁。
+// 只持有读锁的命令不能删除过期的key，只能视为不存在
+func (db *RedisDb) expireKeys(keys []string) {
+	for _, key := range keys {
+		db.expireIfNeeded(key)
+	}
+}
+
+// ActiveExpireCycle 主动过期：从设置了过期时间的key中随机抽样并删除已过期的key，
+// 如果一轮抽样中过期key的比例较高，则继续抽样，直到比例降低或超过执行时间上限
+func (db *RedisDb) ActiveExpireCycle() {
+	start := time.Now()
+	for {
+		keys := db.ttlMap.RandomDistinctKeys(expireSampleSize)
+		if len(keys) == 0 {
+			return
+		}
+		expired := 0
+		for _, key := range keys {
+			db.locker.Lock(key)
+			if db.expireIfNeeded(key) {
+				expired++
+			}
+			db.locker.Unlock(key)
+		}
+		if expired*expireSampleRatio <= len(keys) || time.Since(start) > expireCycleTimeout {
+			return
+		}
+	}
+}
+
+func (db *RedisDb) Close() error {
+	db.Flush()
 	return nil
 }
 
@@ -94,12 +386,29 @@ func (db *RedisDb) SetId(id int) {
 	db.id = id
 }
 
+// AddAof 添加一条AOF命令，写入失败的错误由执行命令的Exec处理
 func (db *RedisDb) AddAof(line database.CmdLine) {
 	if db.addAof != nil {
-		db.addAof(line)
+		_ = db.addAof(line)
 	}
 }
 
-func (db *RedisDb) SetAddAof(fn func(database.CmdLine)) {
+func (db *RedisDb) SetAddAof(fn func(...database.CmdLine) error) {
 	db.addAof = fn
 }
+
+func (db *RedisDb) SetAofWriteErr(fn func() error) {
+	db.aofWriteErr = fn
+}
+
+func (db *RedisDb) SetPersistenceInfo(fn func() string) {
+	db.persistenceInfo = fn
+}
+
+// PersistenceInfo 返回INFO persistence的内容，持久化由StandaloneDatabase管理
+func (db *RedisDb) PersistenceInfo() string {
+	if db.persistenceInfo == nil {
+		return ""
+	}
+	return db.persistenceInfo()
+}
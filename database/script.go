@@ -0,0 +1,486 @@
+package database
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const defaultLuaTimeLimit = 5000 * time.Millisecond // 脚本默认的繁忙时间阈值
+
+// scriptCache 编译后的脚本缓存，SHA1 -> 脚本，所有数据库共享
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto
+}
+
+var scripts = &scriptCache{
+	scripts: make(map[string]*lua.FunctionProto),
+}
+
+// runningScript 正在执行的脚本，超过lua-time-limit后视为繁忙，可以被SCRIPT KILL终止
+type runningScript struct {
+	db      *RedisDb
+	keys    map[string]struct{} // 脚本声明的key
+	start   time.Time
+	cancel  context.CancelFunc
+	written atomic.Bool // 是否执行过写命令，执行过写命令的脚本不能被终止
+	killed  atomic.Bool
+}
+
+// scriptRegistry 记录正在执行的脚本
+type scriptRegistry struct {
+	mu      sync.Mutex
+	count   atomic.Int32 // 正在执行的脚本数，没有脚本执行时不需要加锁检查
+	running map[*runningScript]struct{}
+}
+
+var runningScripts = &scriptRegistry{
+	running: make(map[*runningScript]struct{}),
+}
+
+func (registry *scriptRegistry) add(script *runningScript) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.running[script] = struct{}{}
+	registry.count.Add(1)
+}
+
+func (registry *scriptRegistry) remove(script *runningScript) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.running, script)
+	registry.count.Add(-1)
+}
+
+var luaTimeLimitMillis atomic.Int64 // 当前生效的lua-time-limit(毫秒)
+
+// SetLuaTimeLimit 修改脚本的繁忙时间阈值(毫秒)，不大于0时使用默认值
+func SetLuaTimeLimit(millis int) {
+	luaTimeLimitMillis.Store(int64(millis))
+}
+
+// LuaTimeLimit 返回配置的脚本繁忙时间阈值(毫秒)
+func LuaTimeLimit() int {
+	return int(luaTimeLimitMillis.Load())
+}
+
+// luaTimeLimit 返回脚本的繁忙时间阈值
+func luaTimeLimit() time.Duration {
+	millis := luaTimeLimitMillis.Load()
+	if millis <= 0 {
+		return defaultLuaTimeLimit
+	}
+	return time.Duration(millis) * time.Millisecond
+}
+
+// checkScriptBusy 如果有繁忙的脚本占用了命令要访问的key，返回BUSY错误，否则返回nil
+func (db *RedisDb) checkScriptBusy(writeKeys []string, readKeys []string) resp.Reply {
+	if runningScripts.count.Load() == 0 {
+		return nil
+	}
+	limit := luaTimeLimit()
+	runningScripts.mu.Lock()
+	defer runningScripts.mu.Unlock()
+	for script := range runningScripts.running {
+		if script.db.dbState != db.dbState || time.Since(script.start) < limit {
+			continue
+		}
+		for _, keys := range [][]string{writeKeys, readKeys} {
+			for _, key := range keys {
+				if _, ok := script.keys[key]; ok {
+					return reply.NewStandardErrReply("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// KillScript 终止所有繁忙的脚本，执行过写命令的脚本不能被终止
+func KillScript() resp.Reply {
+	limit := luaTimeLimit()
+	runningScripts.mu.Lock()
+	defer runningScripts.mu.Unlock()
+	var busy []*runningScript
+	for script := range runningScripts.running {
+		if time.Since(script.start) >= limit {
+			busy = append(busy, script)
+		}
+	}
+	if len(busy) == 0 {
+		return reply.NewStandardErrReply("NOTBUSY No scripts in execution right now.")
+	}
+	for _, script := range busy {
+		if script.written.Load() {
+			return reply.NewStandardErrReply("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+		}
+	}
+	for _, script := range busy {
+		script.killed.Store(true)
+		script.cancel()
+	}
+	return reply.NewOkReply()
+}
+
+// sha1hex 计算脚本的SHA1，用作缓存的key
+func sha1hex(src []byte) string {
+	sum := sha1.Sum(src)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadScript 编译脚本并加入缓存，返回脚本的SHA1
+func LoadScript(src []byte) (string, resp.Reply) {
+	sha, _, errReply := loadScript(src)
+	return sha, errReply
+}
+
+func loadScript(src []byte) (string, *lua.FunctionProto, resp.Reply) {
+	sha := sha1hex(src)
+	scripts.mu.RLock()
+	proto, ok := scripts.scripts[sha]
+	scripts.mu.RUnlock()
+	if ok {
+		return sha, proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(string(src)), "user_script")
+	if err == nil {
+		proto, err = lua.Compile(chunk, "user_script")
+	}
+	if err != nil {
+		return "", nil, reply.NewStandardErrReply("ERR Error compiling script (new function): " + strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	scripts.mu.Lock()
+	scripts.scripts[sha] = proto
+	scripts.mu.Unlock()
+	return sha, proto, nil
+}
+
+// ScriptExists 判断脚本是否在缓存中
+func ScriptExists(sha string) bool {
+	scripts.mu.RLock()
+	defer scripts.mu.RUnlock()
+	_, ok := scripts.scripts[strings.ToLower(sha)]
+	return ok
+}
+
+// FlushScripts 清空脚本缓存
+func FlushScripts() {
+	scripts.mu.Lock()
+	defer scripts.mu.Unlock()
+	scripts.scripts = make(map[string]*lua.FunctionProto)
+}
+
+// Eval 编译并执行脚本，脚本会加入缓存以便之后使用EVALSHA执行
+func (db *RedisDb) Eval(conn resp.Connection, src []byte, keys [][]byte, argv [][]byte) resp.Reply {
+	_, proto, errReply := loadScript(src)
+	if errReply != nil {
+		return errReply
+	}
+	return db.runScript(conn, proto, keys, argv)
+}
+
+// EvalSha 执行缓存中的脚本
+func (db *RedisDb) EvalSha(conn resp.Connection, sha string, keys [][]byte, argv [][]byte) resp.Reply {
+	scripts.mu.RLock()
+	proto, ok := scripts.scripts[strings.ToLower(sha)]
+	scripts.mu.RUnlock()
+	if !ok {
+		return reply.NewStandardErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return db.runScript(conn, proto, keys, argv)
+}
+
+// scriptContext 一次脚本执行的上下文
+type scriptContext struct {
+	conn   resp.Connection
+	db     *RedisDb // 将AOF命令交给收集器的RedisDb
+	script *runningScript
+
+	modified bool // 当前执行的命令是否产生了AOF命令，即是否修改了数据
+}
+
+// runScript 在新的Lua虚拟机中执行脚本。调用方已经对脚本声明的key加锁，
+// 脚本中通过redis.call执行的命令直接执行，不再加锁，因此只能访问声明过的key。
+// 脚本执行的写命令作为一个MULTI...EXEC整体写入AOF
+func (db *RedisDb) runScript(conn resp.Connection, proto *lua.FunctionProto, keys [][]byte, argv [][]byte) resp.Reply {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	script := &runningScript{
+		db:     db,
+		keys:   make(map[string]struct{}, len(keys)),
+		start:  time.Now(),
+		cancel: cancel,
+	}
+	for _, key := range keys {
+		script.keys[string(key)] = struct{}{}
+	}
+	runningScripts.add(script)
+	defer runningScripts.remove(script)
+
+	var aofLines []database.CmdLine
+	sc := &scriptContext{conn: conn, script: script}
+	sc.db = db.withAof(func(lines ...database.CmdLine) error {
+		sc.modified = true
+		aofLines = append(aofLines, lines...)
+		return nil
+	})
+	defer func() { // 写入AOF失败的错误由db记录，执行EVAL的Exec据此回复错误
+		_ = db.addMultiAof(aofLines)
+	}()
+
+	sc.openLibs(L)
+	L.SetGlobal("KEYS", toLuaArray(L, keys))
+	L.SetGlobal("ARGV", toLuaArray(L, argv))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		if script.killed.Load() {
+			return reply.NewStandardErrReply("ERR Script killed by user with SCRIPT KILL...")
+		}
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			if tbl, ok := apiErr.Object.(*lua.LTable); ok { // redis.call抛出的错误
+				if msg, ok := tbl.RawGetString("err").(lua.LString); ok {
+					return reply.NewStandardErrReply(string(msg))
+				}
+			}
+			return reply.NewStandardErrReply("ERR Error running script: " + apiErr.Object.String())
+		}
+		return reply.NewStandardErrReply("ERR Error running script: " + err.Error())
+	}
+	return luaToReply(L.Get(-1))
+}
+
+// openLibs 加载基础库和redis库，去掉访问文件的函数
+func (sc *scriptContext) openLibs(L *lua.LState) {
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return sc.call(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return sc.call(L, false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex([]byte(L.CheckString(1)))))
+			return 1
+		},
+	})
+	L.SetGlobal("redis", redis)
+}
+
+// call 实现redis.call和redis.pcall：执行命令并将回复转换为Lua值。
+// 命令返回错误时，redis.call抛出错误，redis.pcall返回带err字段的table
+func (sc *scriptContext) call(L *lua.LState, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+		return 0
+	}
+	cmdLine := make([][]byte, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine[i-1] = []byte(v)
+		case lua.LNumber:
+			cmdLine[i-1] = []byte(v.String())
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+			return 0
+		}
+	}
+	result := sc.exec(cmdLine)
+	if errReply, ok := result.(resp.ErrorReply); ok && raise {
+		L.Error(statusTable(L, "err", errReply.Error()), 1)
+		return 0
+	}
+	L.Push(replyToLua(L, result))
+	return 1
+}
+
+// exec 执行脚本中的命令，命令访问的key必须在KEYS中声明
+func (sc *scriptContext) exec(cmdLine [][]byte) resp.Reply {
+	cmd, errReply := lookupCommand(cmdLine)
+	if errReply != nil {
+		return errReply
+	}
+	switch cmd.name {
+	case "eval", "evalsha", "script":
+		return reply.NewStandardErrReply("ERR This Redis command is not allowed from script")
+	}
+	args := cmdLine[1:]
+	writeKeys, readKeys := cmd.keys(args)
+	for _, keys := range [][]string{writeKeys, readKeys} {
+		for _, key := range keys {
+			if _, ok := sc.script.keys[key]; !ok {
+				return reply.NewStandardErrReply("ERR Script attempted to access key '" + key + "' that was not declared in KEYS")
+			}
+		}
+	}
+	if len(writeKeys) > 0 {
+		sc.script.written.Store(true)
+	}
+	sc.modified = false
+	sc.db.expireKeys(writeKeys)
+	sc.db.writeKeys = writeKeys
+	result := cmd.execFunc(sc.conn, sc.db, args)
+	if blocking, ok := result.(*BlockingReply); ok { // 脚本中的阻塞命令不等待，与超时相同
+		blocking.finish()
+		return reply.NewNullMultiBulkReply()
+	}
+	if sc.modified { // 出错或没有修改数据的命令不使WATCH失效
+		sc.db.touch(writeKeys...)
+	}
+	return result
+}
+
+func toLuaArray(L *lua.LState, args [][]byte) *lua.LTable {
+	tbl := L.CreateTable(len(args), 0)
+	for _, arg := range args {
+		tbl.Append(lua.LString(arg))
+	}
+	return tbl
+}
+
+// statusTable 创建只有一个字段的table，用于表示状态回复{ok=...}和错误回复{err=...}
+func statusTable(L *lua.LState, field string, msg string) *lua.LTable {
+	tbl := L.NewTable()
+	tbl.RawSetString(field, lua.LString(msg))
+	return tbl
+}
+
+// replyToLua 将命令的回复转换为Lua值：整数转换为number，字符串转换为string，空回复转换为false，
+// 数组转换为table，状态回复和错误回复分别转换为{ok=...}和{err=...}
+func replyToLua(L *lua.LState, r resp.Reply) lua.LValue {
+	value, _ := parseRespValue(L, r.ToBytes())
+	return value
+}
+
+// parseRespValue 解析一个RESP格式的值，返回解析结果和剩余的字节
+func parseRespValue(L *lua.LState, data []byte) (lua.LValue, []byte) {
+	end := strings.Index(string(data), "\r\n")
+	if len(data) == 0 || end < 0 {
+		return lua.LFalse, nil
+	}
+	line, rest := string(data[1:end]), data[end+2:]
+	switch data[0] {
+	case '+':
+		return statusTable(L, "ok", line), rest
+	case '-':
+		return statusTable(L, "err", line), rest
+	case ':':
+		n, _ := strconv.ParseInt(line, 10, 64)
+		return lua.LNumber(n), rest
+	case '$':
+		size, _ := strconv.Atoi(line)
+		if size < 0 || len(rest) < size+2 {
+			return lua.LFalse, rest
+		}
+		return lua.LString(rest[:size]), rest[size+2:]
+	case '*', '%':
+		size, _ := strconv.Atoi(line)
+		if size < 0 {
+			return lua.LFalse, rest
+		}
+		if data[0] == '%' { // 字典按照键值交替的数组返回
+			size *= 2
+		}
+		tbl := L.CreateTable(size, 0)
+		for i := 0; i < size; i++ {
+			var value lua.LValue
+			value, rest = parseRespValue(L, rest)
+			tbl.Append(value)
+		}
+		return tbl, rest
+	}
+	return lua.LFalse, rest
+}
+
+// luaToReply 将脚本的返回值转换为回复：number截断为整数，string转换为字符串，true转换为1，false和nil转换为空回复，
+// table按数组转换直到第一个nil，带ok或err字段的table转换为状态回复或错误回复
+func luaToReply(value lua.LValue) resp.Reply {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return reply.NewIntReply(int64(v))
+	case lua.LString:
+		return reply.NewBulkReply([]byte(v))
+	case lua.LBool:
+		if v {
+			return reply.NewIntReply(1)
+		}
+		return reply.NewNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return reply.NewStandardErrReply(string(msg))
+		}
+		if msg, ok := v.RawGetString("ok").(lua.LString); ok {
+			return reply.NewStatusReply(string(msg))
+		}
+		replies := make([]resp.Reply, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		return reply.NewMultiRawReply(replies)
+	}
+	return reply.NewNullBulkReply()
+}
+
+// ScriptCmdKeys 解析EVAL/EVALSHA的numkeys参数，返回声明的key和其余参数
+func ScriptCmdKeys(args [][]byte) (keys [][]byte, argv [][]byte, errReply resp.Reply) {
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, nil, reply.NewStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, reply.NewStandardErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-2 {
+		return nil, nil, reply.NewStandardErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return args[2 : 2+numKeys], args[2+numKeys:], nil
+}
@@ -7,41 +7,127 @@ import (
 	database2 "goRedis/interface/database"
 	"goRedis/interface/resp"
 	"goRedis/lib/logger"
+	"goRedis/pubsub"
 	"goRedis/resp/reply"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const expireCycleInterval = 100 * time.Millisecond // 主动过期任务的执行间隔
+
 type StandaloneDatabase struct {
 	dbSet      []*RedisDb
 	aofHandler *aof.AofHandler // 全局的AofHandler
+	closeChan  chan struct{}   // 关闭信号，用于停止后台任务
+	closeOnce  sync.Once       // 保证只关闭一次
+	hub        *pubsub.Hub     // 发布订阅中心
+
+	dirty         atomic.Int64 // 上一次快照之后的修改次数
+	saveMu        sync.Mutex   // 保证同一时间只有一个快照在生成
+	bgsaving      atomic.Bool  // 是否有后台快照正在生成
+	lastSave      atomic.Int64 // 上一次成功生成快照的unix时间戳(秒)
+	lastBgsaveTry atomic.Int64 // 上一次开始后台快照的unix时间戳(毫秒)
+	lastBgsaveOK  atomic.Bool  // 上一次后台快照是否成功
 }
 
 func NewStandaloneDataBase() *StandaloneDatabase {
-	database := &StandaloneDatabase{}
 	if config.Properties.Databases <= 0 { // 默认16个数据库
 		config.Properties.Databases = 16
 	}
+	if flags, ok := SetNotifyKeyspaceEvents(config.Properties.NotifyKeyspaceEvents); ok {
+		config.Properties.NotifyKeyspaceEvents = flags
+	} else {
+		logger.Error("invalid notify-keyspace-events: " + config.Properties.NotifyKeyspaceEvents)
+	}
+	if params, ok := SetSaveParams(config.Properties.Save); ok {
+		config.Properties.Save = params
+	} else {
+		logger.Error("invalid save: " + config.Properties.Save)
+	}
+	if policy, ok := aof.SetFsyncPolicy(config.Properties.AppendFsync); ok {
+		config.Properties.AppendFsync = policy
+	} else {
+		logger.Error("invalid appendfsync: " + config.Properties.AppendFsync)
+		config.Properties.AppendFsync, _ = aof.SetFsyncPolicy(aof.FsyncEverySec)
+	}
+	aof.SetAutoRewritePercentage(config.Properties.AutoAofRewritePercentage)
+	aof.SetAutoRewriteMinSize(int64(config.Properties.AutoAofRewriteMinSize))
+	aof.SetUseRdbPreamble(config.Properties.AofUseRdbPreamble)
+	SetLuaTimeLimit(config.Properties.LuaTimeLimit)
+	database := newBasicDatabase()
+	if config.Properties.AppendOnly { // 开启AOF时只从AOF恢复数据
+		aofHandler, err := aof.NewAofHandler(database, func() database2.DBEngine {
+			return newBasicDatabase()
+		})
+		if err != nil {
+			panic(err)
+		}
+		database.aofHandler = aofHandler
+	} else if err := database.loadRDB(); err != nil {
+		panic(err)
+	}
+	database.dirty.Store(0) // 恢复数据时执行的命令不计入修改次数
+	database.lastSave.Store(time.Now().Unix())
+	database.lastBgsaveOK.Store(true)
+	database.startExpireCycle()
+	database.startPersistenceCron()
+	return database
+}
+
+// newBasicDatabase 创建只包含数据的数据库，不恢复数据也不启动后台任务，用于AOF重写时加载旧的AOF文件
+func newBasicDatabase() *StandaloneDatabase {
+	database := &StandaloneDatabase{
+		closeChan: make(chan struct{}),
+		hub:       pubsub.MakeHub(),
+	}
 	database.dbSet = make([]*RedisDb, config.Properties.Databases)
+	notifications := newNotifyQueue(func(channel string, message string) { // 所有数据库共用，保证通知的顺序
+		database.hub.Publish([][]byte{[]byte(channel), []byte(message)})
+	})
 	for i := 0; i < config.Properties.Databases; i++ {
 		db := NewRedisDb()
 		db.SetId(i)
+		db.SetPersistenceInfo(database.persistenceInfo)
+		db.SetPublish(notifications.push)
+		db.SetAddAof(func(lines ...database2.CmdLine) error {
+			database.dirty.Add(int64(len(lines)))
+			if database.aofHandler != nil {
+				return database.aofHandler.AddAof(db.id, lines...)
+			}
+			return nil
+		})
+		db.SetAofWriteErr(func() error {
+			if database.aofHandler != nil {
+				return database.aofHandler.WriteErr()
+			}
+			return nil
+		})
 		database.dbSet[i] = db
 	}
-	if config.Properties.AppendOnly {
-		aofHandler, err := aof.NewAofHandler(database)
-		if err != nil {
-			panic(err)
-		}
-		for _, db := range database.dbSet {
-			db.SetAddAof(func(line database2.CmdLine) {
-				aofHandler.AddAof(db.id, line)
-			})
-		}
-	}
 	return database
 }
 
+// startExpireCycle 启动后台任务，定期对每个数据库执行主动过期
+func (db *StandaloneDatabase) startExpireCycle() {
+	ticker := time.NewTicker(expireCycleInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, redisDb := range db.dbSet {
+					redisDb.ActiveExpireCycle()
+				}
+			case <-db.closeChan:
+				return
+			}
+		}
+	}()
+}
+
 func (db *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply {
 	defer func() {
 		if err := recover(); err != nil {
@@ -51,6 +137,18 @@ func (db *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.R
 
 	cmdName := string(args[0])
 	cmdName = strings.ToLower(cmdName)
+	if isPubSubCommand(cmdName) {
+		return db.execPubSub(client, cmdName, args)
+	}
+	if isPersistenceCommand(cmdName) {
+		return db.execPersistence(client, cmdName, args)
+	}
+	if isTxCommand(cmdName) {
+		return db.execTxCommand(client, cmdName, args)
+	}
+	if client.InMultiState() {
+		return EnqueueCmd(client, args)
+	}
 	if cmdName == "select" {
 		if len(args) != 2 {
 			return reply.NewArgNumErrReply("select")
@@ -65,10 +163,56 @@ func (db *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.R
 }
 
 func (db *StandaloneDatabase) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.closeChan)
+		if db.aofHandler != nil { // 等待写入队列中的命令全部写入文件
+			if err := db.aofHandler.Close(); err != nil {
+				logger.Error("close aof failed: " + err.Error())
+			}
+		}
+		if params := saveParams.Load(); params != nil && len(*params) > 0 { // 配置了自动快照时，关闭前生成一次快照
+			if err := db.SaveRDB(); err != nil {
+				logger.Error("save rdb on shutdown failed: " + err.Error())
+			}
+		}
+	})
 	return nil
 }
 
+// ForEach 遍历所有数据库中未过期的键值对，用于生成快照和AOF重写
+func (db *StandaloneDatabase) ForEach(consumer database2.DataConsumer) {
+	for i, redisDb := range db.dbSet {
+		goNext := redisDb.forEachLocked(func(key string, entity *database2.DataEntity, expiration *time.Time) bool {
+			return consumer(i, key, entity, expiration)
+		})
+		if !goNext {
+			return
+		}
+	}
+}
+
+// LoadEntity 写入从快照中恢复的键值对，跳过已经过期的key和超出数据库个数的key
+func (db *StandaloneDatabase) LoadEntity(dbIndex int, key string, entity *database2.DataEntity, expiration *time.Time) bool {
+	if dbIndex < 0 || dbIndex >= len(db.dbSet) {
+		logger.Warn("skip key " + key + " of db " + strconv.Itoa(dbIndex) + ": DB index out of range")
+		return true
+	}
+	if expiration != nil && expiration.Before(time.Now()) {
+		return true
+	}
+	redisDb := db.dbSet[dbIndex]
+	redisDb.data.Put(key, entity)
+	if expiration != nil {
+		redisDb.Expire(key, *expiration)
+	} else {
+		redisDb.Persist(key)
+	}
+	return true
+}
+
 func (db *StandaloneDatabase) AfterClientClose(client resp.Connection) error {
+	db.unwatchAll(client)
+	db.hub.UnsubscribeAll(client)
 	return nil
 }
 
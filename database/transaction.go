@@ -0,0 +1,335 @@
+package database
+
+import (
+	"errors"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/resp/reply"
+	"strings"
+	"sync"
+)
+
+// watchedKey 被WATCH的key的版本号，key每次被修改时版本号加1
+type watchedKey struct {
+	version uint32
+	refs    int // WATCH该key的连接数
+}
+
+// watchRegistry 只为被WATCH的key维护版本号，没有连接WATCH时删除，避免为所有key维护版本号
+type watchRegistry struct {
+	mu   sync.Mutex
+	keys map[string]*watchedKey
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{
+		keys: make(map[string]*watchedKey),
+	}
+}
+
+// watch 增加key的引用计数，返回key当前的版本号
+func (registry *watchRegistry) watch(key string) uint32 {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	w, ok := registry.keys[key]
+	if !ok {
+		w = &watchedKey{}
+		registry.keys[key] = w
+	}
+	w.refs++
+	return w.version
+}
+
+// unwatch 减少key的引用计数，没有连接WATCH时删除
+func (registry *watchRegistry) unwatch(key string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	w, ok := registry.keys[key]
+	if !ok {
+		return
+	}
+	w.refs--
+	if w.refs <= 0 {
+		delete(registry.keys, key)
+	}
+}
+
+// version 返回key当前的版本号
+func (registry *watchRegistry) version(key string) uint32 {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if w, ok := registry.keys[key]; ok {
+		return w.version
+	}
+	return 0
+}
+
+// touch key被修改，增加版本号
+func (registry *watchRegistry) touch(keys ...string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if len(registry.keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		if w, ok := registry.keys[key]; ok {
+			w.version++
+		}
+	}
+}
+
+// touchAll 清空数据库时所有被WATCH的key都视为被修改
+func (registry *watchRegistry) touchAll() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, w := range registry.keys {
+		w.version++
+	}
+}
+
+// touch 在修改key之后调用，使WATCH了这些key的事务失败
+func (db *RedisDb) touch(keys ...string) {
+	if len(keys) > 0 {
+		db.watches.touch(keys...)
+	}
+}
+
+// Watch 监视key，返回key当前的版本号
+func (db *RedisDb) Watch(key string) uint32 {
+	return db.watches.watch(key)
+}
+
+// Unwatch 取消一次对key的监视
+func (db *RedisDb) Unwatch(key string) {
+	db.watches.unwatch(key)
+}
+
+// GetVersion 返回被监视的key当前的版本号
+func (db *RedisDb) GetVersion(key string) uint32 {
+	return db.watches.version(key)
+}
+
+// ExecMulti 原子地执行事务：对所有命令涉及的key加锁，检查WATCH的key没有被修改后依次执行命令。
+// watching为当前数据库中WATCH的key及WATCH时的版本号，有key被修改时放弃执行并返回空回复。
+// 事务中的命令作为一个MULTI...EXEC整体写入AOF
+func (db *RedisDb) ExecMulti(conn resp.Connection, watching map[string]uint32, cmdLines [][][]byte) resp.Reply {
+	cmds := make([]*command, len(cmdLines))
+	writeKeysList := make([][]string, len(cmdLines))
+	var writeKeys, readKeys []string
+	for i, cmdLine := range cmdLines {
+		cmd, errReply := lookupCommand(cmdLine)
+		if errReply != nil { // 入队时已经校验过，正常情况下不会发生
+			return reply.NewStandardErrReply("EXECABORT Transaction discarded because of previous errors.")
+		}
+		cmds[i] = cmd
+		write, read := cmd.keys(cmdLine[1:])
+		writeKeysList[i] = write
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	for key := range watching {
+		readKeys = append(readKeys, key)
+	}
+	if errReply := db.checkScriptBusy(writeKeys, readKeys); errReply != nil {
+		return errReply
+	}
+	if len(writeKeys) > 0 {
+		if errReply := db.checkAofWrite(); errReply != nil {
+			return errReply
+		}
+	}
+	db.lockKeys(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+
+	for key, version := range watching {
+		if db.GetVersion(key) != version {
+			return reply.NewNullMultiBulkReply()
+		}
+	}
+	db.expireKeys(writeKeys)
+
+	// 收集事务产生的AOF命令，执行完后一次性写入
+	var aofLines []database.CmdLine
+	var modified bool // 当前命令是否产生了AOF命令，即是否修改了数据
+	txDb := db.withAof(func(lines ...database.CmdLine) error {
+		modified = true
+		aofLines = append(aofLines, lines...)
+		return nil
+	})
+	txDb.inMulti = true // 事务中的脚本不再单独包裹MULTI...EXEC
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for i, cmdLine := range cmdLines {
+		modified = false
+		txDb.writeKeys = writeKeysList[i]
+		result := cmds[i].execFunc(conn, txDb, cmdLine[1:])
+		if blocking, ok := result.(*BlockingReply); ok { // 事务中的阻塞命令不等待，与超时相同
+			blocking.finish()
+			result = reply.NewNullMultiBulkReply()
+		} else if modified { // 出错或没有修改数据的命令不使WATCH失效
+			db.touch(writeKeysList[i]...)
+		}
+		results = append(results, result)
+	}
+	if err := db.addMultiAof(aofLines); err != nil { // 事务的修改没有写入AOF，不能向客户端确认
+		return newAofErrReply(err)
+	}
+	return reply.NewMultiRawReply(results)
+}
+
+// addMultiAof 将事务或脚本产生的命令作为一个MULTI...EXEC整体写入AOF，返回写入AOF时的错误。
+// 在事务中执行的脚本产生的命令直接交给事务的收集器，由事务统一包裹，避免MULTI嵌套
+func (db *RedisDb) addMultiAof(aofLines []database.CmdLine) error {
+	if len(aofLines) == 0 {
+		return nil
+	}
+	if db.inMulti {
+		return db.addAof(aofLines...)
+	}
+	lines := make([]database.CmdLine, 0, len(aofLines)+2)
+	lines = append(lines, utils.ToCmdLine("multi"))
+	lines = append(lines, aofLines...)
+	lines = append(lines, utils.ToCmdLine("exec"))
+	return db.addAof(lines...)
+}
+
+// isTxCommand 判断是否是事务控制命令，这些命令在事务中不入队，直接执行
+func isTxCommand(cmdName string) bool {
+	switch cmdName {
+	case "multi", "exec", "discard", "watch", "unwatch":
+		return true
+	}
+	return false
+}
+
+// execTxCommand 执行事务控制命令
+func (db *StandaloneDatabase) execTxCommand(client resp.Connection, cmdName string, args [][]byte) resp.Reply {
+	switch cmdName {
+	case "multi":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return StartMulti(client)
+	case "exec":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.execMulti(client)
+	case "discard":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.discardMulti(client)
+	case "watch":
+		if len(args) < 2 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		return db.watch(client, args[1:])
+	default: // unwatch
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply(cmdName)
+		}
+		db.unwatchAll(client)
+		return reply.NewOkReply()
+	}
+}
+
+// StartMulti 进入事务状态，之后的命令进入队列，直到EXEC或DISCARD
+func StartMulti(client resp.Connection) resp.Reply {
+	if client.InMultiState() {
+		return reply.NewStandardErrReply("ERR MULTI calls can not be nested")
+	}
+	client.SetMultiState(true)
+	return reply.NewOkReply()
+}
+
+// EnqueueCmd 将命令加入事务队列，命令不存在或参数个数错误时立即返回错误，并使EXEC放弃执行事务
+func EnqueueCmd(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	if _, errReply := lookupCommand(cmdLine); errReply != nil {
+		client.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	if strings.ToLower(string(cmdLine[0])) == "select" {
+		errReply := reply.NewStandardErrReply("ERR SELECT is not allowed in MULTI")
+		client.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	client.EnqueueCmd(cmdLine)
+	return reply.NewQueuedReply()
+}
+
+// execMulti 执行事务，无论事务是否执行都会退出事务状态并取消所有WATCH
+func (db *StandaloneDatabase) execMulti(client resp.Connection) resp.Reply {
+	if !client.InMultiState() {
+		return reply.NewStandardErrReply("ERR EXEC without MULTI")
+	}
+	cmdLines := client.GetQueuedCmdLine()
+	txErrors := client.GetTxErrors()
+	client.SetMultiState(false)
+	defer db.unwatchAll(client)
+	if len(txErrors) > 0 {
+		return reply.NewStandardErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	dbIndex := client.GetDBIndex()
+	if dbIndex < 0 || dbIndex >= len(db.dbSet) {
+		return reply.NewStandardErrReply("ERR DB index out of range")
+	}
+	// 其他数据库中WATCH的key无法与事务一起加锁，只在执行前检查一次
+	for index, keys := range client.GetWatching() {
+		if index == dbIndex {
+			continue
+		}
+		for key, version := range keys {
+			if db.dbSet[index].GetVersion(key) != version {
+				return reply.NewNullMultiBulkReply()
+			}
+		}
+	}
+	return db.dbSet[dbIndex].ExecMulti(client, client.GetWatching()[dbIndex], cmdLines)
+}
+
+// discardMulti 放弃事务，清空队列并取消所有WATCH
+func (db *StandaloneDatabase) discardMulti(client resp.Connection) resp.Reply {
+	if !client.InMultiState() {
+		return reply.NewStandardErrReply("ERR DISCARD without MULTI")
+	}
+	client.SetMultiState(false)
+	db.unwatchAll(client)
+	return reply.NewOkReply()
+}
+
+// watch 监视当前数据库中的key，EXEC时key被修改过则放弃执行事务
+func (db *StandaloneDatabase) watch(client resp.Connection, keys [][]byte) resp.Reply {
+	if client.InMultiState() {
+		return reply.NewStandardErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	dbIndex := client.GetDBIndex()
+	if dbIndex < 0 || dbIndex >= len(db.dbSet) {
+		return reply.NewStandardErrReply("ERR DB index out of range")
+	}
+	watching := client.GetWatching()
+	versions, ok := watching[dbIndex]
+	if !ok {
+		versions = make(map[string]uint32)
+		watching[dbIndex] = versions
+	}
+	for _, arg := range keys {
+		key := string(arg)
+		if _, ok := versions[key]; ok { // 重复WATCH保留最早的版本号
+			continue
+		}
+		versions[key] = db.dbSet[dbIndex].Watch(key)
+	}
+	return reply.NewOkReply()
+}
+
+// unwatchAll 取消连接的所有WATCH
+func (db *StandaloneDatabase) unwatchAll(client resp.Connection) {
+	watching := client.GetWatching()
+	for index, keys := range watching {
+		for key := range keys {
+			db.dbSet[index].Unwatch(key)
+		}
+		delete(watching, index)
+	}
+}
@@ -0,0 +1,123 @@
+package database_test
+
+import (
+	"goRedis/aof"
+	"goRedis/database"
+	_ "goRedis/database/cmd"
+	database2 "goRedis/interface/database"
+	"goRedis/lib/utils"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordAof 执行命令并返回写入0号库AOF的命令
+func recordAof(t *testing.T, cmdLines ...[]string) []database2.CmdLine {
+	t.Helper()
+	db := database.NewTestDatabase()
+	var lines []database2.CmdLine
+	db.SetAddAof(0, func(cmds ...database2.CmdLine) error {
+		lines = append(lines, cmds...)
+		return nil
+	})
+	conn := &connection.RESPConn{}
+	for _, cmdLine := range cmdLines {
+		if r := db.Exec(conn, utils.ToCmdLine(cmdLine...)); reply.IsErrReply(r) {
+			t.Fatalf("%v: %s", cmdLine, r.ToBytes())
+		}
+	}
+	return lines
+}
+
+// replayAof 将命令写入AOF文件，检查文件格式后在新的数据库中重新执行
+func replayAof(t *testing.T, lines []database2.CmdLine) *database.StandaloneDatabase {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	var data []byte
+	for _, line := range lines {
+		data = append(data, reply.NewMultiBulkReply(line).ToBytes()...)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := aof.CheckFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err != nil {
+		t.Fatalf("check aof: %v at offset %d", result.Err, result.ValidSize)
+	}
+	db := database.NewTestDatabase()
+	conn := &connection.RESPConn{}
+	for _, line := range lines {
+		db.Exec(conn, line)
+	}
+	return db
+}
+
+func commandNames(lines []database2.CmdLine) string {
+	names := make([]string, 0, len(lines))
+	for _, line := range lines {
+		names = append(names, strings.ToLower(string(line[0])))
+	}
+	return strings.Join(names, " ")
+}
+
+func getString(t *testing.T, db *database.StandaloneDatabase, key string) string {
+	t.Helper()
+	r := db.Exec(&connection.RESPConn{}, utils.ToCmdLine("get", key))
+	bulk, ok := r.(*reply.BulkReply)
+	if !ok || bulk.Arg == nil {
+		t.Fatalf("get %s: %s", key, r.ToBytes())
+	}
+	return string(bulk.Arg)
+}
+
+func TestScriptInMultiAof(t *testing.T) {
+	lines := recordAof(t,
+		[]string{"multi"},
+		[]string{"set", "a", "1"},
+		[]string{"eval", "return redis.call('set',KEYS[1],'x')", "1", "k"},
+		[]string{"exec"},
+	)
+	if got, want := commandNames(lines), "multi set set exec"; got != want {
+		t.Fatalf("aof commands: got %q, want %q", got, want)
+	}
+	db := replayAof(t, lines)
+	if v := getString(t, db, "a"); v != "1" {
+		t.Errorf("a: got %q", v)
+	}
+	if v := getString(t, db, "k"); v != "x" {
+		t.Errorf("k: got %q", v)
+	}
+}
+
+func TestScriptAof(t *testing.T) {
+	lines := recordAof(t,
+		[]string{"eval", "redis.call('set',KEYS[1],'x'); return redis.call('set',KEYS[2],'y')", "2", "k1", "k2"},
+	)
+	if got, want := commandNames(lines), "multi set set exec"; got != want {
+		t.Fatalf("aof commands: got %q, want %q", got, want)
+	}
+	db := replayAof(t, lines)
+	if v := getString(t, db, "k2"); v != "y" {
+		t.Errorf("k2: got %q", v)
+	}
+}
+
+func TestSetNXAof(t *testing.T) {
+	lines := recordAof(t,
+		[]string{"setnx", "k", "1"},
+		[]string{"setnx", "k", "2"},
+	)
+	if got, want := commandNames(lines), "setnx"; got != want {
+		t.Fatalf("aof commands: got %q, want %q", got, want)
+	}
+	db := replayAof(t, lines)
+	if v := getString(t, db, "k"); v != "1" {
+		t.Errorf("k: got %q", v)
+	}
+}
@@ -1,9 +1,10 @@
 module goRedis
 
-go 1.22
+go 1.23
 
 require (
 	github.com/jolestar/go-commons-pool v2.0.0+incompatible
+	github.com/yuin/gopher-lua v1.1.2
 	github.com/zhangyunhao116/skipmap v0.10.1
 )
 
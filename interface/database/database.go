@@ -1,6 +1,11 @@
 package database
 
-import "goRedis/interface/resp"
+import (
+	"goRedis/interface/resp"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
 
 type CmdLine = [][]byte //传入的参数都是字节数组，故使用一个别名进行替换
 
@@ -10,10 +15,82 @@ type Database interface {
 	AfterClientClose(client resp.Connection) error //在客户端关闭后可能需要进行一些清理操作
 }
 
+// DataConsumer 处理一个键值对，expiration为nil表示没有过期时间，返回false时停止遍历
+type DataConsumer func(dbIndex int, key string, entity *DataEntity, expiration *time.Time) bool
+
+// DBEngine 可以遍历和直接写入键值对的数据库，用于生成快照和AOF重写
+type DBEngine interface {
+	Database
+	ForEach(consumer DataConsumer)                                                      // 遍历所有数据库中未过期的键值对
+	LoadEntity(dbIndex int, key string, entity *DataEntity, expiration *time.Time) bool // 写入从快照中恢复的键值对
+}
+
+const (
+	lfuInitVal   = 5  // 新建对象的访问频率计数器初始值，避免新对象立刻被当作冷数据
+	lfuLogFactor = 10 // 计数器对数增长的因子，越大计数器增长越慢
+	lfuDecayTime = 1  // 每隔多少分钟没有访问，计数器减1
+)
+
 type DataEntity struct {
 	Data any
+
+	accessTime atomic.Int64  // 最近一次访问的毫秒级unix时间戳
+	lfu        atomic.Uint32 // 第8-23位为计数器最近一次衰减的时间(分钟)，低8位为对数访问频率计数器
 }
 
 func NewDataEntity(data any) *DataEntity {
-	return &DataEntity{data}
+	entity := &DataEntity{Data: data}
+	now := time.Now()
+	entity.accessTime.Store(now.UnixMilli())
+	entity.lfu.Store(lfuMinutes(now)<<8 | lfuInitVal)
+	return entity
+}
+
+// Touch 记录一次访问，更新最近访问时间和访问频率。并发访问时可能丢失部分更新，对统计结果影响不大
+func (entity *DataEntity) Touch() {
+	now := time.Now()
+	entity.accessTime.Store(now.UnixMilli())
+	counter := lfuLogIncr(entity.lfuDecr(now))
+	entity.lfu.Store(lfuMinutes(now)<<8 | uint32(counter))
+}
+
+// IdleTime 返回距离最近一次访问的时间
+func (entity *DataEntity) IdleTime() time.Duration {
+	return time.Since(time.UnixMilli(entity.accessTime.Load()))
+}
+
+// Freq 返回对数访问频率计数器的值，已按照没有访问的时间进行衰减
+func (entity *DataEntity) Freq() uint8 {
+	return entity.lfuDecr(time.Now())
+}
+
+// lfuDecr 返回按照距离上一次衰减的时间衰减后的计数器
+func (entity *DataEntity) lfuDecr(now time.Time) uint8 {
+	lfu := entity.lfu.Load()
+	counter := uint8(lfu & 0xff)
+	elapsed := (lfuMinutes(now) - lfu>>8) & 0xffff // 分钟数只保留16位，回绕后仍然可以正确计算间隔
+	periods := elapsed / lfuDecayTime
+	if periods >= uint32(counter) {
+		return 0
+	}
+	return counter - uint8(periods)
+}
+
+// lfuLogIncr 以对数方式增加计数器：计数器越大，增加的概率越小
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+func lfuMinutes(t time.Time) uint32 {
+	return uint32(t.Unix()/60) & 0xffff
 }
@@ -6,4 +6,22 @@ type Connection interface {
 	SelectDB(int)
 	SetName(name []byte)
 	GetName() []byte
+
+	// 事务相关
+	InMultiState() bool                     // 是否处于MULTI之后、EXEC之前
+	SetMultiState(state bool)               // 进入或退出事务状态，退出时清空命令队列和入队错误
+	GetQueuedCmdLine() [][][]byte           // 事务中排队的命令
+	EnqueueCmd(cmdLine [][]byte)            // 将命令加入事务队列
+	AddTxError(err error)                   // 记录入队时发现的错误，EXEC时放弃执行事务
+	GetTxErrors() []error                   // 入队时发现的错误
+	GetWatching() map[int]map[string]uint32 // WATCH的key：数据库编号 -> key -> WATCH时的版本号
+
+	// 发布订阅相关
+	Subscribe(channel string)    // 记录订阅的频道
+	UnSubscribe(channel string)  // 取消记录订阅的频道
+	PSubscribe(pattern string)   // 记录订阅的模式
+	PUnSubscribe(pattern string) // 取消记录订阅的模式
+	SubsCount() int              // 订阅的频道和模式总数，大于0时连接处于订阅模式
+	GetChannels() []string       // 订阅的所有频道
+	GetPatterns() []string       // 订阅的所有模式
 }
@@ -3,3 +3,9 @@ package resp
 type Reply interface {
 	ToBytes() []byte //通信使用字节流
 }
+
+// BlockingReply 阻塞命令暂时无法完成时返回的回复，调用方需要调用Wait等待最终结果，cancel被关闭时放弃等待并返回nil
+type BlockingReply interface {
+	Reply
+	Wait(cancel <-chan struct{}) Reply
+}
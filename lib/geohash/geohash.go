@@ -0,0 +1,237 @@
+// Package geohash 将经纬度编码为52位的geohash整数，可以直接作为有序集合的分数，编码方式与redis保持一致
+package geohash
+
+import (
+	"math"
+)
+
+const (
+	MaxSteps     = 26             // 经度和纬度各自的编码位数，共52位
+	MinLatitude  = -85.05112878   // 墨卡托投影的纬度范围
+	MaxLatitude  = 85.05112878    // 墨卡托投影的纬度范围
+	MinLongitude = -180.0         // 经度范围
+	MaxLongitude = 180.0          // 经度范围
+	EarthRadius  = 6372797.560856 // 地球半径，单位为米
+	mercatorMax  = 20037726.37    // 墨卡托投影的最大距离，单位为米
+	base32       = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// Area geohash对应的矩形区域
+type Area struct {
+	MinLongitude float64
+	MaxLongitude float64
+	MinLatitude  float64
+	MaxLatitude  float64
+}
+
+// ValidCoordinate 判断经纬度是否在可以编码的范围内
+func ValidCoordinate(longitude float64, latitude float64) bool {
+	return longitude >= MinLongitude && longitude <= MaxLongitude &&
+		latitude >= MinLatitude && latitude <= MaxLatitude
+}
+
+// Encode 将经纬度编码为step*2位的geohash，经度位于每一对中的高位
+func Encode(longitude float64, latitude float64, step uint) uint64 {
+	return encodeWithRange(longitude, latitude, MinLatitude, MaxLatitude, step)
+}
+
+func encodeWithRange(longitude float64, latitude float64, minLat float64, maxLat float64, step uint) uint64 {
+	latOffset := (latitude - minLat) / (maxLat - minLat)
+	lonOffset := (longitude - MinLongitude) / (MaxLongitude - MinLongitude)
+	scale := float64(uint64(1) << step)
+	return interleave(scaleOffset(latOffset, scale), scaleOffset(lonOffset, scale))
+}
+
+// scaleOffset 将[0, 1]范围内的偏移量放大为[0, scale)范围内的整数
+func scaleOffset(offset float64, scale float64) uint32 {
+	v := offset * scale
+	if v >= scale { // 恰好位于范围上界
+		v = scale - 1
+	}
+	return uint32(v)
+}
+
+// Decode 返回step*2位的geohash对应的矩形区域
+func Decode(hash uint64, step uint) Area {
+	lat, lon := deinterleave(hash)
+	scale := float64(uint64(1) << step)
+	latScale := MaxLatitude - MinLatitude
+	lonScale := MaxLongitude - MinLongitude
+	return Area{
+		MinLatitude:  MinLatitude + float64(lat)/scale*latScale,
+		MaxLatitude:  MinLatitude + float64(lat+1)/scale*latScale,
+		MinLongitude: MinLongitude + float64(lon)/scale*lonScale,
+		MaxLongitude: MinLongitude + float64(lon+1)/scale*lonScale,
+	}
+}
+
+// DecodeToCoordinate 返回52位geohash对应区域的中心点经纬度
+func DecodeToCoordinate(hash uint64) (longitude float64, latitude float64) {
+	area := Decode(hash, MaxSteps)
+	longitude = math.Max(MinLongitude, math.Min(MaxLongitude, (area.MinLongitude+area.MaxLongitude)/2))
+	latitude = math.Max(MinLatitude, math.Min(MaxLatitude, (area.MinLatitude+area.MaxLatitude)/2))
+	return longitude, latitude
+}
+
+// ToString 将52位的geohash转换为11个字符的标准geohash字符串。
+// 标准geohash的纬度范围是[-90, 90]，需要先按照标准范围重新编码
+func ToString(hash uint64) string {
+	longitude, latitude := DecodeToCoordinate(hash)
+	bits := encodeWithRange(longitude, latitude, -90, 90, MaxSteps)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0 // 只有52位，最后一个字符补0
+		if i < 10 {
+			idx = int(bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+// Distance 使用haversine公式计算两点间的距离，单位为米
+func Distance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	lat1r := toRadians(lat1)
+	lat2r := toRadians(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((toRadians(lon2) - toRadians(lon1)) / 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// LatitudeDistance 计算两个纬度之间的南北距离，单位为米
+func LatitudeDistance(lat1 float64, lat2 float64) float64 {
+	return EarthRadius * math.Abs(toRadians(lat2)-toRadians(lat1))
+}
+
+// BoundingBox 返回以(longitude, latitude)为中心、宽width米高height米的矩形的经纬度范围
+func BoundingBox(longitude float64, latitude float64, width float64, height float64) Area {
+	latDelta := toDegrees(height / 2 / EarthRadius)
+	lonDeltaTop := toDegrees(width / 2 / EarthRadius / math.Cos(toRadians(latitude+latDelta)))
+	lonDeltaBottom := toDegrees(width / 2 / EarthRadius / math.Cos(toRadians(latitude-latDelta)))
+	lonDelta := lonDeltaTop // 北半球靠近极点的一侧经度跨度更大，南半球相反
+	if latitude < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return Area{
+		MinLongitude: longitude - lonDelta,
+		MaxLongitude: longitude + lonDelta,
+		MinLatitude:  latitude - latDelta,
+		MaxLatitude:  latitude + latDelta,
+	}
+}
+
+// EstimateSteps 根据搜索半径估计合适的编码位数，使得一个格子的大小不小于搜索半径
+func EstimateSteps(radius float64, latitude float64) uint {
+	if radius == 0 {
+		return MaxSteps
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2 // 确保搜索范围能被中心格子和周围8个格子覆盖
+	// 高纬度地区格子的实际宽度更小
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxSteps {
+		step = MaxSteps
+	}
+	return uint(step)
+}
+
+// ScoreRange 将step*2位的geohash转换为52位分数的范围[min, max)
+func ScoreRange(hash uint64, step uint) (min uint64, max uint64) {
+	shift := 2 * (MaxSteps - step)
+	return hash << shift, (hash + 1) << shift
+}
+
+// Neighbors 返回以(longitude, latitude)所在格子为中心的3x3共9个格子，已去重，不包括超出纬度范围的格子
+func Neighbors(longitude float64, latitude float64, step uint) []uint64 {
+	scale := float64(uint64(1) << step)
+	lonStep := (MaxLongitude - MinLongitude) / scale
+	latStep := (MaxLatitude - MinLatitude) / scale
+	center := Decode(Encode(longitude, latitude, step), step)
+	centerLon := (center.MinLongitude + center.MaxLongitude) / 2
+	centerLat := (center.MinLatitude + center.MaxLatitude) / 2
+	seen := make(map[uint64]struct{}, 9)
+	hashes := make([]uint64, 0, 9)
+	for _, dLat := range []float64{0, -1, 1} {
+		lat := centerLat + dLat*latStep
+		if lat < MinLatitude || lat > MaxLatitude {
+			continue
+		}
+		for _, dLon := range []float64{0, -1, 1} {
+			lon := centerLon + dLon*lonStep
+			if lon < MinLongitude { // 经度首尾相接
+				lon += MaxLongitude - MinLongitude
+			} else if lon > MaxLongitude {
+				lon -= MaxLongitude - MinLongitude
+			}
+			hash := Encode(lon, lat, step)
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			seen[hash] = struct{}{}
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// Covers 判断以(longitude, latitude)所在格子为中心的3x3个格子是否能覆盖box
+func Covers(longitude float64, latitude float64, step uint, box Area) bool {
+	scale := float64(uint64(1) << step)
+	lonStep := (MaxLongitude - MinLongitude) / scale
+	latStep := (MaxLatitude - MinLatitude) / scale
+	center := Decode(Encode(longitude, latitude, step), step)
+	return center.MinLongitude-lonStep <= box.MinLongitude &&
+		center.MaxLongitude+lonStep >= box.MaxLongitude &&
+		(center.MinLatitude-latStep <= box.MinLatitude || center.MinLatitude-latStep <= MinLatitude) &&
+		(center.MaxLatitude+latStep >= box.MaxLatitude || center.MaxLatitude+latStep >= MaxLatitude)
+}
+
+func interleave(x uint32, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(hash uint64) (x uint32, y uint32) {
+	return squash(hash), squash(hash >> 1)
+}
+
+// spread 将32位整数的每一位分散到64位整数的偶数位上
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// squash spread的逆运算，取出64位整数偶数位上的值
+func squash(v uint64) uint32 {
+	x := v & 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
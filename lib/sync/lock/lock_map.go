@@ -0,0 +1,95 @@
+package lock
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Locks 分段锁，将key按哈希值映射到固定数量的读写锁上，不同的key可能共用同一把锁。
+// 同时锁定多个key时按照锁的序号从小到大加锁，所有调用方加锁顺序一致，因此不会死锁
+type Locks struct {
+	table []*sync.RWMutex
+}
+
+// Make 创建size把锁，size会向上取整为2的幂
+func Make(size int) *Locks {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	table := make([]*sync.RWMutex, n)
+	for i := range table {
+		table[i] = &sync.RWMutex{}
+	}
+	return &Locks{table: table}
+}
+
+// spread 返回key对应的锁的序号
+func (locks *Locks) spread(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() & uint32(len(locks.table)-1))
+}
+
+func (locks *Locks) Lock(key string) {
+	locks.table[locks.spread(key)].Lock()
+}
+
+func (locks *Locks) Unlock(key string) {
+	locks.table[locks.spread(key)].Unlock()
+}
+
+func (locks *Locks) RLock(key string) {
+	locks.table[locks.spread(key)].RLock()
+}
+
+func (locks *Locks) RUnlock(key string) {
+	locks.table[locks.spread(key)].RUnlock()
+}
+
+// toLockIndices 计算需要加的锁及其是否为写锁，按序号从小到大排列。
+// 同一把锁同时对应读key和写key时加写锁，同一把锁只加一次
+func (locks *Locks) toLockIndices(writeKeys []string, readKeys []string) ([]int, map[int]bool) {
+	writeMap := make(map[int]bool, len(writeKeys)+len(readKeys))
+	for _, key := range writeKeys {
+		writeMap[locks.spread(key)] = true
+	}
+	for _, key := range readKeys {
+		index := locks.spread(key)
+		if _, ok := writeMap[index]; !ok {
+			writeMap[index] = false
+		}
+	}
+	indices := make([]int, 0, len(writeMap))
+	for index := range writeMap {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	return indices, writeMap
+}
+
+// RWLocks 对writeKeys加写锁，对readKeys加读锁
+func (locks *Locks) RWLocks(writeKeys []string, readKeys []string) {
+	indices, writeMap := locks.toLockIndices(writeKeys, readKeys)
+	for _, index := range indices {
+		if writeMap[index] {
+			locks.table[index].Lock()
+		} else {
+			locks.table[index].RLock()
+		}
+	}
+}
+
+// RWUnLocks 释放RWLocks加的锁，按加锁的相反顺序释放
+func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
+	indices, writeMap := locks.toLockIndices(writeKeys, readKeys)
+	for i := len(indices) - 1; i >= 0; i-- {
+		index := indices[i]
+		if writeMap[index] {
+			locks.table[index].Unlock()
+		} else {
+			locks.table[index].RUnlock()
+		}
+	}
+}
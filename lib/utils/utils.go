@@ -1,5 +1,10 @@
 package utils
 
+import (
+	"math"
+	"strconv"
+)
+
 // ToCmdLine 将字符串切片转换为字节切片的切片
 func ToCmdLine(cmd ...string) [][]byte {
 	args := make([][]byte, len(cmd)) // 创建一个长度等于cmd长度的二维字节切片
@@ -93,3 +98,23 @@ func ValidateArgs(args [][]byte, expected int) bool {
 	// 最少参数，比如-2表示至少2个参数
 	return argNum >= -expected
 }
+
+// FormatFloat 将浮点数格式化为Redis回复中使用的字符串，正负无穷分别输出为inf和-inf
+func FormatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "inf"
+	}
+	if math.IsInf(f, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// ParseFloat 解析客户端传入的浮点数，支持inf、+inf、-inf，NaN视为非法
+func ParseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,118 @@
+// Package bitmap 在字符串上进行位操作，第0位是第0个字节的最高位，与redis保持一致
+package bitmap
+
+import "math/bits"
+
+// BitMap 位图，底层就是字符串的[]byte，写操作在长度不足时自动扩展
+type BitMap []byte
+
+// FromBytes 将字符串转换为位图，共享底层数组
+func FromBytes(bytes []byte) *BitMap {
+	bm := BitMap(bytes)
+	return &bm
+}
+
+// ToBytes 返回位图对应的字符串
+func (b *BitMap) ToBytes() []byte {
+	return *b
+}
+
+// BitSize 返回位图的总位数
+func (b *BitMap) BitSize() int64 {
+	return int64(len(*b)) * 8
+}
+
+// grow 扩展位图使其至少包含bitSize位，新增的部分填充0
+func (b *BitMap) grow(bitSize int64) {
+	byteSize := (bitSize + 7) / 8
+	if int64(len(*b)) >= byteSize {
+		return
+	}
+	grown := make([]byte, byteSize)
+	copy(grown, *b)
+	*b = grown
+}
+
+// GetBit 返回offset位的值，超出长度时为0
+func (b *BitMap) GetBit(offset int64) byte {
+	index := offset / 8
+	if index >= int64(len(*b)) {
+		return 0
+	}
+	return ((*b)[index] >> (7 - offset%8)) & 1
+}
+
+// SetBit 将offset位设置为value并返回原来的值
+func (b *BitMap) SetBit(offset int64, value byte) byte {
+	b.grow(offset + 1)
+	index := offset / 8
+	shift := 7 - offset%8
+	old := ((*b)[index] >> shift) & 1
+	if value == 0 {
+		(*b)[index] &^= 1 << shift
+	} else {
+		(*b)[index] |= 1 << shift
+	}
+	return old
+}
+
+// CountBits 返回[start, end]位范围内1的个数，调用方保证范围合法
+func (b *BitMap) CountBits(start int64, end int64) int64 {
+	var count int64
+	for start <= end && start%8 != 0 { // 开头不足一个字节的部分
+		count += int64(b.GetBit(start))
+		start++
+	}
+	for ; start+7 <= end; start += 8 {
+		count += int64(bits.OnesCount8((*b)[start/8]))
+	}
+	for ; start <= end; start++ { // 结尾不足一个字节的部分
+		count += int64(b.GetBit(start))
+	}
+	return count
+}
+
+// FindBit 返回[start, end]位范围内第一个值为bit的位置，没有时返回-1
+func (b *BitMap) FindBit(bit byte, start int64, end int64) int64 {
+	var skip byte // 整个字节都不包含bit时可以直接跳过
+	if bit == 0 {
+		skip = 0xff
+	}
+	for start <= end {
+		if start%8 == 0 && start+7 <= end && (*b)[start/8] == skip {
+			start += 8
+			continue
+		}
+		if b.GetBit(start) == bit {
+			return start
+		}
+		start++
+	}
+	return -1
+}
+
+// GetUint 读取从offset开始的width位，作为无符号整数返回，width不超过64
+func (b *BitMap) GetUint(offset int64, width int) uint64 {
+	var value uint64
+	for i := 0; i < width; i++ {
+		value = value<<1 | uint64(b.GetBit(offset+int64(i)))
+	}
+	return value
+}
+
+// GetInt 读取从offset开始的width位，作为有符号整数返回
+func (b *BitMap) GetInt(offset int64, width int) int64 {
+	value := b.GetUint(offset, width)
+	if width < 64 && value&(1<<(width-1)) != 0 { // 符号扩展
+		value |= ^uint64(0) << width
+	}
+	return int64(value)
+}
+
+// SetUint 将value的低width位写入从offset开始的位置
+func (b *BitMap) SetUint(offset int64, width int, value uint64) {
+	b.grow(offset + int64(width))
+	for i := 0; i < width; i++ {
+		b.SetBit(offset+int64(i), byte(value>>(width-1-i))&1)
+	}
+}
@@ -3,6 +3,8 @@ package dict
 import (
 	"github.com/zhangyunhao116/skipmap"
 	"goRedis/interface/meta/dict"
+	"math/rand"
+	"sort"
 )
 
 // SkipListDict Redis核心数据结构之一，线程安全的字典，最底层的用于存储键值对的数据结构
@@ -78,31 +80,67 @@ func (dict *SkipListDict) Keys() []string {
 
 func (dict *SkipListDict) ForEach(consumer dict.Consumer) {
 	dict.m.Range(func(key string, value any) bool {
-		consumer(key, value)
+		return consumer(key, value) // consumer返回false时停止遍历
+	})
+}
+
+// Scan SkipListDict按key的字典序组织，没有可以按桶遍历的结构，因此游标表示key的哈希值下界：
+// 每次调用遍历整个字典，返回哈希值不小于cursor的键值对中哈希值最小的count个，哈希值相同的键值对总是一起返回
+func (dict *SkipListDict) Scan(cursor uint64, count int, consumer dict.Consumer) uint64 {
+	if count <= 0 {
+		count = 1
+	}
+	entries := make([]tableEntry, 0)
+	dict.m.Range(func(key string, value any) bool {
+		if hash := hashKey(key); hash >= cursor {
+			entries = append(entries, tableEntry{key: key, hash: hash, val: value})
+		}
 		return true
 	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+	n := min(count, len(entries))
+	for n < len(entries) && entries[n].hash == entries[n-1].hash {
+		n++
+	}
+	next := uint64(0)
+	if n < len(entries) {
+		next = entries[n].hash
+	}
+	for _, e := range entries[:n] {
+		if !consumer(e.key, e.val) {
+			break
+		}
+	}
+	return next
 }
 
+// RandomKeys 随机返回num个key，可能包含重复的key
 func (dict *SkipListDict) RandomKeys(num int) []string {
-	result := make([]string, 0)
+	keys := dict.Keys()
+	if len(keys) == 0 || num <= 0 {
+		return []string{}
+	}
+	result := make([]string, 0, min(num, len(keys)))
 	for i := 0; i < num; i++ {
-		dict.m.Range(func(key string, value any) bool {
-			result = append(result, key)
-			return false
-		})
+		result = append(result, keys[rand.Intn(len(keys))])
 	}
 	return result
 }
 
+// RandomDistinctKeys 随机返回num个不重复的key，使用蓄水池抽样，只需遍历一次
 func (dict *SkipListDict) RandomDistinctKeys(num int) []string {
-	result := make([]string, 0)
+	if num <= 0 {
+		return []string{}
+	}
+	result := make([]string, 0, min(num, dict.Len()))
 	i := 0
 	dict.m.Range(func(key string, value any) bool {
-		result = append(result, key)
-		i++
-		if i == num {
-			return false
+		if len(result) < num {
+			result = append(result, key)
+		} else if j := rand.Intn(i + 1); j < num {
+			result[j] = key
 		}
+		i++
 		return true
 	})
 	return result
@@ -5,107 +5,123 @@ import (
 	"sync"
 )
 
-// SyncDict Redis核心数据结构之一，线程安全的字典，最底层的用于存储键值对的数据结构
+// SyncDict Redis核心数据结构之一，线程安全的字典，最底层的用于存储键值对的数据结构。
+// 由读写锁保护的哈希表实现，支持游标遍历
 type SyncDict struct {
-	m sync.Map
+	mu    sync.RWMutex
+	table *Table
 }
 
 func NewSyncDict() *SyncDict {
-	return &SyncDict{}
+	return &SyncDict{
+		table: NewTable(),
+	}
 }
 
 func (dict *SyncDict) Get(key string) (val any, exists bool) {
-	val, exists = dict.m.Load(key)
-	return
+	dict.mu.RLock()
+	defer dict.mu.RUnlock()
+	return dict.table.Get(key)
 }
 
 func (dict *SyncDict) Len() int {
-	length := 0
-	dict.m.Range(func(key, value any) bool {
-		length++
-		return true
-	})
-	return length
+	dict.mu.RLock()
+	defer dict.mu.RUnlock()
+	return dict.table.Len()
 }
 
 func (dict *SyncDict) Put(key string, val any) (result int) {
-	_, existed := dict.m.Load(key)
-	dict.m.Store(key, val)
-	result = 1   // 插入操作
-	if existed { // 更新操作
-		result = 0
-	}
-	return
+	dict.mu.Lock()
+	defer dict.mu.Unlock()
+	return dict.table.Put(key, val) // 插入返回1，更新返回0
 }
 
 func (dict *SyncDict) PutIfAbsent(key string, val any) (result int) {
-	_, existed := dict.m.Load(key)
-	if existed { // key存在，不插入
+	dict.mu.Lock()
+	defer dict.mu.Unlock()
+	if _, existed := dict.table.Get(key); existed { // key存在，不插入
 		return 0
 	}
-	dict.m.Store(key, val)
-	return 1
+	return dict.table.Put(key, val)
 }
 
 func (dict *SyncDict) PutIfExist(key string, val any) (result int) {
-	_, existed := dict.m.Load(key)
-	if existed { // key存在，更新
-		dict.m.Store(key, val)
+	dict.mu.Lock()
+	defer dict.mu.Unlock()
+	if _, existed := dict.table.Get(key); existed { // key存在，更新
+		dict.table.Put(key, val)
 		return 1
 	}
 	return 0
 }
 
 func (dict *SyncDict) Remove(key string) (result int) {
-	_, exists := dict.m.Load(key)
-	if exists {
-		dict.m.Delete(key)
-		return 1
-	}
-	return 0
+	dict.mu.Lock()
+	defer dict.mu.Unlock()
+	return dict.table.Remove(key)
 }
 
 func (dict *SyncDict) Keys() []string {
-	result := make([]string, 0)
-	dict.m.Range(func(key, value any) bool {
-		result = append(result, key.(string))
+	dict.mu.RLock()
+	defer dict.mu.RUnlock()
+	result := make([]string, 0, dict.table.Len())
+	dict.table.ForEach(func(key string, val any) bool {
+		result = append(result, key)
 		return true
 	})
 	return result
 }
 
+// ForEach 遍历所有的键值对，consumer返回false时停止遍历。
+// 遍历的是调用时的快照，consumer中可以修改字典
 func (dict *SyncDict) ForEach(consumer dict.Consumer) {
-	dict.m.Range(func(key, value any) bool {
-		consumer(key.(string), value)
+	dict.mu.RLock()
+	entries := make([]tableEntry, 0, dict.table.Len())
+	dict.table.ForEach(func(key string, val any) bool {
+		entries = append(entries, tableEntry{key: key, val: val})
 		return true
 	})
+	dict.mu.RUnlock()
+	for _, e := range entries {
+		if !consumer(e.key, e.val) { // consumer返回false时停止遍历
+			return
+		}
+	}
 }
 
-func (dict *SyncDict) RandomKeys(num int) []string {
-	result := make([]string, 0)
-	for i := 0; i < num; i++ {
-		dict.m.Range(func(key, value any) bool {
-			result = append(result, key.(string))
-			return false
-		})
+// Scan 从cursor开始遍历一部分键值对，返回下一次遍历的游标，0表示遍历结束，游标的语义见Table.Scan。
+// 在锁外调用consumer，consumer中可以修改字典
+func (dict *SyncDict) Scan(cursor uint64, count int, consumer dict.Consumer) uint64 {
+	dict.mu.RLock()
+	entries := make([]tableEntry, 0, count)
+	cursor = dict.table.Scan(cursor, count, func(key string, val any) {
+		entries = append(entries, tableEntry{key: key, val: val})
+	})
+	dict.mu.RUnlock()
+	for _, e := range entries {
+		if !consumer(e.key, e.val) {
+			break
+		}
 	}
-	return result
+	return cursor
+}
+
+// RandomKeys 随机返回num个key，可能包含重复的key
+func (dict *SyncDict) RandomKeys(num int) []string {
+	dict.mu.RLock()
+	defer dict.mu.RUnlock()
+	return dict.table.RandomKeys(num)
 }
 
+// RandomDistinctKeys 随机返回num个不重复的key
 func (dict *SyncDict) RandomDistinctKeys(num int) []string {
-	result := make([]string, 0)
-	i := 0
-	dict.m.Range(func(key, value any) bool {
-		result = append(result, key.(string))
-		i++
-		if i == num {
-			return false
-		}
-		return true
-	})
-	return result
+	dict.mu.RLock()
+	defer dict.mu.RUnlock()
+	return dict.table.RandomDistinctKeys(num)
 }
 
 func (dict *SyncDict) Clear() {
-	*dict = *NewSyncDict() // 将dict指针指向一个新的SyncDict对象，指针指向的旧对象会被GC回收
+	dict.mu.Lock()
+	defer dict.mu.Unlock()
+	dict.table.Clear()
 }
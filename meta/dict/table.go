@@ -0,0 +1,314 @@
+package dict
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+)
+
+const (
+	minTableSize    = 4  // 哈希表的最小桶数
+	rehashBuckets   = 1  // 每次写操作迁移的非空桶数
+	rehashEmptyRate = 10 // 每迁移一个桶最多跳过的空桶数，避免一次操作访问过多的空桶
+)
+
+var hashSeed = maphash.MakeSeed()
+
+func hashKey(key string) uint64 {
+	return maphash.String(hashSeed, key)
+}
+
+// tableEntry 哈希表中的键值对，哈希到同一个桶中的键值对组成链表
+type tableEntry struct {
+	key  string
+	hash uint64
+	val  any
+	next *tableEntry
+}
+
+// Table 链式哈希表，桶数总是2的幂，key所在的桶由哈希值的低位决定。不是线程安全的。
+// 桶数为2的幂使得扩容和缩容时一个桶中的元素只会分散到高位不同的几个桶中，
+// Scan利用这一点实现了与redis相同的游标遍历：遍历期间一直存在的元素至少会被返回一次。
+// 与redis相同采用渐进式rehash：扩容或缩容时先分配新的桶数组，之后每次写操作只迁移少量的桶，
+// 避免一次操作迁移所有的键值对。迁移期间键值对分布在两个桶数组中，新插入的键值对总是放入新的桶数组
+type Table struct {
+	buckets   []*tableEntry
+	rehashTo  []*tableEntry // 正在迁移的目标桶数组，nil表示没有在rehash
+	rehashIdx int           // buckets中下一个需要迁移的桶，之前的桶已经迁移完
+	size      int
+}
+
+func NewTable() *Table {
+	return &Table{}
+}
+
+func (t *Table) Len() int {
+	return t.size
+}
+
+func (t *Table) rehashing() bool {
+	return t.rehashTo != nil
+}
+
+// find 依次在两个桶数组中查找key，已经迁移的桶为空
+func (t *Table) find(key string, hash uint64) *tableEntry {
+	for _, buckets := range [2][]*tableEntry{t.buckets, t.rehashTo} {
+		if len(buckets) == 0 {
+			continue
+		}
+		for e := buckets[hash&uint64(len(buckets)-1)]; e != nil; e = e.next {
+			if e.hash == hash && e.key == key {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Table) Get(key string) (val any, exists bool) {
+	e := t.find(key, hashKey(key))
+	if e == nil {
+		return nil, false
+	}
+	return e.val, true
+}
+
+// Put 插入或更新键值对，插入返回1，更新返回0
+func (t *Table) Put(key string, val any) int {
+	hash := hashKey(key)
+	if e := t.find(key, hash); e != nil {
+		e.val = val
+		return 0
+	}
+	t.rehashStep()
+	if len(t.buckets) == 0 {
+		t.buckets = make([]*tableEntry, minTableSize)
+	} else if !t.rehashing() && t.size >= len(t.buckets) { // 负载因子达到1时扩容
+		t.startRehash(len(t.buckets) * 2)
+	}
+	buckets := t.buckets
+	if t.rehashing() {
+		buckets = t.rehashTo
+	}
+	i := hash & uint64(len(buckets)-1)
+	buckets[i] = &tableEntry{key: key, hash: hash, val: val, next: buckets[i]}
+	t.size++
+	return 1
+}
+
+// Remove 删除键值对，删除成功返回1，key不存在返回0
+func (t *Table) Remove(key string) int {
+	if t.size == 0 {
+		return 0
+	}
+	t.rehashStep()
+	hash := hashKey(key)
+	for _, buckets := range [2][]*tableEntry{t.buckets, t.rehashTo} {
+		if len(buckets) == 0 {
+			continue
+		}
+		for p := &buckets[hash&uint64(len(buckets)-1)]; *p != nil; p = &(*p).next {
+			if (*p).hash == hash && (*p).key == key {
+				*p = (*p).next
+				t.size--
+				if !t.rehashing() && len(t.buckets) > minTableSize && t.size*8 < len(t.buckets) { // 负载因子过低时缩容
+					t.startRehash(len(t.buckets) / 2)
+				}
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// startRehash 分配size个桶的新数组，之后的写操作逐步将键值对迁移过去
+func (t *Table) startRehash(size int) {
+	t.rehashTo = make([]*tableEntry, size)
+	t.rehashIdx = 0
+}
+
+// rehashStep 迁移rehashBuckets个非空桶，最多访问rehashBuckets*rehashEmptyRate个空桶，全部迁移完后替换桶数组
+func (t *Table) rehashStep() {
+	if !t.rehashing() {
+		return
+	}
+	mask := uint64(len(t.rehashTo) - 1)
+	moved, emptyVisits := 0, rehashBuckets*rehashEmptyRate
+	for moved < rehashBuckets && t.rehashIdx < len(t.buckets) {
+		e := t.buckets[t.rehashIdx]
+		if e == nil {
+			t.rehashIdx++
+			emptyVisits--
+			if emptyVisits == 0 {
+				break
+			}
+			continue
+		}
+		for e != nil {
+			next := e.next
+			i := e.hash & mask
+			e.next = t.rehashTo[i]
+			t.rehashTo[i] = e
+			e = next
+		}
+		t.buckets[t.rehashIdx] = nil
+		t.rehashIdx++
+		moved++
+	}
+	if t.rehashIdx == len(t.buckets) {
+		t.buckets = t.rehashTo
+		t.rehashTo = nil
+		t.rehashIdx = 0
+	}
+}
+
+// ForEach 遍历所有的键值对，consumer返回false时停止遍历，遍历过程中不能修改哈希表
+func (t *Table) ForEach(consumer func(key string, val any) bool) {
+	for _, buckets := range [2][]*tableEntry{t.buckets, t.rehashTo} {
+		for _, e := range buckets {
+			for ; e != nil; e = e.next {
+				if !consumer(e.key, e.val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Scan 从cursor开始遍历至少count个键值对(同一个桶中的键值对总是一起返回)，返回下一次遍历的游标，返回0表示遍历结束。
+// 游标按照桶序号的二进制逆序递增，即先遍历高位，这样在两次调用之间扩容或缩容后，已经遍历过的桶对应的新桶仍然在游标之前。
+// 遍历过程中不能修改哈希表
+func (t *Table) Scan(cursor uint64, count int, consumer func(key string, val any)) uint64 {
+	if t.size == 0 {
+		return 0
+	}
+	if count <= 0 {
+		count = 1
+	}
+	visited := 0
+	emptyVisits := count * 10 // 限制一次遍历的空桶个数
+	for {
+		n := 0
+		cursor, n = t.scanStep(cursor, consumer)
+		if n == 0 {
+			emptyVisits--
+		}
+		visited += n
+		if cursor == 0 || visited >= count || emptyVisits <= 0 {
+			return cursor
+		}
+	}
+}
+
+// scanStep 遍历游标对应的桶，返回下一个游标和遍历的键值对个数。
+// rehash期间先遍历较小的桶数组中游标对应的桶，再遍历较大的桶数组中由这个桶扩展出的所有桶，与redis的dictScan相同
+func (t *Table) scanStep(cursor uint64, consumer func(key string, val any)) (uint64, int) {
+	visited := 0
+	visit := func(e *tableEntry) {
+		for ; e != nil; e = e.next {
+			consumer(e.key, e.val)
+			visited++
+		}
+	}
+	if !t.rehashing() {
+		mask := uint64(len(t.buckets) - 1)
+		visit(t.buckets[cursor&mask])
+		return nextCursor(cursor, mask), visited
+	}
+	small, large := t.buckets, t.rehashTo
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	smallMask, largeMask := uint64(len(small)-1), uint64(len(large)-1)
+	visit(small[cursor&smallMask])
+	for {
+		visit(large[cursor&largeMask])
+		cursor = nextCursor(cursor, largeMask)
+		if cursor&(smallMask^largeMask) == 0 { // 较小的桶数组中的桶扩展出的桶都已经遍历
+			return cursor, visited
+		}
+	}
+}
+
+// nextCursor 将游标的高位全部置1后逆序加1，相当于对桶序号做逆序递增
+func nextCursor(cursor uint64, mask uint64) uint64 {
+	cursor |= ^mask
+	return bits.Reverse64(bits.Reverse64(cursor) + 1)
+}
+
+// RandomKeys 随机返回num个key，可能包含重复的key。num由客户端指定，预先分配的空间不超过字典的大小
+func (t *Table) RandomKeys(num int) []string {
+	if t.size == 0 || num <= 0 {
+		return []string{}
+	}
+	result := make([]string, 0, min(num, t.size))
+	for i := 0; i < num; i++ {
+		result = append(result, t.randomEntry().key)
+	}
+	return result
+}
+
+// randomEntry 随机选择一个非空的桶，再从桶中随机选择一个键值对。rehash期间从两个桶数组中还有数据的部分选择
+func (t *Table) randomEntry() *tableEntry {
+	var e *tableEntry
+	for e == nil {
+		if !t.rehashing() {
+			e = t.buckets[rand.Intn(len(t.buckets))]
+			continue
+		}
+		remain := len(t.buckets) - t.rehashIdx
+		if i := rand.Intn(remain + len(t.rehashTo)); i < remain {
+			e = t.buckets[t.rehashIdx+i]
+		} else {
+			e = t.rehashTo[i-remain]
+		}
+	}
+	n := 0
+	for p := e; p != nil; p = p.next {
+		n++
+	}
+	for i := rand.Intn(n); i > 0; i-- {
+		e = e.next
+	}
+	return e
+}
+
+// RandomDistinctKeys 随机返回num个不重复的key。需要的key较少时随机抽样，否则使用蓄水池抽样遍历一次
+func (t *Table) RandomDistinctKeys(num int) []string {
+	if num <= 0 || t.size == 0 {
+		return []string{}
+	}
+	num = min(num, t.size) // 最多返回所有的key，避免之后的计算溢出
+	if num*2 <= t.size {
+		seen := make(map[string]struct{}, num)
+		result := make([]string, 0, num)
+		for len(result) < num {
+			key := t.randomEntry().key
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			result = append(result, key)
+		}
+		return result
+	}
+	result := make([]string, 0, num)
+	i := 0
+	t.ForEach(func(key string, val any) bool {
+		if len(result) < num {
+			result = append(result, key)
+		} else if j := rand.Intn(i + 1); j < num {
+			result[j] = key
+		}
+		i++
+		return true
+	})
+	return result
+}
+
+func (t *Table) Clear() {
+	t.buckets = nil
+	t.rehashTo = nil
+	t.rehashIdx = 0
+	t.size = 0
+}
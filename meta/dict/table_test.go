@@ -0,0 +1,74 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+// scanWhile 用count较小的Scan遍历t，每次调用之间执行modify，返回遍历到的key和遍历期间是否处于rehash
+func scanWhile(t *Table, count int, modify func(step int)) (map[string]int, bool) {
+	seen := make(map[string]int)
+	rehashed := false
+	cursor := uint64(0)
+	for step := 0; ; step++ {
+		cursor = t.Scan(cursor, count, func(key string, val any) {
+			seen[key]++
+		})
+		if cursor == 0 {
+			return seen, rehashed
+		}
+		modify(step)
+		rehashed = rehashed || t.rehashing()
+	}
+}
+
+func TestTableScanWhileGrowing(t *testing.T) {
+	table := NewTable()
+	stable := 1000
+	for i := 0; i < stable; i++ {
+		table.Put("stable"+strconv.Itoa(i), i)
+	}
+	added := 0
+	seen, rehashed := scanWhile(table, 10, func(step int) {
+		for i := 0; i < 50; i++ { // 每次插入的key多于遍历的key，遍历期间会多次扩容
+			table.Put("added"+strconv.Itoa(added), added)
+			added++
+		}
+		table.Remove("added" + strconv.Itoa(added-1)) // 同时删除，删除也会推进rehash
+	})
+	if !rehashed {
+		t.Fatal("table was never rehashing during the scan")
+	}
+	for i := 0; i < stable; i++ {
+		if seen["stable"+strconv.Itoa(i)] == 0 {
+			t.Fatalf("stable%d was not returned", i)
+		}
+	}
+}
+
+func TestTableScanWhileShrinking(t *testing.T) {
+	table := NewTable()
+	stable, temp := 100, 10000
+	for i := 0; i < stable; i++ {
+		table.Put("stable"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < temp; i++ {
+		table.Put("temp"+strconv.Itoa(i), i)
+	}
+	removed := 0
+	seen, rehashed := scanWhile(table, 10, func(step int) {
+		for i := 0; i < 200 && removed < temp; i++ { // 删除大部分key，遍历期间会多次缩容
+			table.Remove("temp" + strconv.Itoa(removed))
+			removed++
+		}
+		table.Put("added"+strconv.Itoa(step), step) // 同时插入，插入也会推进rehash
+	})
+	if !rehashed {
+		t.Fatal("table was never rehashing during the scan")
+	}
+	for i := 0; i < stable; i++ {
+		if seen["stable"+strconv.Itoa(i)] == 0 {
+			t.Fatalf("stable%d was not returned", i)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// Package hyperloglog HyperLogLog基数估计，存储格式与redis保持一致：
+// 16字节的头部(HYLL魔数、编码方式、3字节保留、8字节基数缓存)后面跟着寄存器数据。
+// 寄存器数据有稀疏和稠密两种编码，新建时使用稀疏编码，寄存器的值过大或者稀疏编码过长时转换为稠密编码。
+// 使用2^14个6位寄存器，标准误差约为0.81%
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	precision    = 14                  // 用于选择寄存器的哈希位数
+	registers    = 1 << precision      // 寄存器个数
+	registerMask = registers - 1       // 选择寄存器的掩码
+	registerBits = 6                   // 每个寄存器的位数
+	registerMax  = 1<<registerBits - 1 // 寄存器的最大值
+	hashBits     = 64 - precision      // 用于计算前导0个数的哈希位数
+	headerSize   = 16                  // 头部长度
+	denseSize    = headerSize + registers*registerBits/8
+	hashSeed     = 0xadc83b19              // MurmurHash64A的种子
+	alphaInf     = 0.721347520444481703680 // 寄存器个数趋于无穷时的修正系数
+	sparseMaxLen = 3000                    // 稀疏编码(包括头部)的最大长度，超过后转换为稠密编码
+	encodeDense  = 0
+	encodeSparse = 1
+)
+
+// 稀疏编码的操作码
+const (
+	sparseZeroMaxLen  = 64    // ZERO: 00xxxxxx，表示xxxxxx+1个值为0的寄存器
+	sparseXZeroMaxLen = 16384 // XZERO: 01xxxxxx yyyyyyyy，表示xxxxxxyyyyyyyy+1个值为0的寄存器
+	sparseValMaxValue = 32    // VAL: 1vvvvvxx，表示xx+1个值为vvvvv+1的寄存器
+	sparseValMaxLen   = 4
+)
+
+var (
+	// ErrInvalid 字符串不是合法的HyperLogLog
+	ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value")
+	// ErrCorrupted HyperLogLog的数据已损坏
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+var magic = []byte("HYLL")
+
+// HyperLogLog 直接在字符串上操作的HyperLogLog，不是线程安全的
+type HyperLogLog struct {
+	data []byte
+}
+
+// New 创建一个空的HyperLogLog，使用稀疏编码
+func New() *HyperLogLog {
+	h := &HyperLogLog{}
+	h.data, _ = encodeSparseRegisters(make([]uint8, registers))
+	return h
+}
+
+// Load 从字符串中加载HyperLogLog，字符串格式不合法时返回ErrInvalid。
+// 写操作会直接修改data，调用方需要保证data不与其他数据共享
+func Load(data []byte) (*HyperLogLog, error) {
+	if len(data) < headerSize || string(data[:4]) != string(magic) {
+		return nil, ErrInvalid
+	}
+	switch data[4] {
+	case encodeDense:
+		if len(data) != denseSize {
+			return nil, ErrInvalid
+		}
+	case encodeSparse:
+	default:
+		return nil, ErrInvalid
+	}
+	return &HyperLogLog{data: data}, nil
+}
+
+// Bytes 返回HyperLogLog的字符串表示
+func (h *HyperLogLog) Bytes() []byte {
+	return h.data
+}
+
+// IsSparse 是否为稀疏编码
+func (h *HyperLogLog) IsSparse() bool {
+	return h.data[4] == encodeSparse
+}
+
+// Add 添加元素，有寄存器被修改时返回true
+func (h *HyperLogLog) Add(elements ...[]byte) (bool, error) {
+	if !h.IsSparse() {
+		changed := false
+		for _, element := range elements {
+			index, count := hashElement(element)
+			if getDenseRegister(h.data[headerSize:], index) < count {
+				setDenseRegister(h.data[headerSize:], index, count)
+				changed = true
+			}
+		}
+		if changed {
+			h.invalidateCache()
+		}
+		return changed, nil
+	}
+	// 稀疏编码先解码为寄存器数组，修改完成后重新编码
+	regs, err := h.Registers()
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, element := range elements {
+		index, count := hashElement(element)
+		if regs[index] < count {
+			regs[index] = count
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	h.setRegisters(regs, true)
+	return true, nil
+}
+
+// Count 返回基数估计值，优先使用头部缓存的结果，缓存失效时重新计算并写入缓存
+func (h *HyperLogLog) Count() (int64, error) {
+	if h.data[15]&(1<<7) == 0 {
+		return int64(binary.LittleEndian.Uint64(h.data[8:16])), nil
+	}
+	regs, err := h.Registers()
+	if err != nil {
+		return 0, err
+	}
+	count := estimate(regs)
+	binary.LittleEndian.PutUint64(h.data[8:16], uint64(count))
+	return count, nil
+}
+
+// Registers 返回所有寄存器的值
+func (h *HyperLogLog) Registers() ([]uint8, error) {
+	regs := make([]uint8, registers)
+	if err := h.mergeInto(regs); err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+// mergeInto 将寄存器的值合并到regs中，每个寄存器取较大值
+func (h *HyperLogLog) mergeInto(regs []uint8) error {
+	if !h.IsSparse() {
+		for i := 0; i < registers; i++ {
+			if v := getDenseRegister(h.data[headerSize:], i); v > regs[i] {
+				regs[i] = v
+			}
+		}
+		return nil
+	}
+	index := 0
+	data := h.data[headerSize:]
+	for i := 0; i < len(data); i++ {
+		op := data[i]
+		var runLen int
+		var value uint8
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			runLen = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(data) {
+				return ErrCorrupted
+			}
+			runLen = (int(op&0x3f)<<8 | int(data[i+1])) + 1
+			i++
+		default: // VAL
+			value = (op>>2)&0x1f + 1
+			runLen = int(op&0x03) + 1
+		}
+		if index+runLen > registers {
+			return ErrCorrupted
+		}
+		for j := index; j < index+runLen; j++ {
+			if value > regs[j] {
+				regs[j] = value
+			}
+		}
+		index += runLen
+	}
+	if index != registers {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// setRegisters 用regs替换寄存器数据，allowSparse为true时尽量使用稀疏编码，同时使缓存失效
+func (h *HyperLogLog) setRegisters(regs []uint8, allowSparse bool) {
+	if allowSparse {
+		if data, ok := encodeSparseRegisters(regs); ok {
+			h.data = data
+			return
+		}
+	}
+	h.data = encodeDenseRegisters(regs)
+}
+
+func (h *HyperLogLog) invalidateCache() {
+	h.data[15] |= 1 << 7
+}
+
+// Merge 合并多个HyperLogLog，所有输入都是稀疏编码时结果也尽量使用稀疏编码
+func Merge(hlls ...*HyperLogLog) (*HyperLogLog, error) {
+	regs := make([]uint8, registers)
+	allSparse := true
+	for _, h := range hlls {
+		if err := h.mergeInto(regs); err != nil {
+			return nil, err
+		}
+		allSparse = allSparse && h.IsSparse()
+	}
+	result := &HyperLogLog{}
+	result.setRegisters(regs, allSparse)
+	return result, nil
+}
+
+// CountUnion 返回多个HyperLogLog并集的基数估计值
+func CountUnion(hlls ...*HyperLogLog) (int64, error) {
+	regs := make([]uint8, registers)
+	for _, h := range hlls {
+		if err := h.mergeInto(regs); err != nil {
+			return 0, err
+		}
+	}
+	return estimate(regs), nil
+}
+
+// newHeader 创建头部，缓存标记为失效
+func newHeader(encoding byte, size int) []byte {
+	data := make([]byte, headerSize, size)
+	copy(data, magic)
+	data[4] = encoding
+	data[15] = 1 << 7
+	return data
+}
+
+// encodeDenseRegisters 稠密编码，每个寄存器占6位，低位在前
+func encodeDenseRegisters(regs []uint8) []byte {
+	data := newHeader(encodeDense, denseSize)
+	data = data[:denseSize]
+	for i, v := range regs {
+		if v > 0 {
+			setDenseRegister(data[headerSize:], i, v)
+		}
+	}
+	return data
+}
+
+// encodeSparseRegisters 稀疏编码，寄存器的值超过32或者编码长度超过限制时ok为false
+func encodeSparseRegisters(regs []uint8) (data []byte, ok bool) {
+	data = newHeader(encodeSparse, headerSize+16)
+	for i := 0; i < len(regs); {
+		value := regs[i]
+		runLen := 1
+		for i+runLen < len(regs) && regs[i+runLen] == value {
+			runLen++
+		}
+		i += runLen
+		if value == 0 {
+			for runLen > 0 {
+				if runLen > sparseZeroMaxLen {
+					n := runLen
+					if n > sparseXZeroMaxLen {
+						n = sparseXZeroMaxLen
+					}
+					data = append(data, 0x40|byte((n-1)>>8), byte(n-1))
+					runLen -= n
+				} else {
+					data = append(data, byte(runLen-1))
+					runLen = 0
+				}
+			}
+		} else {
+			if value > sparseValMaxValue {
+				return nil, false
+			}
+			for runLen > 0 {
+				n := runLen
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				data = append(data, 0x80|(value-1)<<2|byte(n-1))
+				runLen -= n
+			}
+		}
+		if len(data) > sparseMaxLen {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// getDenseRegister 读取稠密编码中第index个寄存器
+func getDenseRegister(data []byte, index int) uint8 {
+	pos := index * registerBits
+	b := pos / 8
+	shift := uint(pos % 8)
+	v := uint(data[b]) >> shift
+	if b+1 < len(data) {
+		v |= uint(data[b+1]) << (8 - shift)
+	}
+	return uint8(v & registerMax)
+}
+
+// setDenseRegister 设置稠密编码中第index个寄存器
+func setDenseRegister(data []byte, index int, value uint8) {
+	pos := index * registerBits
+	b := pos / 8
+	shift := uint(pos % 8)
+	data[b] &^= byte(registerMax << shift)
+	data[b] |= byte(uint(value) << shift)
+	if b+1 < len(data) {
+		data[b+1] &^= byte(registerMax >> (8 - shift))
+		data[b+1] |= byte(uint(value) >> (8 - shift))
+	}
+}
+
+// hashElement 计算元素对应的寄存器以及哈希值剩余部分中第一个1出现的位置
+func hashElement(element []byte) (index int, count uint8) {
+	hash := murmurHash64A(element, hashSeed)
+	index = int(hash & registerMask)
+	hash >>= precision
+	hash |= 1 << hashBits // 保证循环能够结束
+	count = 1
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// estimate 使用Otmar Ertl提出的改进算法根据寄存器的值估计基数，与redis的实现相同
+// 寄存器的值可能来自损坏的数据，直方图按照寄存器能表示的最大值分配，大于hashBits+1的值不参与估计
+func estimate(regs []uint8) int64 {
+	var histogram [registerMax + 1]int
+	for _, v := range regs {
+		histogram[v]++
+	}
+	m := float64(registers)
+	z := m * tau((m-float64(histogram[hashBits+1]))/m)
+	for j := hashBits; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return int64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// murmurHash64A 64位的MurmurHash2，按小端序读取
+func murmurHash64A(key []byte, seed uint32) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := uint64(seed) ^ uint64(len(key))*m
+	n := len(key) / 8
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint64(key[i*8:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n*8:]
+	switch len(tail) {
+	case 7:
+		h ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(tail[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
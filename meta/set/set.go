@@ -69,6 +69,16 @@ func (set *Set) ForEach(consumer func(member string) bool) {
 	})
 }
 
+// Scan 从cursor开始遍历至少count个成员，返回下一次遍历的游标，0表示遍历结束
+func (set *Set) Scan(cursor uint64, count int, consumer func(member string) bool) uint64 {
+	if set == nil || set.dict == nil {
+		return 0
+	}
+	return set.dict.Scan(cursor, count, func(key string, val interface{}) bool {
+		return consumer(key)
+	})
+}
+
 func (set *Set) Copy() *Set {
 	result := NewSet()
 	set.ForEach(func(member string) bool {
@@ -100,6 +110,30 @@ func Intersect(sets ...*Set) *Set {
 	return result
 }
 
+// IntersectCount 求多个集合交集的元素个数，limit大于0时数量达到limit即停止计算
+func IntersectCount(limit int, sets ...*Set) int {
+	if len(sets) == 0 {
+		return 0
+	}
+	smallest := sets[0] // 遍历最小的集合，检查其成员是否在其他所有集合中
+	for _, set := range sets {
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+	count := 0
+	smallest.ForEach(func(member string) bool {
+		for _, set := range sets {
+			if !set.Has(member) {
+				return true
+			}
+		}
+		count++
+		return limit <= 0 || count < limit
+	})
+	return count
+}
+
 // Union 求多个集合的并集
 func Union(sets ...*Set) *Set {
 	result := NewSet()
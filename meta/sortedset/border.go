@@ -0,0 +1,145 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Border 有序集合范围查询的边界，分为分数边界(ZRANGEBYSCORE)和字典序边界(ZRANGEBYLEX)
+type Border interface {
+	allowAsMin(element *Element) bool // 作为下界时，元素是否在范围内
+	allowAsMax(element *Element) bool // 作为上界时，元素是否在范围内
+	isEmptyWith(max Border) bool      // 以自身为下界、max为上界的范围是否为空
+}
+
+// ScoreBorder 分数边界，Value可以是正负无穷
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool // 是否为开区间
+}
+
+var (
+	// NegativeInfScoreBorder 分数负无穷
+	NegativeInfScoreBorder = &ScoreBorder{Value: math.Inf(-1)}
+	// PositiveInfScoreBorder 分数正无穷
+	PositiveInfScoreBorder = &ScoreBorder{Value: math.Inf(1)}
+)
+
+var errInvalidScoreBorder = errors.New("ERR min or max is not a float")
+var errInvalidLexBorder = errors.New("ERR min or max not valid string range item")
+
+// ParseScoreBorder 解析分数边界，示例：1.5、(1.5、-inf、+inf
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	switch s {
+	case "inf", "+inf":
+		return PositiveInfScoreBorder, nil
+	case "-inf":
+		return NegativeInfScoreBorder, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return nil, errInvalidScoreBorder
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
+
+func (border *ScoreBorder) allowAsMin(element *Element) bool {
+	if border.Exclude {
+		return element.Score > border.Value
+	}
+	return element.Score >= border.Value
+}
+
+func (border *ScoreBorder) allowAsMax(element *Element) bool {
+	if border.Exclude {
+		return element.Score < border.Value
+	}
+	return element.Score <= border.Value
+}
+
+func (border *ScoreBorder) isEmptyWith(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return true
+	}
+	return border.Value > maxBorder.Value ||
+		(border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))
+}
+
+// 字典序边界中的无穷标记
+const (
+	lexNegativeInf = -1
+	lexPositiveInf = 1
+)
+
+// LexBorder 字典序边界，用于分数相同的元素按成员字典序进行范围查询
+type LexBorder struct {
+	Value   string
+	Exclude bool // 是否为开区间
+	Inf     int  // 0表示非无穷，lexNegativeInf表示"-"，lexPositiveInf表示"+"
+}
+
+// ParseLexBorder 解析字典序边界，示例：[a、(a、-、+
+func ParseLexBorder(s string) (*LexBorder, error) {
+	if s == "-" {
+		return &LexBorder{Inf: lexNegativeInf}, nil
+	}
+	if s == "+" {
+		return &LexBorder{Inf: lexPositiveInf}, nil
+	}
+	if len(s) == 0 {
+		return nil, errInvalidLexBorder
+	}
+	switch s[0] {
+	case '[':
+		return &LexBorder{Value: s[1:]}, nil
+	case '(':
+		return &LexBorder{Value: s[1:], Exclude: true}, nil
+	default:
+		return nil, errInvalidLexBorder
+	}
+}
+
+func (border *LexBorder) allowAsMin(element *Element) bool {
+	if border.Inf != 0 {
+		return border.Inf == lexNegativeInf
+	}
+	if border.Exclude {
+		return element.Member > border.Value
+	}
+	return element.Member >= border.Value
+}
+
+func (border *LexBorder) allowAsMax(element *Element) bool {
+	if border.Inf != 0 {
+		return border.Inf == lexPositiveInf
+	}
+	if border.Exclude {
+		return element.Member < border.Value
+	}
+	return element.Member <= border.Value
+}
+
+func (border *LexBorder) isEmptyWith(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == lexPositiveInf || maxBorder.Inf == lexNegativeInf {
+		return true
+	}
+	if border.Inf == lexNegativeInf || maxBorder.Inf == lexPositiveInf {
+		return false
+	}
+	return border.Value > maxBorder.Value ||
+		(border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude))
+}
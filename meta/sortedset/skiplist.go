@@ -0,0 +1,293 @@
+package sortedset
+
+import "math/rand"
+
+const maxLevel = 16 // 跳表的最大层数
+
+// Element 有序集合中的元素
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// level 节点在某一层的信息
+type level struct {
+	forward *node // 该层的下一个节点
+	span    int64 // 到下一个节点跨越的节点数，用于计算排名
+}
+
+// node 跳表节点
+type node struct {
+	Element
+	backward *node    // 第0层的前一个节点，用于反向遍历
+	level    []*level // level[0]为最底层
+}
+
+// skiplist 按(分数, 成员)升序排列的跳表
+type skiplist struct {
+	header *node
+	tail   *node
+	length int64
+	level  int16
+}
+
+func makeNode(levelNum int16, score float64, member string) *node {
+	n := &node{
+		Element: Element{
+			Member: member,
+			Score:  score,
+		},
+		level: make([]*level, levelNum),
+	}
+	for i := range n.level {
+		n.level[i] = new(level)
+	}
+	return n
+}
+
+func makeSkiplist() *skiplist {
+	return &skiplist{
+		level:  1,
+		header: makeNode(maxLevel, 0, ""),
+	}
+}
+
+// randomLevel 随机生成新节点的层数，每升高一层的概率为1/4
+func randomLevel() int16 {
+	level := int16(1)
+	for level < maxLevel && rand.Int31n(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// lessThan 判断节点是否排在(score, member)之前：先比较分数，分数相同时比较成员的字典序
+func (n *node) lessThan(score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+// insert 插入一个新节点，调用方需保证member不存在
+func (sl *skiplist) insert(member string, score float64) *node {
+	update := make([]*node, maxLevel) // 每一层中新节点的前驱节点
+	rank := make([]int64, maxLevel)   // 每一层前驱节点的排名
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i == sl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.lessThan(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level { // 新节点比当前跳表更高，新增的层由header指向新节点
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = makeNode(level, score, member)
+	for i := int16(0); i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	for i := level; i < sl.level; i++ { // 更高的层跨越了新节点
+		update[i].level[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+// removeNode 删除节点x，update为每一层中x的前驱节点
+func (sl *skiplist) removeNode(x *node, update []*node) {
+	for i := int16(0); i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// remove 删除(score, member)对应的节点，返回是否删除成功
+func (sl *skiplist) remove(member string, score float64) bool {
+	update := make([]*node, maxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.lessThan(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x != nil && x.Score == score && x.Member == member {
+		sl.removeNode(x, update)
+		return true
+	}
+	return false
+}
+
+// getRank 返回(score, member)的排名，排名从1开始，不存在时返回0
+func (sl *skiplist) getRank(member string, score float64) int64 {
+	var rank int64 = 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.lessThan(score, member) ||
+				(x.level[i].forward.Score == score && x.level[i].forward.Member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.header && x.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// getByRank 根据排名获取节点，排名从1开始
+func (sl *skiplist) getByRank(rank int64) *node {
+	var i int64 = 0
+	x := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for x.level[level].forward != nil && i+x.level[level].span <= rank {
+			i += x.level[level].span
+			x = x.level[level].forward
+		}
+		if i == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// hasInRange 判断跳表中是否有元素落在[min, max]范围内
+func (sl *skiplist) hasInRange(min Border, max Border) bool {
+	if min.isEmptyWith(max) {
+		return false
+	}
+	x := sl.tail
+	if x == nil || !min.allowAsMin(&x.Element) { // 最大的元素比下界还小
+		return false
+	}
+	x = sl.header.level[0].forward
+	if x == nil || !max.allowAsMax(&x.Element) { // 最小的元素比上界还大
+		return false
+	}
+	return true
+}
+
+// getFirstInRange 返回范围内的第一个节点，不存在时返回nil
+func (sl *skiplist) getFirstInRange(min Border, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for x.level[level].forward != nil && !min.allowAsMin(&x.level[level].forward.Element) {
+			x = x.level[level].forward
+		}
+	}
+	x = x.level[0].forward
+	if !max.allowAsMax(&x.Element) {
+		return nil
+	}
+	return x
+}
+
+// getLastInRange 返回范围内的最后一个节点，不存在时返回nil
+func (sl *skiplist) getLastInRange(min Border, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for x.level[level].forward != nil && max.allowAsMax(&x.level[level].forward.Element) {
+			x = x.level[level].forward
+		}
+	}
+	if x == sl.header || !min.allowAsMin(&x.Element) {
+		return nil
+	}
+	return x
+}
+
+// removeRange 删除范围内的元素，limit<=0表示不限制删除数量，返回被删除的元素
+func (sl *skiplist) removeRange(min Border, max Border, limit int) []*Element {
+	update := make([]*node, maxLevel)
+	removed := make([]*Element, 0)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !min.allowAsMin(&x.level[i].forward.Element) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	for x != nil && max.allowAsMax(&x.Element) {
+		next := x.level[0].forward
+		removedElement := x.Element
+		removed = append(removed, &removedElement)
+		sl.removeNode(x, update)
+		if limit > 0 && len(removed) == limit {
+			break
+		}
+		x = next
+	}
+	return removed
+}
+
+// removeRangeByRank 删除排名在[start, stop)范围内的元素，排名从1开始，返回被删除的元素
+func (sl *skiplist) removeRangeByRank(start int64, stop int64) []*Element {
+	var i int64 = 0
+	update := make([]*node, maxLevel)
+	removed := make([]*Element, 0)
+	x := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for x.level[level].forward != nil && i+x.level[level].span < start {
+			i += x.level[level].span
+			x = x.level[level].forward
+		}
+		update[level] = x
+	}
+	i++
+	x = x.level[0].forward
+	for x != nil && i < stop {
+		next := x.level[0].forward
+		removedElement := x.Element
+		removed = append(removed, &removedElement)
+		sl.removeNode(x, update)
+		x = next
+		i++
+	}
+	return removed
+}
@@ -0,0 +1,250 @@
+package sortedset
+
+import (
+	"goRedis/meta/dict"
+	"sync"
+)
+
+// SortedSet 有序集合，由成员->元素的哈希表和按分数排序的跳表组成，线程安全
+type SortedSet struct {
+	dict     *dict.Table // member -> *Element
+	skiplist *skiplist
+	mu       sync.RWMutex
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		dict:     dict.NewTable(),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add 添加成员或更新成员的分数，新增成员返回true，更新返回false
+func (s *SortedSet) Add(member string, score float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, exists := s.getElement(member)
+	s.dict.Put(member, &Element{
+		Member: member,
+		Score:  score,
+	})
+	if exists {
+		if score != element.Score { // 分数变化时需要调整在跳表中的位置
+			s.skiplist.remove(member, element.Score)
+			s.skiplist.insert(member, score)
+		}
+		return false
+	}
+	s.skiplist.insert(member, score)
+	return true
+}
+
+func (s *SortedSet) Len() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(s.dict.Len())
+}
+
+// Get 获取成员对应的元素
+func (s *SortedSet) Get(member string) (element *Element, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getElement(member)
+}
+
+func (s *SortedSet) getElement(member string) (*Element, bool) {
+	val, ok := s.dict.Get(member)
+	if !ok {
+		return nil, false
+	}
+	return val.(*Element), true
+}
+
+// Remove 删除成员，返回是否删除成功
+func (s *SortedSet) Remove(member string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.getElement(member)
+	if !ok {
+		return false
+	}
+	s.skiplist.remove(member, element.Score)
+	s.dict.Remove(member)
+	return true
+}
+
+// GetRank 返回成员的排名，排名从0开始，desc为true时按分数从大到小排名
+func (s *SortedSet) GetRank(member string, desc bool) (rank int64, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	element, ok := s.getElement(member)
+	if !ok {
+		return -1, false
+	}
+	rank = s.skiplist.getRank(member, element.Score)
+	if desc {
+		rank = s.skiplist.length - rank
+	} else {
+		rank--
+	}
+	return rank, true
+}
+
+// ForEachByRank 按排名遍历[start, stop)范围内的元素，排名从0开始，consumer返回false时停止遍历
+func (s *SortedSet) ForEachByRank(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	size := s.skiplist.length
+	if start < 0 || start >= size || stop <= start {
+		return
+	}
+	if stop > size {
+		stop = size
+	}
+	var n *node
+	if desc {
+		n = s.skiplist.getByRank(size - start)
+	} else {
+		n = s.skiplist.getByRank(start + 1)
+	}
+	for i := start; i < stop && n != nil; i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByRank 返回排名在[start, stop)范围内的元素，排名从0开始
+func (s *SortedSet) RangeByRank(start int64, stop int64, desc bool) []*Element {
+	result := make([]*Element, 0)
+	s.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		result = append(result, element)
+		return true
+	})
+	return result
+}
+
+// RangeCount 返回落在[min, max]范围内的元素数量
+func (s *SortedSet) RangeCount(min Border, max Border) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	first := s.skiplist.getFirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := s.skiplist.getLastInRange(min, max)
+	firstRank := s.skiplist.getRank(first.Member, first.Score)
+	lastRank := s.skiplist.getRank(last.Member, last.Score)
+	return lastRank - firstRank + 1
+}
+
+// ForEach 遍历落在[min, max]范围内的元素，跳过前offset个，最多遍历limit个(limit<0表示不限制)
+func (s *SortedSet) ForEach(min Border, max Border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n *node
+	if desc {
+		n = s.skiplist.getLastInRange(min, max)
+	} else {
+		n = s.skiplist.getFirstInRange(min, max)
+	}
+	for n != nil && offset > 0 { // 跳过offset个元素
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		offset--
+	}
+	for i := int64(0); n != nil && (limit < 0 || i < limit); i++ {
+		if desc {
+			if !min.allowAsMin(&n.Element) {
+				break
+			}
+		} else if !max.allowAsMax(&n.Element) {
+			break
+		}
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// Range 返回落在[min, max]范围内的元素，跳过前offset个，最多返回limit个(limit<0表示不限制)
+func (s *SortedSet) Range(min Border, max Border, offset int64, limit int64, desc bool) []*Element {
+	result := make([]*Element, 0)
+	s.ForEach(min, max, offset, limit, desc, func(element *Element) bool {
+		result = append(result, element)
+		return true
+	})
+	return result
+}
+
+// RemoveRange 删除落在[min, max]范围内的元素，返回删除的数量
+func (s *SortedSet) RemoveRange(min Border, max Border) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.skiplist.removeRange(min, max, 0)
+	for _, element := range removed {
+		s.dict.Remove(element.Member)
+	}
+	return int64(len(removed))
+}
+
+// RemoveByRank 删除排名在[start, stop)范围内的元素，排名从0开始，返回删除的数量
+func (s *SortedSet) RemoveByRank(start int64, stop int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.skiplist.removeRangeByRank(start+1, stop+1)
+	for _, element := range removed {
+		s.dict.Remove(element.Member)
+	}
+	return int64(len(removed))
+}
+
+// PopMin 删除并返回分数最小的count个元素
+func (s *SortedSet) PopMin(count int) []*Element {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.skiplist.header.level[0].forward
+	if first == nil {
+		return nil
+	}
+	border := &ScoreBorder{Value: first.Score}
+	removed := s.skiplist.removeRange(border, PositiveInfScoreBorder, count)
+	for _, element := range removed {
+		s.dict.Remove(element.Member)
+	}
+	return removed
+}
+
+// Scan 从cursor开始遍历至少count个元素，返回下一次遍历的游标，0表示遍历结束，游标的语义见dict.Table.Scan
+func (s *SortedSet) Scan(cursor uint64, count int, consumer func(element *Element)) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.dict.Scan(cursor, count, func(member string, val any) {
+		consumer(val.(*Element))
+	})
+}
@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingEntry 已经投递给消费者但还没有被确认的消息
+type PendingEntry struct {
+	ID            ID
+	Consumer      *Consumer
+	DeliveryTime  time.Time // 最后一次投递的时间
+	DeliveryCount int64     // 投递次数
+}
+
+// Consumer 消费者组中的消费者
+type Consumer struct {
+	Name       string
+	SeenTime   time.Time // 最后一次尝试读取或认领消息的时间
+	ActiveTime time.Time // 最后一次成功读取或认领消息的时间，零值表示从未成功过
+	pending    map[ID]*PendingEntry
+}
+
+// PendingCount 返回消费者的待确认消息数
+func (c *Consumer) PendingCount() int {
+	return len(c.pending)
+}
+
+// PendingIDs 返回消费者的待确认消息ID，按ID递增排序
+func (c *Consumer) PendingIDs() []ID {
+	ids := make([]ID, 0, len(c.pending))
+	for id := range c.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// Group 消费者组
+type Group struct {
+	Name        string
+	LastID      ID    // 最后投递给组内消费者的消息ID
+	EntriesRead int64 // 组内已读消息数，-1表示未知
+	pel         map[ID]*PendingEntry
+	pelIDs      []ID // 按ID排序的待确认消息ID，用于范围查询
+	consumers   map[string]*Consumer
+}
+
+// CreateGroup 创建消费者组，组已经存在时返回nil
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) *Group {
+	if _, ok := s.groups[name]; ok {
+		return nil
+	}
+	group := &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		pel:         make(map[ID]*PendingEntry),
+		consumers:   make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group
+}
+
+// GetGroup 返回指定名称的消费者组
+func (s *Stream) GetGroup(name string) *Group {
+	return s.groups[name]
+}
+
+// DestroyGroup 删除消费者组，返回是否删除成功
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 返回所有消费者组，按名称排序
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Lag 返回消费者组还没有读取的消息数，无法计算时ok为false
+func (s *Stream) Lag(group *Group) (lag int64, ok bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if group.EntriesRead >= 0 && !s.HasTombstones(group.LastID) {
+		return s.entriesAdded - group.EntriesRead, true
+	}
+	entriesRead, ok := s.EstimateEntriesRead(group.LastID)
+	if !ok {
+		return 0, false
+	}
+	return s.entriesAdded - entriesRead, true
+}
+
+// MarkDelivered 将消费者组的最后投递ID更新为id，并相应地更新已读消息数
+func (s *Stream) MarkDelivered(group *Group, id ID) {
+	group.LastID = id
+	if group.EntriesRead >= 0 && !s.HasTombstones(id) {
+		group.EntriesRead++
+		return
+	}
+	if entriesRead, ok := s.EstimateEntriesRead(id); ok {
+		group.EntriesRead = entriesRead
+	} else {
+		group.EntriesRead = -1
+	}
+}
+
+// GetConsumer 返回指定名称的消费者
+func (g *Group) GetConsumer(name string) *Consumer {
+	return g.consumers[name]
+}
+
+// CreateConsumer 创建消费者，已经存在时返回已有的消费者，created表示是否新建
+func (g *Group) CreateConsumer(name string, now time.Time) (consumer *Consumer, created bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer = &Consumer{
+		Name:     name,
+		SeenTime: now,
+		pending:  make(map[ID]*PendingEntry),
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除消费者及其所有待确认消息，返回删除的待确认消息数，消费者不存在时返回-1
+func (g *Group) DeleteConsumer(name string) int {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return -1
+	}
+	count := len(consumer.pending)
+	for id := range consumer.pending {
+		g.removePending(id)
+	}
+	delete(g.consumers, name)
+	return count
+}
+
+// Consumers 返回所有消费者，按名称排序
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+// PendingCount 返回待确认消息数
+func (g *Group) PendingCount() int {
+	return len(g.pel)
+}
+
+// GetPending 返回指定ID的待确认消息
+func (g *Group) GetPending(id ID) *PendingEntry {
+	return g.pel[id]
+}
+
+// AddPending 将消息投递给consumer，消息已经在待确认列表中时转移给consumer。
+// 返回对应的待确认消息，调用方负责更新投递时间和投递次数
+func (g *Group) AddPending(id ID, consumer *Consumer) *PendingEntry {
+	if pending, ok := g.pel[id]; ok {
+		delete(pending.Consumer.pending, id)
+		pending.Consumer = consumer
+		consumer.pending[id] = pending
+		return pending
+	}
+	pending := &PendingEntry{ID: id, Consumer: consumer}
+	g.pel[id] = pending
+	consumer.pending[id] = pending
+	// 投递的消息ID通常是递增的，大部分情况下直接追加到末尾
+	i := len(g.pelIDs)
+	if i > 0 && id.Less(g.pelIDs[i-1]) {
+		i = sort.Search(len(g.pelIDs), func(j int) bool { return !g.pelIDs[j].Less(id) })
+	}
+	g.pelIDs = append(g.pelIDs, ID{})
+	copy(g.pelIDs[i+1:], g.pelIDs[i:])
+	g.pelIDs[i] = id
+	return pending
+}
+
+// Ack 确认消息，将其从待确认列表中移除，返回消息是否在待确认列表中
+func (g *Group) Ack(id ID) bool {
+	if _, ok := g.pel[id]; !ok {
+		return false
+	}
+	g.removePending(id)
+	return true
+}
+
+func (g *Group) removePending(id ID) {
+	pending := g.pel[id]
+	delete(pending.Consumer.pending, id)
+	delete(g.pel, id)
+	i := sort.Search(len(g.pelIDs), func(j int) bool { return !g.pelIDs[j].Less(id) })
+	g.pelIDs = append(g.pelIDs[:i], g.pelIDs[i+1:]...)
+}
+
+// PendingRange 按ID递增的顺序遍历ID在[start, end]范围内的待确认消息，consumer返回false时停止。
+// 遍历过程中不能修改待确认列表
+func (g *Group) PendingRange(start ID, end ID, consumer func(pending *PendingEntry) bool) {
+	i := sort.Search(len(g.pelIDs), func(j int) bool { return !g.pelIDs[j].Less(start) })
+	for _, id := range g.pelIDs[i:] {
+		if end.Less(id) || !consumer(g.pel[id]) {
+			return
+		}
+	}
+}
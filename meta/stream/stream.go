@@ -0,0 +1,413 @@
+// Package stream 流类型，消息按照ID递增的顺序保存在固定大小的块中，块按照第一条消息的ID有序排列，
+// 相当于只有两层的B+树：查找时先二分查找块，再在块内二分查找。
+// 消息总是追加到最后一个块，删除消息时直接从块中移除，块为空时删除该块
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const blockMaxEntries = 100 // 每个块最多保存的消息数
+
+var (
+	// ErrInvalidID ID格式错误
+	ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+)
+
+// ID 消息ID，由毫秒时间戳和同一毫秒内的序号组成
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinID 最小的ID 0-0
+	MinID = ID{}
+	// MaxID 最大的ID
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// ParseID 解析ms-seq格式的ID，只有ms时序号取defaultSeq
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// String 返回ms-seq格式的ID
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 比较两个ID，id小于other时返回-1，相等时返回0，大于时返回1
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Less 判断id是否小于other
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// IsZero 判断是否为0-0
+func (id ID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Next 返回比id大的最小ID，已经是最大ID时ok为false
+func (id ID) Next() (next ID, ok bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev 返回比id小的最大ID，已经是最小ID时ok为false
+func (id ID) Prev() (prev ID, ok bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// Entry 流中的一条消息
+type Entry struct {
+	ID     ID
+	Fields [][]byte // field value field value ...
+}
+
+// block 保存连续的一段消息
+type block struct {
+	entries []*Entry
+}
+
+func (b *block) first() ID {
+	return b.entries[0].ID
+}
+
+func (b *block) last() ID {
+	return b.entries[len(b.entries)-1].ID
+}
+
+// Stream 流，不是线程安全的
+type Stream struct {
+	blocks       []*block
+	length       int64
+	lastID       ID                // 最后生成的ID，消息被删除后也不会变小
+	maxDeletedID ID                // 被删除的消息中最大的ID
+	entriesAdded int64             // 添加过的消息总数
+	groups       map[string]*Group // 消费者组
+}
+
+// NewStream 创建一个空的流
+func NewStream() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+// Len 返回消息个数
+func (s *Stream) Len() int64 {
+	return s.length
+}
+
+// LastID 返回最后生成的ID
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// SetLastID 设置最后生成的ID，只能比当前最后一条消息大
+func (s *Stream) SetLastID(id ID) {
+	s.lastID = id
+}
+
+// MaxDeletedID 返回被删除的消息中最大的ID
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// SetMaxDeletedID 设置被删除的消息中最大的ID，用于从快照中恢复
+func (s *Stream) SetMaxDeletedID(id ID) {
+	s.maxDeletedID = id
+}
+
+// EntriesAdded 返回添加过的消息总数
+func (s *Stream) EntriesAdded() int64 {
+	return s.entriesAdded
+}
+
+// SetEntriesAdded 设置添加过的消息总数，用于从快照中恢复
+func (s *Stream) SetEntriesAdded(n int64) {
+	s.entriesAdded = n
+}
+
+// BlockCount 返回块的个数
+func (s *Stream) BlockCount() int {
+	return len(s.blocks)
+}
+
+// NextID 根据当前时间生成新的ID，时间回拨时沿用最后的时间戳
+func (s *Stream) NextID(nowMs uint64) (ID, bool) {
+	if nowMs > s.lastID.Ms {
+		return ID{Ms: nowMs}, true
+	}
+	return s.lastID.Next()
+}
+
+// NextSeqID 生成指定时间戳下的新ID
+func (s *Stream) NextSeqID(ms uint64) (ID, bool) {
+	if ms > s.lastID.Ms {
+		if ms == 0 { // 0-0不是合法ID
+			return ID{Ms: 0, Seq: 1}, true
+		}
+		return ID{Ms: ms}, true
+	}
+	if ms == s.lastID.Ms && s.lastID.Seq < math.MaxUint64 {
+		return ID{Ms: ms, Seq: s.lastID.Seq + 1}, true
+	}
+	return ID{}, false
+}
+
+// Add 添加消息，调用方需要保证id比LastID大
+func (s *Stream) Add(id ID, fields [][]byte) {
+	entry := &Entry{ID: id, Fields: fields}
+	if len(s.blocks) == 0 || len(s.blocks[len(s.blocks)-1].entries) >= blockMaxEntries {
+		s.blocks = append(s.blocks, &block{entries: make([]*Entry, 0, blockMaxEntries)})
+	}
+	last := s.blocks[len(s.blocks)-1]
+	last.entries = append(last.entries, entry)
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// First 返回第一条消息
+func (s *Stream) First() *Entry {
+	if len(s.blocks) == 0 {
+		return nil
+	}
+	return s.blocks[0].entries[0]
+}
+
+// Last 返回最后一条消息
+func (s *Stream) Last() *Entry {
+	if len(s.blocks) == 0 {
+		return nil
+	}
+	last := s.blocks[len(s.blocks)-1]
+	return last.entries[len(last.entries)-1]
+}
+
+// locate 返回id所在的块以及在块内的位置，不存在时返回第一个大于id的位置
+func (s *Stream) locate(id ID) (blockIndex int, entryIndex int) {
+	blockIndex = sort.Search(len(s.blocks), func(i int) bool {
+		return !s.blocks[i].last().Less(id)
+	})
+	if blockIndex == len(s.blocks) {
+		return blockIndex, 0
+	}
+	entries := s.blocks[blockIndex].entries
+	entryIndex = sort.Search(len(entries), func(i int) bool {
+		return !entries[i].ID.Less(id)
+	})
+	return blockIndex, entryIndex
+}
+
+// Get 返回指定ID的消息
+func (s *Stream) Get(id ID) *Entry {
+	bi, ei := s.locate(id)
+	if bi == len(s.blocks) {
+		return nil
+	}
+	entry := s.blocks[bi].entries[ei]
+	if entry.ID != id {
+		return nil
+	}
+	return entry
+}
+
+// Range 返回ID在[start, end]范围内的消息，count<=0表示不限制个数，reverse为true时从end开始倒序返回
+func (s *Stream) Range(start ID, end ID, count int, reverse bool) []*Entry {
+	result := make([]*Entry, 0)
+	if end.Less(start) {
+		return result
+	}
+	if !reverse {
+		bi, ei := s.locate(start)
+		for ; bi < len(s.blocks); bi, ei = bi+1, 0 {
+			for _, entry := range s.blocks[bi].entries[ei:] {
+				if end.Less(entry.ID) || (count > 0 && len(result) >= count) {
+					return result
+				}
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+	bi, ei := s.locate(end)
+	if bi < len(s.blocks) && s.blocks[bi].entries[ei].ID == end {
+		ei++ // 包含end本身
+	}
+	for ; bi >= 0; bi-- {
+		if bi < len(s.blocks) {
+			entries := s.blocks[bi].entries[:ei]
+			for i := len(entries) - 1; i >= 0; i-- {
+				if entries[i].ID.Less(start) || (count > 0 && len(result) >= count) {
+					return result
+				}
+				result = append(result, entries[i])
+			}
+		}
+		if bi > 0 {
+			ei = len(s.blocks[bi-1].entries)
+		}
+	}
+	return result
+}
+
+// Delete 删除指定ID的消息，返回是否删除成功
+func (s *Stream) Delete(id ID) bool {
+	bi, ei := s.locate(id)
+	if bi == len(s.blocks) || s.blocks[bi].entries[ei].ID != id {
+		return false
+	}
+	b := s.blocks[bi]
+	b.entries = append(b.entries[:ei], b.entries[ei+1:]...)
+	if len(b.entries) == 0 {
+		s.blocks = append(s.blocks[:bi], s.blocks[bi+1:]...)
+	}
+	s.length--
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// TrimByLen 从头部删除消息直到消息数不超过maxLen，返回删除的消息数。
+// approx为true时只删除整块，最终消息数可能略多于maxLen；limit>0时限制删除的消息数
+func (s *Stream) TrimByLen(maxLen int64, approx bool, limit int64) int64 {
+	return s.trim(func(b *block) int {
+		excess := s.length - maxLen
+		if excess <= 0 {
+			return 0
+		}
+		if excess < int64(len(b.entries)) {
+			return int(excess)
+		}
+		return len(b.entries)
+	}, approx, limit)
+}
+
+// TrimByMinID 从头部删除ID小于minID的消息，返回删除的消息数，approx和limit的含义与TrimByLen相同
+func (s *Stream) TrimByMinID(minID ID, approx bool, limit int64) int64 {
+	return s.trim(func(b *block) int {
+		return sort.Search(len(b.entries), func(i int) bool {
+			return !b.entries[i].ID.Less(minID)
+		})
+	}, approx, limit)
+}
+
+// trim 从第一个块开始，删除每个块中前toRemove(block)条消息
+func (s *Stream) trim(toRemove func(b *block) int, approx bool, limit int64) int64 {
+	var removed int64
+	for len(s.blocks) > 0 {
+		b := s.blocks[0]
+		n := toRemove(b)
+		if n == 0 {
+			break
+		}
+		if limit > 0 && removed+int64(n) > limit {
+			n = int(limit - removed)
+			if approx || n == 0 {
+				break
+			}
+		}
+		if n < len(b.entries) {
+			if approx { // 近似裁剪只删除整块
+				break
+			}
+			b.entries = b.entries[n:]
+			s.length -= int64(n)
+			removed += int64(n)
+			break
+		}
+		s.blocks = s.blocks[1:]
+		s.length -= int64(n)
+		removed += int64(n)
+	}
+	return removed
+}
+
+// FirstID 返回第一条消息的ID，流为空时返回0-0
+func (s *Stream) FirstID() ID {
+	if first := s.First(); first != nil {
+		return first.ID
+	}
+	return MinID
+}
+
+// HasTombstones 判断ID不小于start的范围内是否有被XDEL删除的消息
+func (s *Stream) HasTombstones(start ID) bool {
+	if s.length == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	return !s.maxDeletedID.Less(start)
+}
+
+// EstimateEntriesRead 估计ID不大于id的消息在历史上一共添加过多少条，即消费者组读到id时的已读消息数，无法估计时ok为false
+func (s *Stream) EstimateEntriesRead(id ID) (entriesRead int64, ok bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	cmpLast := id.Compare(s.lastID)
+	if s.length == 0 && cmpLast <= 0 {
+		return s.entriesAdded, true
+	}
+	if cmpLast == 0 {
+		return s.entriesAdded, true
+	}
+	if cmpLast > 0 {
+		return 0, false
+	}
+	firstID := s.FirstID()
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Less(firstID) { // 第一条消息之后没有空洞
+		switch id.Compare(firstID) {
+		case -1:
+			return s.entriesAdded - s.length, true
+		case 0:
+			return s.entriesAdded - s.length + 1, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,259 @@
+// Package pubsub 发布订阅
+package pubsub
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/lib/wildcard"
+	"goRedis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	messageBytes      = []byte("message")
+	pmessageBytes     = []byte("pmessage")
+	subscribeBytes    = []byte("subscribe")
+	unsubscribeBytes  = []byte("unsubscribe")
+	psubscribeBytes   = []byte("psubscribe")
+	punsubscribeBytes = []byte("punsubscribe")
+)
+
+// patternSubscribers 订阅同一个模式的连接
+type patternSubscribers struct {
+	pattern     *wildcard.Pattern
+	subscribers map[resp.Connection]struct{}
+}
+
+// Hub 发布订阅中心，记录频道和模式的订阅者。
+// 订阅和取消订阅的确认消息在持有锁时直接写入连接，保证订阅者先收到确认消息再收到发布的消息
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[resp.Connection]struct{} // 频道 -> 订阅者
+	patterns map[string]*patternSubscribers          // 模式 -> 订阅者
+}
+
+func MakeHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[resp.Connection]struct{}),
+		patterns: make(map[string]*patternSubscribers),
+	}
+}
+
+// makeMsg 生成订阅相关的确认消息：[类型, 频道或模式, 连接订阅的总数]
+func makeMsg(t []byte, channel string, count int) []byte {
+	return []byte("*3" + reply.CRLF +
+		"$" + strconv.Itoa(len(t)) + reply.CRLF + string(t) + reply.CRLF +
+		"$" + strconv.Itoa(len(channel)) + reply.CRLF + channel + reply.CRLF +
+		":" + strconv.Itoa(count) + reply.CRLF)
+}
+
+// makeNullMsg 没有订阅任何频道时取消订阅的确认消息：[类型, nil, 0]
+func makeNullMsg(t []byte) []byte {
+	return []byte("*3" + reply.CRLF +
+		"$" + strconv.Itoa(len(t)) + reply.CRLF + string(t) + reply.CRLF +
+		"$-1" + reply.CRLF +
+		":0" + reply.CRLF)
+}
+
+// Subscribe SUBSCRIBE channel [channel ...]
+func (hub *Hub) Subscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, arg := range args {
+		channel := string(arg)
+		subscribers, ok := hub.channels[channel]
+		if !ok {
+			subscribers = make(map[resp.Connection]struct{})
+			hub.channels[channel] = subscribers
+		}
+		subscribers[c] = struct{}{}
+		c.Subscribe(channel)
+		_ = c.Write(makeMsg(subscribeBytes, channel, c.SubsCount()))
+	}
+	return reply.NewNoReply()
+}
+
+// PSubscribe PSUBSCRIBE pattern [pattern ...]
+func (hub *Hub) PSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, arg := range args {
+		pattern := string(arg)
+		subscribers, ok := hub.patterns[pattern]
+		if !ok {
+			subscribers = &patternSubscribers{
+				pattern:     wildcard.CompilePattern(pattern),
+				subscribers: make(map[resp.Connection]struct{}),
+			}
+			hub.patterns[pattern] = subscribers
+		}
+		subscribers.subscribers[c] = struct{}{}
+		c.PSubscribe(pattern)
+		_ = c.Write(makeMsg(psubscribeBytes, pattern, c.SubsCount()))
+	}
+	return reply.NewNoReply()
+}
+
+// Unsubscribe UNSUBSCRIBE [channel ...]，没有指定频道时取消订阅所有频道
+func (hub *Hub) Unsubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	channels := toStrings(args)
+	if len(channels) == 0 {
+		channels = c.GetChannels()
+	}
+	if len(channels) == 0 {
+		_ = c.Write(makeNullMsg(unsubscribeBytes))
+		return reply.NewNoReply()
+	}
+	for _, channel := range channels {
+		hub.unsubscribe(c, channel)
+		_ = c.Write(makeMsg(unsubscribeBytes, channel, c.SubsCount()))
+	}
+	return reply.NewNoReply()
+}
+
+// PUnsubscribe PUNSUBSCRIBE [pattern ...]，没有指定模式时取消订阅所有模式
+func (hub *Hub) PUnsubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	patterns := toStrings(args)
+	if len(patterns) == 0 {
+		patterns = c.GetPatterns()
+	}
+	if len(patterns) == 0 {
+		_ = c.Write(makeNullMsg(punsubscribeBytes))
+		return reply.NewNoReply()
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe(c, pattern)
+		_ = c.Write(makeMsg(punsubscribeBytes, pattern, c.SubsCount()))
+	}
+	return reply.NewNoReply()
+}
+
+// UnsubscribeAll 连接关闭时取消所有订阅，不发送确认消息
+func (hub *Hub) UnsubscribeAll(c resp.Connection) {
+	if c.SubsCount() == 0 {
+		return
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, channel := range c.GetChannels() {
+		hub.unsubscribe(c, channel)
+	}
+	for _, pattern := range c.GetPatterns() {
+		hub.punsubscribe(c, pattern)
+	}
+}
+
+func (hub *Hub) unsubscribe(c resp.Connection, channel string) {
+	c.UnSubscribe(channel)
+	subscribers, ok := hub.channels[channel]
+	if !ok {
+		return
+	}
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(hub.channels, channel)
+	}
+}
+
+func (hub *Hub) punsubscribe(c resp.Connection, pattern string) {
+	c.PUnSubscribe(pattern)
+	subscribers, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(subscribers.subscribers, c)
+	if len(subscribers.subscribers) == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+// Publish PUBLISH channel message，向订阅频道和匹配模式的连接推送消息，返回收到消息的连接数
+func (hub *Hub) Publish(args [][]byte) resp.Reply {
+	channel := string(args[0])
+	message := args[1]
+
+	// 在锁内生成推送列表，锁外写入，避免慢连接阻塞订阅操作
+	type push struct {
+		conn resp.Connection
+		data []byte
+	}
+	var pushes []push
+	hub.mu.RLock()
+	if subscribers, ok := hub.channels[channel]; ok {
+		data := reply.NewMultiBulkReply([][]byte{messageBytes, args[0], message}).ToBytes()
+		for c := range subscribers {
+			pushes = append(pushes, push{conn: c, data: data})
+		}
+	}
+	for pattern, subscribers := range hub.patterns {
+		if !subscribers.pattern.IsMatch(channel) {
+			continue
+		}
+		data := reply.NewMultiBulkReply([][]byte{pmessageBytes, []byte(pattern), args[0], message}).ToBytes()
+		for c := range subscribers.subscribers {
+			pushes = append(pushes, push{conn: c, data: data})
+		}
+	}
+	hub.mu.RUnlock()
+
+	for _, p := range pushes {
+		_ = p.conn.Write(p.data)
+	}
+	return reply.NewIntReply(int64(len(pushes)))
+}
+
+// PubSub PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func (hub *Hub) PubSub(args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.NewArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		channels := make([]string, 0, len(hub.channels))
+		for channel := range hub.channels {
+			if pattern == nil || pattern.IsMatch(channel) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		result := make([][]byte, len(channels))
+		for i, channel := range channels {
+			result[i] = []byte(channel)
+		}
+		return reply.NewMultiBulkReply(result)
+	case "numsub":
+		result := make([]resp.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			result = append(result, reply.NewBulkReply(arg), reply.NewIntReply(int64(len(hub.channels[string(arg)]))))
+		}
+		return reply.NewMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply("pubsub|numpat")
+		}
+		return reply.NewIntReply(int64(len(hub.patterns)))
+	default:
+		return reply.NewStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+	}
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
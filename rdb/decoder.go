@@ -0,0 +1,389 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"goRedis/interface/database"
+	"goRedis/meta/dict"
+	"goRedis/meta/list"
+	"goRedis/meta/set"
+	"goRedis/meta/sortedset"
+	"goRedis/meta/stream"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const maxPrealloc = 1 << 20 // 读取字符串时预先分配内存的上限
+
+// Decoder 从快照中解码键值对
+type Decoder struct {
+	r   *bufio.Reader
+	crc hash.Hash64
+	one [1]byte
+}
+
+// NewDecoder 创建解码器。r为*bufio.Reader时直接使用，解码只会读取到快照结尾，
+// 之后可以继续从r中读取快照之后的数据，如AOF文件中快照前缀之后的命令
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{
+		r:   br,
+		crc: crc64.New(crcTable),
+	}
+}
+
+// Consumer 处理解码出的键值对，expiration为nil表示没有过期时间，返回false时停止解码
+type Consumer = database.DataConsumer
+
+// Parse 解码整个快照，校验文件头和校验和，每解码出一个键值对调用一次consumer
+func (dec *Decoder) Parse(consumer Consumer) error {
+	header := make([]byte, HeaderSize)
+	if err := dec.readFull(header); err != nil {
+		return err
+	}
+	if !IsRDB(header) {
+		return ErrInvalidFormat
+	}
+	if string(header[len(magic):]) != version {
+		return errors.New("rdb: unsupported version " + string(header[len(magic):]))
+	}
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		op, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opEOF:
+			sum := dec.crc.Sum64()
+			var b [8]byte
+			if _, err := io.ReadFull(dec.r, b[:]); err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint64(b[:]) != sum {
+				return ErrChecksum
+			}
+			return nil
+		case opSelectDB:
+			n, err := dec.readUvarint()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(n)
+		case opExpireTimeMs:
+			var b [8]byte
+			if err := dec.readFull(b[:]); err != nil {
+				return err
+			}
+			t := time.UnixMilli(int64(binary.LittleEndian.Uint64(b[:])))
+			expiration = &t
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			data, err := dec.readValue(op)
+			if err != nil {
+				return err
+			}
+			if !consumer(dbIndex, key, database.NewDataEntity(data), expiration) {
+				return nil
+			}
+			expiration = nil
+		}
+	}
+}
+
+// readValue 按照类型解码值
+func (dec *Decoder) readValue(valueType byte) (any, error) {
+	switch valueType {
+	case typeString:
+		return dec.readBytes()
+	case typeList:
+		n, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		data := list.NewQuickList()
+		for i := uint64(0); i < n; i++ {
+			value, err := dec.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			data.Add(value)
+		}
+		return data, nil
+	case typeSet:
+		n, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		data := set.NewSet()
+		for i := uint64(0); i < n; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			data.Add(member)
+		}
+		return data, nil
+	case typeZSet:
+		n, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		data := sortedset.NewSortedSet()
+		for i := uint64(0); i < n; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			score, err := dec.readFloat()
+			if err != nil {
+				return nil, err
+			}
+			data.Add(member, score)
+		}
+		return data, nil
+	case typeHash:
+		n, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		data := dict.NewSyncDict()
+		for i := uint64(0); i < n; i++ {
+			field, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := dec.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			data.Put(field, value)
+		}
+		return data, nil
+	case typeStream:
+		return dec.readStream()
+	default:
+		return nil, errors.New("rdb: unknown value type " + strconv.Itoa(int(valueType)))
+	}
+}
+
+// readStream 解码流的消息、元信息和消费者组
+func (dec *Decoder) readStream() (*stream.Stream, error) {
+	s := stream.NewStream()
+	n, err := dec.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		id, err := dec.readID()
+		if err != nil {
+			return nil, err
+		}
+		count, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		fields := make([][]byte, count)
+		for j := range fields {
+			if fields[j], err = dec.readBytes(); err != nil {
+				return nil, err
+			}
+		}
+		s.Add(id, fields)
+	}
+	lastID, err := dec.readID()
+	if err != nil {
+		return nil, err
+	}
+	maxDeletedID, err := dec.readID()
+	if err != nil {
+		return nil, err
+	}
+	entriesAdded, err := dec.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	s.SetLastID(lastID)
+	s.SetMaxDeletedID(maxDeletedID)
+	s.SetEntriesAdded(entriesAdded)
+
+	groupCount, err := dec.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groupCount; i++ {
+		name, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		groupLastID, err := dec.readID()
+		if err != nil {
+			return nil, err
+		}
+		entriesRead, err := dec.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		group := s.CreateGroup(name, groupLastID, entriesRead)
+		if group == nil {
+			return nil, errors.New("rdb: duplicate stream group " + name)
+		}
+		consumerCount, err := dec.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < consumerCount; j++ {
+			if err := dec.readConsumer(group); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// readConsumer 解码消费者及其待确认消息
+func (dec *Decoder) readConsumer(group *stream.Group) error {
+	name, err := dec.readString()
+	if err != nil {
+		return err
+	}
+	seenTime, err := dec.readTime()
+	if err != nil {
+		return err
+	}
+	activeTime, err := dec.readTime()
+	if err != nil {
+		return err
+	}
+	consumer, _ := group.CreateConsumer(name, seenTime)
+	consumer.ActiveTime = activeTime
+	n, err := dec.readUvarint()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		id, err := dec.readID()
+		if err != nil {
+			return err
+		}
+		deliveryTime, err := dec.readTime()
+		if err != nil {
+			return err
+		}
+		deliveryCount, err := dec.readVarint()
+		if err != nil {
+			return err
+		}
+		pending := group.AddPending(id, consumer)
+		pending.DeliveryTime = deliveryTime
+		pending.DeliveryCount = deliveryCount
+	}
+	return nil
+}
+
+func (dec *Decoder) readFull(b []byte) error {
+	if _, err := io.ReadFull(dec.r, b); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	dec.crc.Write(b)
+	return nil
+}
+
+func (dec *Decoder) readByte() (byte, error) {
+	b, err := dec.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	dec.one[0] = b
+	dec.crc.Write(dec.one[:])
+	return b, nil
+}
+
+// ReadByte 实现io.ByteReader，用于读取varint
+func (dec *Decoder) ReadByte() (byte, error) {
+	return dec.readByte()
+}
+
+func (dec *Decoder) readUvarint() (uint64, error) {
+	return binary.ReadUvarint(dec)
+}
+
+func (dec *Decoder) readVarint() (int64, error) {
+	return binary.ReadVarint(dec)
+}
+
+func (dec *Decoder) readBytes() ([]byte, error) {
+	n, err := dec.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxPrealloc { // 长度可能因为文件损坏而异常大，边读边分配内存，读到文件结尾时报错
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, dec.r, int64(n)); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		dec.crc.Write(buf.Bytes())
+		return buf.Bytes(), nil
+	}
+	b := make([]byte, n)
+	if err := dec.readFull(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (dec *Decoder) readString() (string, error) {
+	b, err := dec.readBytes()
+	return string(b), err
+}
+
+func (dec *Decoder) readFloat() (float64, error) {
+	var b [8]byte
+	if err := dec.readFull(b[:]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+}
+
+func (dec *Decoder) readID() (stream.ID, error) {
+	ms, err := dec.readUvarint()
+	if err != nil {
+		return stream.ID{}, err
+	}
+	seq, err := dec.readUvarint()
+	if err != nil {
+		return stream.ID{}, err
+	}
+	return stream.ID{Ms: ms, Seq: seq}, nil
+}
+
+// readTime 读取毫秒时间戳，0表示零值
+func (dec *Decoder) readTime() (time.Time, error) {
+	ms, err := dec.readVarint()
+	if err != nil || ms == 0 {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
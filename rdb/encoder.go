@@ -0,0 +1,247 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"goRedis/interface/database"
+	"goRedis/interface/meta/dict"
+	"goRedis/meta/list"
+	"goRedis/meta/set"
+	"goRedis/meta/sortedset"
+	"goRedis/meta/stream"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"time"
+)
+
+// Write 将db中所有数据库的键值对写入快照
+func Write(w io.Writer, db database.DBEngine) error {
+	enc := NewEncoder(w)
+	if err := enc.WriteHeader(); err != nil {
+		return err
+	}
+	currentDB := -1
+	var err error
+	db.ForEach(func(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) bool {
+		if dbIndex != currentDB {
+			if err = enc.WriteDBHeader(dbIndex); err != nil {
+				return false
+			}
+			currentDB = dbIndex
+		}
+		err = enc.WriteEntry(key, entity, expiration)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return enc.WriteEnd()
+}
+
+// Encoder 将数据库中的键值对编码为快照
+type Encoder struct {
+	w   *bufio.Writer
+	crc hash.Hash64
+	buf [binary.MaxVarintLen64]byte
+	err error // 第一次写入失败的错误，之后的写入都会被忽略
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	crc := crc64.New(crcTable)
+	return &Encoder{
+		w:   bufio.NewWriter(io.MultiWriter(w, crc)),
+		crc: crc,
+	}
+}
+
+// WriteHeader 写入文件头
+func (enc *Encoder) WriteHeader() error {
+	enc.writeRaw([]byte(magic + version))
+	return enc.err
+}
+
+// WriteDBHeader 写入数据库编号，之后写入的键值对都属于该数据库
+func (enc *Encoder) WriteDBHeader(dbIndex int) error {
+	enc.writeByte(opSelectDB)
+	enc.writeUvarint(uint64(dbIndex))
+	return enc.err
+}
+
+// WriteEntry 写入一个键值对，expiration为nil表示没有过期时间
+func (enc *Encoder) WriteEntry(key string, entity *database.DataEntity, expiration *time.Time) error {
+	if expiration != nil {
+		enc.writeByte(opExpireTimeMs)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(expiration.UnixMilli()))
+		enc.writeRaw(b[:])
+	}
+	switch data := entity.Data.(type) {
+	case []byte:
+		enc.writeByte(typeString)
+		enc.writeString(key)
+		enc.writeBytes(data)
+	case *list.QuickList:
+		enc.writeByte(typeList)
+		enc.writeString(key)
+		enc.writeUvarint(uint64(data.Len()))
+		data.ForEach(func(i int, v any) bool {
+			enc.writeBytes(v.([]byte))
+			return enc.err == nil
+		})
+	case *set.Set:
+		enc.writeByte(typeSet)
+		enc.writeString(key)
+		members := data.ToSlice()
+		enc.writeUvarint(uint64(len(members)))
+		for _, member := range members {
+			enc.writeString(member)
+		}
+	case *sortedset.SortedSet:
+		enc.writeByte(typeZSet)
+		enc.writeString(key)
+		elements := data.RangeByRank(0, data.Len(), false)
+		enc.writeUvarint(uint64(len(elements)))
+		for _, element := range elements {
+			enc.writeString(element.Member)
+			enc.writeFloat(element.Score)
+		}
+	case dict.Dict:
+		enc.writeByte(typeHash)
+		enc.writeString(key)
+		var fields, values [][]byte
+		data.ForEach(func(field string, val any) bool {
+			fields = append(fields, []byte(field))
+			values = append(values, val.([]byte))
+			return true
+		})
+		enc.writeUvarint(uint64(len(fields)))
+		for i := range fields {
+			enc.writeBytes(fields[i])
+			enc.writeBytes(values[i])
+		}
+	case *stream.Stream:
+		enc.writeByte(typeStream)
+		enc.writeString(key)
+		enc.writeStream(data)
+	default:
+		return errors.New("rdb: unknown value type of key " + key)
+	}
+	return enc.err
+}
+
+// writeStream 写入流的消息、元信息和消费者组
+func (enc *Encoder) writeStream(s *stream.Stream) {
+	entries := s.Range(stream.MinID, stream.MaxID, 0, false)
+	enc.writeUvarint(uint64(len(entries)))
+	for _, entry := range entries {
+		enc.writeID(entry.ID)
+		enc.writeUvarint(uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			enc.writeBytes(field)
+		}
+	}
+	enc.writeID(s.LastID())
+	enc.writeID(s.MaxDeletedID())
+	enc.writeVarint(s.EntriesAdded())
+
+	groups := s.Groups()
+	enc.writeUvarint(uint64(len(groups)))
+	for _, group := range groups {
+		enc.writeString(group.Name)
+		enc.writeID(group.LastID)
+		enc.writeVarint(group.EntriesRead)
+		consumers := group.Consumers()
+		enc.writeUvarint(uint64(len(consumers)))
+		for _, consumer := range consumers {
+			enc.writeString(consumer.Name)
+			enc.writeTime(consumer.SeenTime)
+			enc.writeTime(consumer.ActiveTime)
+			ids := consumer.PendingIDs()
+			enc.writeUvarint(uint64(len(ids)))
+			for _, id := range ids {
+				pending := group.GetPending(id)
+				enc.writeID(id)
+				enc.writeTime(pending.DeliveryTime)
+				enc.writeVarint(pending.DeliveryCount)
+			}
+		}
+	}
+}
+
+// WriteEnd 写入文件结束标记和校验和，并将缓冲区中的数据写入底层的writer
+func (enc *Encoder) WriteEnd() error {
+	enc.writeByte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+	if err := enc.w.Flush(); err != nil { // 校验和需要包含缓冲区中的所有数据
+		return err
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], enc.crc.Sum64())
+	enc.writeRaw(b[:])
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+func (enc *Encoder) writeRaw(b []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(b)
+}
+
+func (enc *Encoder) writeByte(b byte) {
+	if enc.err != nil {
+		return
+	}
+	enc.err = enc.w.WriteByte(b)
+}
+
+func (enc *Encoder) writeUvarint(n uint64) {
+	size := binary.PutUvarint(enc.buf[:], n)
+	enc.writeRaw(enc.buf[:size])
+}
+
+func (enc *Encoder) writeVarint(n int64) {
+	size := binary.PutVarint(enc.buf[:], n)
+	enc.writeRaw(enc.buf[:size])
+}
+
+func (enc *Encoder) writeBytes(b []byte) {
+	enc.writeUvarint(uint64(len(b)))
+	enc.writeRaw(b)
+}
+
+func (enc *Encoder) writeString(s string) {
+	enc.writeUvarint(uint64(len(s)))
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.WriteString(s)
+}
+
+func (enc *Encoder) writeFloat(f float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	enc.writeRaw(b[:])
+}
+
+func (enc *Encoder) writeID(id stream.ID) {
+	enc.writeUvarint(id.Ms)
+	enc.writeUvarint(id.Seq)
+}
+
+// writeTime 写入毫秒时间戳，零值写入0
+func (enc *Encoder) writeTime(t time.Time) {
+	if t.IsZero() {
+		enc.writeVarint(0)
+		return
+	}
+	enc.writeVarint(t.UnixMilli())
+}
@@ -0,0 +1,50 @@
+// Package rdb 二进制快照格式的编码和解码
+//
+// 文件格式：
+//
+//	"GOREDIS" 版本号(4字节) { SELECTDB 库号 { [EXPIRETIME_MS 过期时间] 类型 key value } } EOF 校验和(8字节)
+//
+// 长度和整数使用varint编码，字符串为长度+内容，校验和为EOF之前所有字节的CRC64
+package rdb
+
+import (
+	"errors"
+	"hash/crc64"
+)
+
+const (
+	magic   = "GOREDIS"
+	version = "0001"
+)
+
+// 操作码，与值的类型共用一个字节
+const (
+	opExpireTimeMs byte = 0xFC // 之后的key的过期时间，8字节毫秒时间戳
+	opSelectDB     byte = 0xFE // 之后的key所在的数据库
+	opEOF          byte = 0xFF // 文件结束，之后是校验和
+)
+
+// 值的类型
+const (
+	typeString byte = iota
+	typeList
+	typeSet
+	typeZSet
+	typeHash
+	typeStream
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+var (
+	ErrInvalidFormat = errors.New("rdb: invalid file format")
+	ErrChecksum      = errors.New("rdb: checksum mismatch")
+)
+
+// IsRDB 判断数据是否以快照文件头开始，用于识别带有快照前缀的AOF文件
+func IsRDB(header []byte) bool {
+	return len(header) >= len(magic) && string(header[:len(magic)]) == magic
+}
+
+// HeaderSize 快照文件头的长度
+const HeaderSize = len(magic) + len(version)
@@ -145,6 +145,16 @@ func (client *Client) handleWrite() {
 
 // Send 发送一条请求到 redis 服务端
 func (client *Client) Send(args [][]byte) resp.Reply {
+	return client.send(args, maxWait)
+}
+
+// SendBlocking 发送阻塞命令，不限制等待时间，由服务端在命令超时后回复
+func (client *Client) SendBlocking(args [][]byte) resp.Reply {
+	return client.send(args, 0)
+}
+
+// send 发送请求并等待响应，timeout为0表示一直等待
+func (client *Client) send(args [][]byte, timeout time.Duration) resp.Reply {
 	if atomic.LoadInt32(&client.status) != running {
 		return reply.NewStandardErrReply("client closed")
 	}
@@ -157,8 +167,9 @@ func (client *Client) Send(args [][]byte) resp.Reply {
 	client.working.Add(1)
 	defer client.working.Done()
 	client.pendingReqs <- req
-	timeout := req.waiting.WaitWithTimeout(maxWait)
-	if timeout {
+	if timeout == 0 {
+		req.waiting.Wait()
+	} else if req.waiting.WaitWithTimeout(timeout) {
 		return reply.NewStandardErrReply("server time out")
 	}
 	if req.err != nil {
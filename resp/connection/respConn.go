@@ -13,6 +13,15 @@ type RESPConn struct {
 	mu           sync.Mutex // 每个连接要加锁
 	selectedDB   int        // 标记当前连接正在使用的数据库id
 	name         []byte     // 当前连接的名字，由客户端自定义，默认为空
+
+	multiState bool                      // 是否处于事务状态
+	queue      [][][]byte                // 事务中排队的命令
+	txErrors   []error                   // 入队时发现的错误
+	watching   map[int]map[string]uint32 // WATCH的key：数据库编号 -> key -> 版本号
+
+	subsMu   sync.Mutex          // 保护订阅信息，发布消息的连接也会读取
+	channels map[string]struct{} // 订阅的频道
+	patterns map[string]struct{} // 订阅的模式
 }
 
 // NewRESPConn 创建一个新的RESPConn
@@ -68,3 +77,108 @@ func (r *RESPConn) SetName(name []byte) {
 func (r *RESPConn) GetName() []byte {
 	return r.name
 }
+
+// InMultiState 是否处于事务状态
+func (r *RESPConn) InMultiState() bool {
+	return r.multiState
+}
+
+// SetMultiState 进入或退出事务状态，退出时清空命令队列和入队错误，WATCH的key由调用方清理
+func (r *RESPConn) SetMultiState(state bool) {
+	if !state {
+		r.queue = nil
+		r.txErrors = nil
+	}
+	r.multiState = state
+}
+
+// GetQueuedCmdLine 获取事务中排队的命令
+func (r *RESPConn) GetQueuedCmdLine() [][][]byte {
+	return r.queue
+}
+
+// EnqueueCmd 将命令加入事务队列
+func (r *RESPConn) EnqueueCmd(cmdLine [][]byte) {
+	r.queue = append(r.queue, cmdLine)
+}
+
+// AddTxError 记录入队时发现的错误
+func (r *RESPConn) AddTxError(err error) {
+	r.txErrors = append(r.txErrors, err)
+}
+
+// GetTxErrors 获取入队时发现的错误
+func (r *RESPConn) GetTxErrors() []error {
+	return r.txErrors
+}
+
+// GetWatching 获取WATCH的key，首次调用时创建
+func (r *RESPConn) GetWatching() map[int]map[string]uint32 {
+	if r.watching == nil {
+		r.watching = make(map[int]map[string]uint32)
+	}
+	return r.watching
+}
+
+// Subscribe 记录订阅的频道
+func (r *RESPConn) Subscribe(channel string) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	if r.channels == nil {
+		r.channels = make(map[string]struct{})
+	}
+	r.channels[channel] = struct{}{}
+}
+
+// UnSubscribe 取消记录订阅的频道
+func (r *RESPConn) UnSubscribe(channel string) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	delete(r.channels, channel)
+}
+
+// PSubscribe 记录订阅的模式
+func (r *RESPConn) PSubscribe(pattern string) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	if r.patterns == nil {
+		r.patterns = make(map[string]struct{})
+	}
+	r.patterns[pattern] = struct{}{}
+}
+
+// PUnSubscribe 取消记录订阅的模式
+func (r *RESPConn) PUnSubscribe(pattern string) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	delete(r.patterns, pattern)
+}
+
+// SubsCount 订阅的频道和模式总数
+func (r *RESPConn) SubsCount() int {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	return len(r.channels) + len(r.patterns)
+}
+
+// GetChannels 获取订阅的所有频道
+func (r *RESPConn) GetChannels() []string {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	channels := make([]string, 0, len(r.channels))
+	for channel := range r.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// GetPatterns 获取订阅的所有模式
+func (r *RESPConn) GetPatterns() []string {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	patterns := make([]string, 0, len(r.patterns))
+	for pattern := range r.patterns {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
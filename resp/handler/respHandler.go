@@ -8,6 +8,7 @@ import (
 	"goRedis/config"
 	"goRedis/database"
 	dbinterface "goRedis/interface/database"
+	"goRedis/interface/resp"
 	"goRedis/lib/logger"
 	"goRedis/resp/connection"
 	"goRedis/resp/parser"
@@ -69,12 +70,21 @@ func (r *RESPHandler) Handler(ctx context.Context, conn net.Conn) {
 		}
 	}()
 
-	for payload := range ch { // 不断读取管道中的数据，即客户端请求
+	var pending []*parser.Payload // 阻塞期间收到的请求，解除阻塞后按顺序处理
+	for {
+		var payload *parser.Payload
+		if len(pending) > 0 {
+			payload = pending[0]
+			pending = pending[1:]
+		} else {
+			var ok bool
+			if payload, ok = <-ch; !ok { // 不断读取管道中的数据，即客户端请求
+				break
+			}
+		}
 		if payload.Err != nil { // 解析出错
 			// 如果是EOF或者连接被关闭，关闭连接
-			if errors.Is(payload.Err, io.EOF) ||
-				errors.Is(payload.Err, io.ErrUnexpectedEOF) ||
-				strings.Contains(payload.Err.Error(), ErrClosed) {
+			if isClosedErr(payload.Err) {
 				r.closeClient(client) // 关闭客户端连接
 				//logger.Info("Connection closed: " + client.RemoteAddr().String())
 				return
@@ -98,7 +108,37 @@ func (r *RESPHandler) Handler(ctx context.Context, conn net.Conn) {
 			logger.Error("need multi bulk reply")
 			continue
 		}
-		results := r.db.Exec(client, mbreply.Args) // 执行指令
+		var results resp.Reply
+		cmdName := strings.ToLower(string(mbreply.Args[0]))
+		if client.SubsCount() > 0 && !allowedInSubscribeMode(cmdName) { // 订阅模式下只能执行订阅相关的命令
+			results = reply.NewStandardErrReply("ERR Can't execute '" + cmdName + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context")
+		} else if client.SubsCount() > 0 && cmdName == "ping" {
+			results = subscribeModePing(mbreply.Args[1:])
+		} else {
+			if isSubscribeCommand(cmdName) { // 订阅的确认消息直接写入连接，先发送之前的回复以保证顺序
+				mu.Lock()
+				if buffer.Len() > 0 {
+					_ = client.Write(buffer.Bytes())
+					buffer.Reset()
+				}
+				mu.Unlock()
+			}
+			results = r.db.Exec(client, mbreply.Args) // 执行指令
+		}
+		if blocking, ok := results.(resp.BlockingReply); ok { // 阻塞命令，先把之前的回复发送出去再等待
+			mu.Lock()
+			if buffer.Len() > 0 {
+				_ = client.Write(buffer.Bytes())
+				buffer.Reset()
+			}
+			mu.Unlock()
+			var closed bool
+			results, pending, closed = waitBlocking(blocking, ch, pending)
+			if closed {
+				r.closeClient(client)
+				return
+			}
+		}
 		if results != nil {
 			mu.Lock()
 			buffer.Write(results.ToBytes())
@@ -122,6 +162,59 @@ func (r *RESPHandler) Handler(ctx context.Context, conn net.Conn) {
 	mu.Unlock()
 }
 
+// waitBlocking 等待阻塞命令完成，期间继续读取客户端请求放入pending，
+// 以便及时发现连接关闭。连接关闭时取消等待并返回closed为true
+func waitBlocking(blocking resp.BlockingReply, ch <-chan *parser.Payload, pending []*parser.Payload) (resp.Reply, []*parser.Payload, bool) {
+	cancel := make(chan struct{})
+	done := make(chan resp.Reply, 1)
+	go func() {
+		done <- blocking.Wait(cancel)
+	}()
+	for {
+		select {
+		case result := <-done:
+			return result, pending, false
+		case payload, ok := <-ch:
+			if !ok || (payload.Err != nil && isClosedErr(payload.Err)) {
+				close(cancel)
+				<-done
+				return nil, pending, true
+			}
+			pending = append(pending, payload)
+		}
+	}
+}
+
+// isSubscribeCommand 判断是否是订阅或取消订阅命令
+func isSubscribeCommand(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe":
+		return true
+	}
+	return false
+}
+
+// allowedInSubscribeMode 判断订阅模式下是否允许执行该命令
+func allowedInSubscribeMode(cmdName string) bool {
+	return cmdName == "ping" || isSubscribeCommand(cmdName)
+}
+
+// subscribeModePing 订阅模式下PING的回复为数组：["pong", message]
+func subscribeModePing(args [][]byte) resp.Reply {
+	message := []byte{}
+	if len(args) > 0 {
+		message = args[0]
+	}
+	return reply.NewMultiBulkReply([][]byte{[]byte("pong"), message})
+}
+
+// isClosedErr 判断是否是EOF或者连接被关闭造成的错误
+func isClosedErr(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), ErrClosed)
+}
+
 // Close 关闭协议层
 func (r *RESPHandler) Close() error {
 	logger.Info("handler shutting down")
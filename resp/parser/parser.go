@@ -26,6 +26,50 @@ type readState struct {
 	msgType           byte     //消息类型
 	args              [][]byte //解析出的参数数据
 	bulkLen           int64    //当前需要读取的字符串长度(用于解析'$'开头的bulk string)
+	readingEmptyBulk  bool     //正在读取空字符串$0\r\n后面的\r\n
+	readingBulkBody   bool     //正在读取字符串的内容，内容可能以'$'开头，不能当作长度解析
+
+	replies []resp.Reply  //数组中有不是字符串的元素时，按顺序记录所有元素，此时args中对应的位置为nil
+	nested  []*arrayFrame //正在读取的嵌套数组，最后一个是最内层的数组
+}
+
+// arrayFrame 数组中正在读取的嵌套数组
+type arrayFrame struct {
+	expected int          //元素个数
+	replies  []resp.Reply //已经读取的元素
+}
+
+// addArg 读取到一个字符串元素
+func (r *readState) addArg(arg []byte) {
+	if len(r.nested) > 0 {
+		r.addReply(reply.NewBulkReply(arg))
+		return
+	}
+	if r.replies != nil {
+		r.replies = append(r.replies, reply.NewBulkReply(arg))
+	}
+	r.args = append(r.args, arg)
+}
+
+// addReply 读取到一个不是字符串的元素，如数字、状态或嵌套的数组。嵌套数组读取完后作为一个元素加入外层数组
+func (r *readState) addReply(result resp.Reply) {
+	for len(r.nested) > 0 {
+		frame := r.nested[len(r.nested)-1]
+		frame.replies = append(frame.replies, result)
+		if len(frame.replies) < frame.expected {
+			return
+		}
+		r.nested = r.nested[:len(r.nested)-1]
+		result = reply.NewMultiRawReply(frame.replies)
+	}
+	if r.replies == nil { //之前的元素都是字符串
+		r.replies = make([]resp.Reply, 0, len(r.args)+1)
+		for _, arg := range r.args {
+			r.replies = append(r.replies, reply.NewBulkReply(arg))
+		}
+	}
+	r.replies = append(r.replies, result)
+	r.args = append(r.args, nil)
 }
 
 // finished 判断解析是否结束
@@ -45,6 +89,7 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.Error(string(debug.Stack()))
+			close(ch) // 通知读取方解析已经结束，避免一直等待
 		}
 	}()
 
@@ -89,6 +134,13 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 					state = readState{}
 					continue
 				}
+				if state.expectedArgsCount == -1 { //*-1\r\n 返回null数组，如阻塞命令超时的回复
+					ch <- &Payload{
+						Data: reply.NewNullMultiBulkReply(),
+					}
+					state = readState{}
+					continue
+				}
 			} else if msg[0] == '$' { //字符串
 				err = parseBulkHeader(msg, &state)
 				if err != nil {
@@ -125,7 +177,9 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 			}
 			if state.finished() { //数据全部读取完毕
 				var result resp.Reply
-				if state.msgType == '*' { //数组
+				if state.msgType == '*' && state.replies != nil { //元素不全是字符串的数组
+					result = reply.NewMultiRawReply(state.replies)
+				} else if state.msgType == '*' { //数组
 					result = reply.NewMultiBulkReply(state.args)
 				} else if state.msgType == '$' { //字符串
 					result = reply.NewBulkReply(state.args[0])
@@ -157,7 +211,7 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 			}
 			return nil, true, err
 		}
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' { //非io错误，读取到的数据为空或结尾不以'\r\n'结尾，协议格式错误
+		if len(msg) < 2 || msg[len(msg)-2] != '\r' { //非io错误，读取到的数据为空或结尾不以'\r\n'结尾，协议格式错误
 			logger.Warn("protocol error:" + string(msg))
 			return nil, false, errors.New("protocol error:" + string(msg))
 		}
@@ -188,8 +242,8 @@ func parseMultiBulkHeader(msg []byte, state *readState) error {
 		return errors.New("protocol error:" + string(msg))
 	}
 
-	if expectedLine == 0 {
-		state.expectedArgsCount = 0
+	if expectedLine == 0 || expectedLine == -1 { //空数组或null数组，没有需要读取的数据
+		state.expectedArgsCount = int(expectedLine)
 		return nil
 	} else if expectedLine > 0 {
 		state.readingMultiLine = true                //正在解析多行数据
@@ -214,8 +268,16 @@ func parseBulkHeader(msg []byte, state *readState) error {
 
 	if state.bulkLen == -1 { //字符串为null
 		return nil
+	} else if state.bulkLen == 0 { //空字符串，下一行只有\r\n
+		state.readingMultiLine = true
+		state.readingEmptyBulk = true
+		state.msgType = msg[0]
+		state.expectedArgsCount = 1
+		state.args = make([][]byte, 0, 1)
+		return nil
 	} else if state.bulkLen > 0 { //当作长度为1的数组处理
 		state.readingMultiLine = true     //正在解析多行数据
+		state.readingBulkBody = true      //下一行是字符串的内容
 		state.msgType = msg[0]            //协议中的第一个字节标识了消息类型
 		state.expectedArgsCount = 1       //期望解析的参数个数
 		state.args = make([][]byte, 0, 1) //存放解析出的数据
@@ -229,6 +291,9 @@ func parseBulkHeader(msg []byte, state *readState) error {
 // parseSingleLineReply 解析单行回复，示例：+OK\r\n	-err\r\n	:3\r\n
 func parseSingleLineReply(msg []byte) (resp.Reply, error) {
 	msg0 := strings.TrimSuffix(string(msg), "\r\n") //删掉后缀\r\n
+	if len(msg0) == 0 {
+		return nil, errors.New("protocol error:" + string(msg))
+	}
 	var result resp.Reply
 
 	switch msg0[0] { //判断回复类型
@@ -237,7 +302,7 @@ func parseSingleLineReply(msg []byte) (resp.Reply, error) {
 	case '-':
 		result = reply.NewStandardErrReply(msg0[1:])
 	case ':':
-		num, err := strconv.ParseInt(msg0[1:], 10, 32)
+		num, err := strconv.ParseInt(msg0[1:], 10, 64)
 		if err != nil {
 			logger.Warn(err)
 			return nil, errors.New("protocol error:" + msg0)
@@ -251,18 +316,57 @@ func readBody(msg []byte, state *readState) error {
 	var err error
 	line := msg[:len(msg)-2] //删除末尾的\r\n
 
-	if line[0] == '$' {
+	if state.readingEmptyBulk { //空字符串的内容只有\r\n
+		state.readingEmptyBulk = false
+		if len(line) != 0 {
+			return errors.New("protocol error:" + string(msg))
+		}
+		state.addArg([]byte{})
+		return nil
+	}
+	if state.readingBulkBody {
+		state.readingBulkBody = false
+		state.addArg(line)
+		return nil
+	}
+	if len(line) == 0 {
+		return errors.New("protocol error:" + string(msg))
+	}
+	switch line[0] {
+	case '$':
 		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 32) //读取字符串长度
 		if err != nil {
 			logger.Warn(err)
 			return errors.New("protocol error:" + string(msg))
 		}
-		if state.bulkLen <= 0 { //要读取的字符串长度小于等于0，设置结果为空
-			state.args = append(state.args, []byte{})
+		if state.bulkLen > 0 {
+			state.readingBulkBody = true
+		} else if state.bulkLen == 0 { //空字符串，下一行只有\r\n
+			state.readingEmptyBulk = true
+		} else if state.bulkLen < 0 { //要读取的字符串长度小于0，元素为null
+			state.addArg(nil)
 			state.bulkLen = 0
 		}
-	} else {
-		state.args = append(state.args, line)
+	case '*': //嵌套的数组
+		count, err := strconv.ParseInt(string(line[1:]), 10, 32)
+		if err != nil || count < -1 {
+			return errors.New("protocol error:" + string(msg))
+		}
+		if count == 0 {
+			state.addReply(reply.NewEmptyMultiBulkReply())
+		} else if count == -1 {
+			state.addReply(reply.NewNullMultiBulkReply())
+		} else {
+			state.nested = append(state.nested, &arrayFrame{expected: int(count)})
+		}
+	case '+', '-', ':': //数组中的数字、状态和错误
+		result, err := parseSingleLineReply(msg)
+		if err != nil {
+			return err
+		}
+		state.addReply(result)
+	default:
+		state.addArg(line)
 	}
 	return nil
 }
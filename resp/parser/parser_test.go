@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"goRedis/resp/reply"
+	"testing"
+)
+
+// parseAll 解析data中的所有回复，直到解析结束
+func parseAll(t *testing.T, data string) []*Payload {
+	t.Helper()
+	var payloads []*Payload
+	for payload := range ParseStream(bytes.NewReader([]byte(data))) {
+		payloads = append(payloads, payload)
+	}
+	if len(payloads) == 0 || payloads[len(payloads)-1].Err == nil {
+		t.Fatalf("stream of %q did not end with EOF", data)
+	}
+	return payloads[:len(payloads)-1] // 最后一个是EOF
+}
+
+func TestParseEmptyBulk(t *testing.T) {
+	payloads := parseAll(t, "$0\r\n\r\n+OK\r\n*2\r\n$0\r\n\r\n$1\r\na\r\n")
+	if len(payloads) != 3 {
+		t.Fatalf("got %d payloads, want 3", len(payloads))
+	}
+	for _, payload := range payloads {
+		if payload.Err != nil {
+			t.Fatalf("unexpected error: %v", payload.Err)
+		}
+	}
+	if bulk, ok := payloads[0].Data.(*reply.BulkReply); !ok || bulk.Arg == nil || len(bulk.Arg) != 0 {
+		t.Errorf("got %q, want empty bulk", payloads[0].Data.ToBytes())
+	}
+	if got := string(payloads[1].Data.ToBytes()); got != "+OK\r\n" {
+		t.Errorf("got %q, want +OK", got)
+	}
+	if got := string(payloads[2].Data.ToBytes()); got != "*2\r\n$0\r\n\r\n$1\r\na\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestParseEmptyLine(t *testing.T) {
+	payloads := parseAll(t, "\r\n+OK\r\n")
+	if len(payloads) != 2 || payloads[0].Err == nil {
+		t.Fatalf("empty line should be a protocol error, got %d payloads", len(payloads))
+	}
+	if got := string(payloads[1].Data.ToBytes()); got != "+OK\r\n" {
+		t.Errorf("got %q, want +OK", got)
+	}
+}
+
+func TestParseNestedArray(t *testing.T) {
+	replies := []string{
+		"*2\r\n*1\r\n$1\r\na\r\n:1\r\n",                                               // 嵌套数组和数字
+		"*2\r\n$1\r\n0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",                               // HSCAN
+		"*2\r\n:3\r\n$3\r\n1.5\r\n",                                                   // ZRANK WITHSCORE
+		"*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",                       // XRANGE
+		"*3\r\n*2\r\n$1\r\n1\r\n$1\r\n2\r\n*-1\r\n*0\r\n",                             // GEOPOS
+		"*3\r\n$1\r\na\r\n$-1\r\n+OK\r\n",                                             // null和状态
+		"*2\r\n*2\r\n*1\r\n:9223372036854775807\r\n-ERR x\r\n$0\r\n\r\n",              // 多层嵌套
+		"*4\r\n$1\r\n0\r\n:2\r\n*2\r\n:1\r\n$1\r\nb\r\n*1\r\n*2\r\n$1\r\nc\r\n:3\r\n", // XPENDING
+	}
+	var stream string
+	for _, r := range replies {
+		stream += r
+	}
+	stream += "+OK\r\n"
+	payloads := parseAll(t, stream)
+	if len(payloads) != len(replies)+1 {
+		t.Fatalf("got %d payloads, want %d", len(payloads), len(replies)+1)
+	}
+	for i, want := range append(replies, "+OK\r\n") {
+		if payloads[i].Err != nil {
+			t.Fatalf("reply %d: unexpected error: %v", i, payloads[i].Err)
+		}
+		if got := string(payloads[i].Data.ToBytes()); got != want {
+			t.Errorf("reply %d: got %q, want %q", i, got, want)
+		}
+	}
+	if _, ok := payloads[1].Data.(*reply.MultiRawReply); !ok {
+		t.Errorf("mixed array should be a MultiRawReply, got %T", payloads[1].Data)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	payloads := parseAll(t, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$0\r\n\r\n")
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	cmd, ok := payloads[0].Data.(*reply.MultiBulkReply)
+	if !ok {
+		t.Fatalf("command should be a MultiBulkReply, got %T", payloads[0].Data)
+	}
+	if len(cmd.Args) != 3 || string(cmd.Args[0]) != "SET" || cmd.Args[2] == nil || len(cmd.Args[2]) != 0 {
+		t.Errorf("got %q", cmd.Args)
+	}
+}
@@ -71,7 +71,7 @@ type EmptyMultiBulkReply struct {
 
 var emptyMultiBulkReply = new(EmptyMultiBulkReply)
 
-var emptyMultiBulkbytes = []byte("*-1\r\n") //表示空数组
+var emptyMultiBulkbytes = []byte("*0\r\n") //表示空数组
 
 func NewEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return emptyMultiBulkReply
@@ -81,6 +81,22 @@ func (n *EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkbytes
 }
 
+// NullMultiBulkReply 空数组(NULL)响应，例如阻塞命令超时
+type NullMultiBulkReply struct {
+}
+
+var nullMultiBulkReply = new(NullMultiBulkReply)
+
+var nullMultiBulkbytes = []byte("*-1\r\n") //表示NULL数组，而不是长度为0的数组
+
+func NewNullMultiBulkReply() *NullMultiBulkReply {
+	return nullMultiBulkReply
+}
+
+func (n *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkbytes
+}
+
 // NoReply 空响应
 type NoReply struct {
 }
@@ -96,3 +112,19 @@ func NewNoReply() *NoReply {
 func (n *NoReply) ToBytes() []byte {
 	return nobytes
 }
+
+// QueuedReply 事务中命令入队的响应
+type QueuedReply struct {
+}
+
+var queuedReply = new(QueuedReply)
+
+var queuedbytes = []byte("+QUEUED\r\n")
+
+func NewQueuedReply() *QueuedReply {
+	return queuedReply
+}
+
+func (q *QueuedReply) ToBytes() []byte {
+	return queuedbytes
+}
@@ -25,7 +25,7 @@ func NewBulkReply(arg []byte) *BulkReply {
 
 // ToBytes 拼接字符串类型数据的响应，示例：$5\r\nhello\r\n
 func (b *BulkReply) ToBytes() []byte {
-	if len(b.Arg) == 0 { //字符串为空返回NULL
+	if b.Arg == nil { //nil返回NULL，空字符串返回$0
 		return NewNullBulkReply().ToBytes()
 	}
 	return []byte("$" + strconv.Itoa(len(b.Arg)) + CRLF + string(b.Arg) + CRLF)
@@ -56,6 +56,26 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	return buf.Bytes()
 }
 
+// MultiRawReply 由任意类型的回复组成的数组响应，用于数组元素不全是字符串的场景，示例：*2\r\n:1\r\n$1\r\na\r\n
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+func NewMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		replies,
+	}
+}
+
+func (m *MultiRawReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(m.Replies)) + CRLF)
+	for _, r := range m.Replies {
+		buf.Write(r.ToBytes())
+	}
+	return buf.Bytes()
+}
+
 // StatusReply 状态响应
 type StatusReply struct {
 	Status string
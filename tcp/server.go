@@ -20,7 +20,7 @@ type Config struct {
 
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{})
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	//syscall.SIGHUP：通常表示终端断开或者控制进程结束，常用于通知守护进程重新读取配置文件。
 	//syscall.SIGQUIT：通常表示用户请求退出并生成核心转储（core dump），用于调试。
 	//syscall.SIGTERM：是一个终止信号，通常用于请求程序正常退出。